@@ -26,17 +26,17 @@ func (s *Star) Calculate(json []byte) (interface{}, error) {
 }
 
 func main() {
-	// Add custom coercion to the parser.
+	// Add custom coercion to an environment copied from the defaults, registering it within ksql.Coercions
+	// instead would make it available to every expression parsed using ksql.Parse.
 	// REMEMBER: coercions start and end with an _(underscore).
-	guard := ksql.Coercions.Lock()
-	guard.T["_star_"] = func(_ *ksql.Parser, constEligible bool, expression ksql.Expression) (stillConstEligible bool, e ksql.Expression, err error) {
+	env := ksql.NewEnvironment()
+	env.SetCoercion("_star_", func(_ *ksql.Parser, constEligible bool, expression ksql.Expression) (stillConstEligible bool, e ksql.Expression, err error) {
 		return constEligible, &Star{expression}, nil
-	}
-	guard.Unlock()
+	})
 
 	expression := []byte(`COERCE "My Name" _star_`)
 	input := []byte(`{}`)
-	ex, err := ksql.Parse(expression)
+	ex, err := ksql.ParseWith(env, expression)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,222 @@
+package ksql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The aggregate functions operate on arrays whose elements, unlike function arguments, may be exact
+// numbers, see ParseOptions.ExactNumbers, which are kept exact. NULL elements are ignored by all but
+// `distinct` and `sort`.
+
+// filterFunction is the name of the built in filter function, see filterCall.
+const filterFunction = "filter"
+
+// comparableTypes are the element types that can be compared by min, max and sort.
+const comparableTypes = ArgBool | ArgNumber | ArgString | ArgDateTime | ArgDuration
+
+// compareValues compares two values of the same comparable type returning -1, 0 or +1, or false if the
+// values can't be compared.
+func compareValues(left, right any) (int, bool) {
+	if cmp, ok := compareNumbers(left, right); ok {
+		return cmp, true
+	}
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case l < r:
+			return -1, true
+		case l > r:
+			return 1, true
+		default:
+			return 0, true
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(l, r), true
+	case time.Time:
+		r, ok := right.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case l.Before(r):
+			return -1, true
+		case l.After(r):
+			return 1, true
+		default:
+			return 0, true
+		}
+	case time.Duration:
+		r, ok := right.(time.Duration)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case l < r:
+			return -1, true
+		case l > r:
+			return 1, true
+		default:
+			return 0, true
+		}
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case l == r:
+			return 0, true
+		case r:
+			return -1, true
+		default:
+			return 1, true
+		}
+	default:
+		return 0, false
+	}
+}
+
+// numberArg returns the argument at the index which must be a number, for functions that also accept an array
+// in place of all their arguments.
+func numberArg(name string, args []any, i int) (float64, error) {
+	n, ok := args[i].(float64)
+	if !ok {
+		return 0, ErrFunctionArgument{Function: name, Index: i, Expected: ArgNumber, Value: args[i]}
+	}
+	return n, nil
+}
+
+// extremeElement returns the smallest, or if max the largest, non NULL element of the array or NULL if none.
+func extremeElement(name string, arr []any, max bool) (any, error) {
+	var result any
+	for _, v := range arr {
+		if v == nil {
+			continue
+		}
+		if argTypeOf(v)&comparableTypes == 0 {
+			return nil, ErrFunctionArgument{Function: name, Index: 0, Expected: comparableTypes, Value: v}
+		}
+		if result == nil {
+			result = v
+			continue
+		}
+		cmp, ok := compareValues(v, result)
+		if !ok {
+			return nil, ErrFunctionArgument{Function: name, Index: 0, Expected: argTypeOf(result), Value: v}
+		}
+		if (max && cmp > 0) || (!max && cmp < 0) {
+			result = v
+		}
+	}
+	return result, nil
+}
+
+// sumElements returns the sum and number of the non NULL elements of the array, which must be numbers.
+func sumElements(name string, arr []any) (sum any, n int, err error) {
+	sum = 0.0
+	for _, v := range arr {
+		switch v.(type) {
+		case nil:
+			continue
+		case float64:
+			if s, ok := sum.(float64); ok {
+				sum = s + v.(float64)
+				n++
+				continue
+			}
+		default:
+			if argTypeOf(v) != ArgNumber {
+				return nil, 0, ErrFunctionArgument{Function: name, Index: 0, Expected: ArgNumber | ArgNull, Value: v}
+			}
+		}
+		if sum, _, err = exactArithmetic('+', sum, v); err != nil {
+			return nil, 0, err
+		}
+		n++
+	}
+	return sum, n, nil
+}
+
+// averageElements returns the average of the non NULL elements of the array, or NULL if none.
+func averageElements(name string, arr []any) (any, error) {
+	sum, n, err := sumElements(name, arr)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	if s, ok := sum.(float64); ok {
+		return s / float64(n), nil
+	}
+	result, _, err := exactArithmetic('/', sum, int64(n))
+	return result, err
+}
+
+// distinctElements returns the elements of the array with any duplicates, including exact numbers equal to
+// float64 numbers, removed keeping the first occurrence.
+func distinctElements(arr []any) []any {
+	result := make([]any, 0, len(arr))
+OUTER:
+	for _, v := range arr {
+		for _, seen := range result {
+			if valuesEqual(v, seen) {
+				continue OUTER
+			}
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// sortElements returns a sorted copy of the array, with NULL elements last.
+func sortElements(name string, arr []any, order string) ([]any, error) {
+	var descending bool
+	switch strings.ToLower(order) {
+	case "asc":
+	case "desc":
+		descending = true
+	default:
+		return nil, ErrCustom{S: fmt.Sprintf("invalid sort order `%s` for function `%s`, expected asc or desc", order, name)}
+	}
+
+	var first any
+	for _, v := range arr {
+		if v == nil {
+			continue
+		}
+		if argTypeOf(v)&comparableTypes == 0 {
+			return nil, ErrFunctionArgument{Function: name, Index: 0, Expected: comparableTypes, Value: v}
+		}
+		if first == nil {
+			first = v
+		} else if _, ok := compareValues(first, v); !ok {
+			return nil, ErrFunctionArgument{Function: name, Index: 0, Expected: argTypeOf(first), Value: v}
+		}
+	}
+
+	result := make([]any, len(arr))
+	copy(result, arr)
+	sort.SliceStable(result, func(i, j int) bool {
+		switch {
+		case result[i] == nil:
+			return false
+		case result[j] == nil:
+			return true
+		}
+		cmp, _ := compareValues(result[i], result[j])
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	return result, nil
+}
@@ -0,0 +1,198 @@
+package ksql
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateFunctions(t *testing.T) {
+	assert := require.New(t)
+
+	const src = `{"items":[{"sku":"a","price":2.5,"qty":5},{"sku":"b","price":10,"qty":20},{"sku":"c","price":null,"qty":1}],"tags":["y","x","y",null],"mixed":[1,"a"],"empty":[],"name":"joey"}`
+
+	tests := []struct {
+		name     string
+		exp      string
+		expected any
+		err      error
+	}{
+		{name: "count skips nulls", exp: `count(.items.#.price)`, expected: 2.0},
+		{name: "count empty", exp: `count(.empty)`, expected: 0.0},
+		{name: "count missing", exp: `count(.missing)`, expected: 0.0},
+		{name: "count literal", exp: `count([1, NULL, "a"])`, expected: 2.0},
+		{name: "sum", exp: `sum(.items.#.price)`, expected: 12.5},
+		{name: "sum empty is null", exp: `sum(.empty)`, expected: nil},
+		{name: "sum missing is null", exp: `sum(.missing)`, expected: nil},
+		{name: "sum literal", exp: `sum([1, .items.0.qty, 2 * 3])`, expected: 12.0},
+		{
+			name: "sum non number",
+			exp:  `sum(.tags)`,
+			err:  ErrFunctionArgument{Function: "sum", Index: 0, Expected: ArgNumber | ArgNull, Value: "y"},
+		},
+		{name: "avg skips nulls", exp: `avg(.items.#.price)`, expected: 6.25},
+		{name: "avg empty is null", exp: `avg(.empty)`, expected: nil},
+		{name: "min array", exp: `min(.items.#.qty)`, expected: 1.0},
+		{name: "max array", exp: `max(.items.#.price)`, expected: 10.0},
+		{name: "min strings", exp: `min(.tags)`, expected: "x"},
+		{name: "max strings", exp: `max(.tags)`, expected: "y"},
+		{name: "max empty is null", exp: `max(.empty)`, expected: nil},
+		{name: "min numbers", exp: `min(3, 1, 2)`, expected: 1.0},
+		{
+			name: "min mixed types",
+			exp:  `min(.mixed)`,
+			err:  ErrFunctionArgument{Function: "min", Index: 0, Expected: ArgNumber, Value: "a"},
+		},
+		{
+			name: "max objects",
+			exp:  `max(.items)`,
+			err:  ErrFunctionArgument{Function: "max", Index: 0, Expected: comparableTypes, Value: map[string]any{"sku": "a", "price": 2.5, "qty": 5.0}},
+		},
+		{
+			name: "min array with numbers",
+			exp:  `min(.empty, 1)`,
+			err:  ErrFunctionArgument{Function: "min", Index: 0, Expected: ArgNumber, Value: []any{}},
+		},
+		{name: "distinct", exp: `distinct(.tags)`, expected: []any{"y", "x", nil}},
+		{name: "distinct literal", exp: `distinct([1, 2, 1, 2])`, expected: []any{1.0, 2.0}},
+		{name: "sort", exp: `sort(.tags)`, expected: []any{"x", "y", "y", nil}},
+		{name: "sort descending", exp: `sort(.items.#.price, "DESC")`, expected: []any{10.0, 2.5, nil}},
+		{name: "sort empty", exp: `sort(.empty)`, expected: []any{}},
+		{
+			name: "sort mixed types",
+			exp:  `sort(.mixed)`,
+			err:  ErrFunctionArgument{Function: "sort", Index: 0, Expected: ArgNumber, Value: "a"},
+		},
+		{
+			name: "sort invalid order",
+			exp:  `sort(.tags, "up")`,
+			err:  ErrCustom{S: "invalid sort order `up` for function `sort`, expected asc or desc"},
+		},
+		{name: "filter", exp: `filter(.items, .qty > 1)`, expected: []any{
+			map[string]any{"sku": "a", "price": 2.5, "qty": 5.0},
+			map[string]any{"sku": "b", "price": 10.0, "qty": 20.0},
+		}},
+		{name: "filter scalars", exp: `filter(.tags, .@this == "y")`, expected: []any{"y", "y"}},
+		{name: "filter scalars root", exp: `filter(.tags, . != "y")`, expected: []any{"x", nil}},
+		{name: "filter non boolean predicate", exp: `filter(.tags, .@this)`, expected: []any{}},
+		{name: "filter literal", exp: `filter([1, 5, 10], .@this > 2)`, expected: []any{5.0, 10.0}},
+		{name: "filter missing is null", exp: `filter(.missing, .qty > 1)`, expected: nil},
+		{name: "aggregate filtered", exp: `count(filter(.items.#.qty, .@this > 1))`, expected: 2.0},
+		{name: "case insensitive", exp: `SUM(.items.#.qty) == 26`, expected: true},
+		{
+			name: "filter not an array",
+			exp:  `filter(.name, true)`,
+			err:  ErrFunctionArgument{Function: "filter", Index: 0, Expected: ArgArray, Value: "joey"},
+		},
+		{
+			name: "filter predicate error",
+			exp:  `filter(.items, len(.qty) > 1)`,
+			err:  ErrFunctionArgument{Function: "len", Index: 0, Expected: ArgString | ArgArray | ArgObject, Value: 5.0},
+		},
+		{
+			name: "filter predicate error after match",
+			exp:  `filter(.mixed, .@this == 1 || abs(.@this) > 0)`,
+			err:  ErrFunctionArgument{Function: "abs", Index: 0, Expected: ArgNumber, Value: "a"},
+		},
+		{
+			name: "filter literal predicate error after match",
+			exp:  `filter([1, "a"], .@this == 1 || abs(.@this) > 0)`,
+			err:  ErrFunctionArgument{Function: "abs", Index: 0, Expected: ArgNumber, Value: "a"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(src))
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				assert.Nil(result)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestAggregateFunctionsExactNumbers(t *testing.T) {
+	assert := require.New(t)
+
+	const src = `{"prices":[0.1,0.2,null,0.3]}`
+
+	tests := []struct {
+		exp      string
+		expected any
+	}{
+		{exp: `sum(.prices)`, expected: big.NewRat(3, 5)},
+		{exp: `avg(.prices)`, expected: big.NewRat(1, 5)},
+		{exp: `sum(.prices) == 0.6`, expected: true},
+		{exp: `max(.prices)`, expected: big.NewRat(3, 10)},
+		{exp: `sort(.prices, "desc")`, expected: []any{big.NewRat(3, 10), big.NewRat(1, 5), big.NewRat(1, 10), nil}},
+		{exp: `filter(.prices, .@this IS NOT NULL && .@this > 0.15)`, expected: []any{big.NewRat(1, 5), big.NewRat(3, 10)}},
+		{exp: `sum([1, 2])`, expected: int64(3)},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.exp, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := ParseWithOptions([]byte(tc.exp), ParseOptions{ExactNumbers: true})
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(src))
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestAggregateFunctionsParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name string
+		exp  string
+		err  string
+	}{
+		{
+			name: "filter without predicate",
+			exp:  `filter(.items)`,
+			err:  "1:1: function `filter` expects 2 argument(s), found 1",
+		},
+		{
+			name: "root outside of filter predicate",
+			exp:  `len(filter(., . > 1))`,
+			err:  "1:12: Invalid selector path `.`, expected selector path",
+		},
+		{
+			name: "root in function other than filter",
+			exp:  `len(.)`,
+			err:  "1:5: Invalid selector path `.`, expected selector path",
+		},
+		{
+			name: "sort too many arguments",
+			exp:  `sort(.items, "asc", 1)`,
+			err:  "1:1: function `sort` expects at most 2 argument(s), found 3",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.exp))
+			assert.Error(err)
+			assert.Equal(tc.err, err.Error())
+		})
+	}
+}
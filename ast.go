@@ -0,0 +1,746 @@
+package ksql
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// NodeKind is the kind of a node within a parsed Expression.
+type NodeKind uint8
+
+const (
+	// NodeCustom is an Expression not implemented by this package.
+	NodeCustom NodeKind = iota
+	NodeNull
+	NodeBool
+	NodeNumber
+	NodeString
+	NodeArray
+	NodeSelectorPath
+	NodeAdd
+	NodeSubtract
+	NodeMultiply
+	NodeDivide
+	NodeEquals
+	NodeGt
+	NodeGte
+	NodeLt
+	NodeLte
+	NodeAnd
+	NodeOr
+	NodeNot
+	NodeContains
+	NodeContainsAny
+	NodeContainsAll
+	NodeIn
+	NodeStartsWith
+	NodeEndsWith
+	NodeBetween
+	NodeCoerce
+	NodeParameter
+	NodeCall
+	NodeMatches
+	NodeIMatches
+	NodeLike
+	NodeILike
+	NodeGlob
+	NodeIf
+	NodeCase
+	NodeExists
+	NodeIsNull
+	NodeIsNotNull
+	NodeIsMissing
+	NodeIsNotMissing
+	NodeAny
+	NodeAll
+	NodeNone
+	NodeObject
+)
+
+var nodeKindNames = [...]string{
+	NodeCustom:       "Custom",
+	NodeNull:         "Null",
+	NodeBool:         "Bool",
+	NodeNumber:       "Number",
+	NodeString:       "String",
+	NodeArray:        "Array",
+	NodeSelectorPath: "SelectorPath",
+	NodeAdd:          "Add",
+	NodeSubtract:     "Subtract",
+	NodeMultiply:     "Multiply",
+	NodeDivide:       "Divide",
+	NodeEquals:       "Equals",
+	NodeGt:           "Gt",
+	NodeGte:          "Gte",
+	NodeLt:           "Lt",
+	NodeLte:          "Lte",
+	NodeAnd:          "And",
+	NodeOr:           "Or",
+	NodeNot:          "Not",
+	NodeContains:     "Contains",
+	NodeContainsAny:  "ContainsAny",
+	NodeContainsAll:  "ContainsAll",
+	NodeIn:           "In",
+	NodeStartsWith:   "StartsWith",
+	NodeEndsWith:     "EndsWith",
+	NodeBetween:      "Between",
+	NodeCoerce:       "Coerce",
+	NodeParameter:    "Parameter",
+	NodeCall:         "Call",
+	NodeMatches:      "Matches",
+	NodeIMatches:     "IMatches",
+	NodeLike:         "Like",
+	NodeILike:        "ILike",
+	NodeGlob:         "Glob",
+	NodeIf:           "If",
+	NodeCase:         "Case",
+	NodeExists:       "Exists",
+	NodeIsNull:       "IsNull",
+	NodeIsNotNull:    "IsNotNull",
+	NodeIsMissing:    "IsMissing",
+	NodeIsNotMissing: "IsNotMissing",
+	NodeAny:          "Any",
+	NodeAll:          "All",
+	NodeNone:         "None",
+	NodeObject:       "Object",
+}
+
+func (k NodeKind) String() string {
+	if int(k) < len(nodeKindNames) && nodeKindNames[k] != "" {
+		return nodeKindNames[k]
+	}
+	return "Unknown"
+}
+
+// Node is implemented by every Expression returned from Parse and describes its structure.
+type Node interface {
+	Expression
+
+	// Kind returns the kind of node.
+	Kind() NodeKind
+
+	// Children returns the direct child expressions of the node in the order they appear in the
+	// expression, or nil for leaf nodes. BETWEEN returns its value followed by the lower and upper bounds.
+	Children() []Expression
+
+	// withChildren returns a copy of the node with its children replaced.
+	withChildren(children []Expression) (Expression, error)
+}
+
+// Literal is implemented by nodes holding a constant value; NULL, booleans, numbers, strings, bound
+// parameters and COERCE or function call nodes whose value was calculated at parse time.
+type Literal interface {
+	Node
+
+	// Value returns the constant value of the node.
+	Value() any
+}
+
+// Selector is implemented by selector path nodes and `EXISTS .path` nodes, which test for the presence of
+// the path rather than its value.
+type Selector interface {
+	Node
+
+	// Path returns the gjson selector path, without the leading `.`.
+	Path() string
+}
+
+// NamedParameter is implemented by `$name` parameter nodes. Parameters with a bound value also implement
+// Literal.
+type NamedParameter interface {
+	Node
+
+	// ParameterName returns the name of the parameter, without the leading `$`.
+	ParameterName() string
+}
+
+// Call is implemented by function call nodes eg. `len(.name)`, whose children are the arguments. Calls
+// calculated at parse time also implement Literal.
+type Call interface {
+	Node
+
+	// FunctionName returns the lowercase name of the function called.
+	FunctionName() string
+}
+
+// Object is implemented by object literals eg. `{"id": .id}`.
+type Object interface {
+	Node
+
+	// Keys returns the keys of the object in the order they appear, corresponding to its children.
+	Keys() []string
+}
+
+// Coercion is implemented by COERCE nodes, chained coercions are nested with the first applied
+// coercion being the innermost. Coercions registered outside of this package have no children, as
+// the Expression they return can't be rebuilt with another value, and are calculated as parsed.
+type Coercion interface {
+	Node
+
+	// Name returns the coercion identifier eg. `_lowercase_`.
+	Name() string
+
+	// Args returns any arguments supplied to the coercion eg. `_substr_[1:]` returns `[1, nil]`.
+	Args() []any
+}
+
+var (
+	_ Literal  = (*null)(nil)
+	_ Literal  = (*boolean)(nil)
+	_ Literal  = (*num)(nil)
+	_ Literal  = (*exactNum)(nil)
+	_ Literal  = (*str)(nil)
+	_ Literal  = (*coercedConstant)(nil)
+	_ Literal  = (*boundParameter)(nil)
+	_ Literal  = (*calledConstant)(nil)
+	_ Selector = (*selectorPath)(nil)
+	_ Selector = (*exists)(nil)
+	_ Coercion = (*coercedConstant)(nil)
+	_ Coercion = (*coerceSubstr)(nil)
+	_ Coercion = (*coerceRegex)(nil)
+	_ Coercion = (*coerceCustom)(nil)
+	_ Node     = (*between)(nil)
+	_ Node     = (*array)(nil)
+	_ Call     = (*call)(nil)
+	_ Call     = (*calledConstant)(nil)
+
+	_ NamedParameter = (*parameter)(nil)
+	_ NamedParameter = (*boundParameter)(nil)
+)
+
+// NewSelectorPath returns a selector path node for use when rewriting expressions, the path must not
+// include the leading `.`.
+func NewSelectorPath(path string) Selector {
+	return selectorPath{s: path}
+}
+
+// NewLiteral returns a literal node for use when rewriting expressions. The supported values are nil,
+// bool, float64, string and the exact numbers int64, *big.Int and *big.Rat.
+func NewLiteral(value any) (Literal, error) {
+	switch v := value.(type) {
+	case nil:
+		return null{}, nil
+	case bool:
+		return boolean{b: v}, nil
+	case float64:
+		return num{n: v}, nil
+	case int64, *big.Int, *big.Rat:
+		return exactNum{n: v}, nil
+	case string:
+		return str{s: v}, nil
+	default:
+		return nil, ErrCustom{S: fmt.Sprintf("unsupported literal value: %v", value)}
+	}
+}
+
+// KindOf returns the NodeKind of the supplied expression, returning NodeCustom for expressions
+// not implemented by this package.
+func KindOf(e Expression) NodeKind {
+	if n, ok := e.(Node); ok {
+		return n.Kind()
+	}
+	return NodeCustom
+}
+
+// ChildrenOf returns the direct children of the supplied expression, returning nil for leaf nodes
+// and expressions not implemented by this package.
+func ChildrenOf(e Expression) []Expression {
+	if n, ok := e.(Node); ok {
+		return n.Children()
+	}
+	return nil
+}
+
+// A Visitor's Visit method is invoked for each expression encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of the expression with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(e Expression) (w Visitor)
+}
+
+// Walk traverses an expression in depth-first order: It starts by calling v.Visit(e); e must not be nil.
+// If the visitor w returned by v.Visit(e) is not nil, Walk is invoked recursively with visitor w for
+// each of the non-nil children of e, followed by a call of w.Visit(nil).
+func Walk(v Visitor, e Expression) {
+	if v = v.Visit(e); v == nil {
+		return
+	}
+	for _, child := range ChildrenOf(e) {
+		if child != nil {
+			Walk(v, child)
+		}
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Expression) bool
+
+func (f inspector) Visit(e Expression) Visitor {
+	if f(e) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an expression in depth-first order: It starts by calling f(e); e must not be nil.
+// If f returns true, Inspect invokes f recursively for each of the non-nil children of e, followed by a
+// call of f(nil).
+func Inspect(e Expression, f func(Expression) bool) {
+	Walk(inspector(f), e)
+}
+
+// Rewrite traverses an expression in depth-first order, replacing each expression with the result of fn.
+// Children are rewritten before their parent so that fn always receives a node with already rewritten
+// children. Expressions not implemented by this package are passed to fn but their contents are not traversed.
+func Rewrite(e Expression, fn func(Expression) (Expression, error)) (Expression, error) {
+	if n, ok := e.(Node); ok {
+		children := n.Children()
+		if len(children) > 0 {
+			rewritten := make([]Expression, len(children))
+			var changed bool
+			for i, child := range children {
+				r, err := Rewrite(child, fn)
+				if err != nil {
+					return nil, err
+				}
+				rewritten[i] = r
+				changed = changed || !sameExpression(r, child)
+			}
+			if changed {
+				var err error
+				e, err = n.withChildren(rewritten)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return fn(e)
+}
+
+// sameExpression reports if both are the same expression, nodes holding values that can't be compared
+// eg. a parameter bound to a slice are reported as different.
+func sameExpression(a, b Expression) (same bool) {
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return a == b
+}
+
+// SelectorPaths returns the unique selector paths read by the expression in the order they first appear, which
+// excludes those within the predicates of quantifiers and filter as they are read from each element of an array.
+func SelectorPaths(e Expression) []string {
+	var paths []string
+	seen := make(map[string]struct{})
+	var inspect func(Expression) bool
+	inspect = func(e Expression) bool {
+		switch n := e.(type) {
+		case quantifier:
+			Inspect(n.array, inspect)
+			return false
+		case filterCall:
+			Inspect(n.array, inspect)
+			return false
+		case coerceCustom:
+			Inspect(n.value, inspect)
+			return false
+		case Selector:
+			if _, found := seen[n.Path()]; !found {
+				seen[n.Path()] = struct{}{}
+				paths = append(paths, n.Path())
+			}
+		}
+		return true
+	}
+	Inspect(e, inspect)
+	return paths
+}
+
+// Leaf nodes
+
+func (null) Kind() NodeKind                                    { return NodeNull }
+func (null) Children() []Expression                            { return nil }
+func (n null) withChildren(_ []Expression) (Expression, error) { return n, nil }
+func (null) Value() any                                        { return nil }
+
+func (boolean) Kind() NodeKind                                    { return NodeBool }
+func (boolean) Children() []Expression                            { return nil }
+func (b boolean) withChildren(_ []Expression) (Expression, error) { return b, nil }
+func (b boolean) Value() any                                      { return b.b }
+
+func (num) Kind() NodeKind                                    { return NodeNumber }
+func (num) Children() []Expression                            { return nil }
+func (n num) withChildren(_ []Expression) (Expression, error) { return n, nil }
+func (n num) Value() any                                      { return n.n }
+
+func (exactNum) Kind() NodeKind                                    { return NodeNumber }
+func (exactNum) Children() []Expression                            { return nil }
+func (n exactNum) withChildren(_ []Expression) (Expression, error) { return n, nil }
+func (n exactNum) Value() any                                      { return n.n }
+
+func (str) Kind() NodeKind                                    { return NodeString }
+func (str) Children() []Expression                            { return nil }
+func (s str) withChildren(_ []Expression) (Expression, error) { return s, nil }
+func (s str) Value() any                                      { return s.s }
+
+func (selectorPath) Kind() NodeKind                                    { return NodeSelectorPath }
+func (selectorPath) Children() []Expression                            { return nil }
+func (i selectorPath) withChildren(_ []Expression) (Expression, error) { return i, nil }
+func (i selectorPath) Path() string                                    { return i.s }
+
+func (parameter) Kind() NodeKind                                    { return NodeParameter }
+func (parameter) Children() []Expression                            { return nil }
+func (p parameter) withChildren(_ []Expression) (Expression, error) { return p, nil }
+func (p parameter) ParameterName() string                           { return p.name }
+
+func (boundParameter) Kind() NodeKind                                    { return NodeParameter }
+func (boundParameter) Children() []Expression                            { return nil }
+func (p boundParameter) withChildren(_ []Expression) (Expression, error) { return p, nil }
+func (p boundParameter) ParameterName() string                           { return p.name }
+func (p boundParameter) Value() any                                      { return p.value }
+
+// Composite nodes
+
+func (array) Kind() NodeKind           { return NodeArray }
+func (a array) Children() []Expression { return a.vec }
+func (a array) withChildren(children []Expression) (Expression, error) {
+	return array{vec: children}, nil
+}
+
+func (object) Kind() NodeKind           { return NodeObject }
+func (o object) Children() []Expression { return o.values }
+func (o object) Keys() []string         { return o.keys }
+func (o object) withChildren(children []Expression) (Expression, error) {
+	return object{keys: o.keys, values: children}, nil
+}
+
+func (call) Kind() NodeKind           { return NodeCall }
+func (c call) Children() []Expression { return c.args }
+func (c call) FunctionName() string   { return c.name }
+func (c call) withChildren(children []Expression) (Expression, error) {
+	return call{name: c.name, fn: c.fn, args: children}, nil
+}
+
+// filterCall is a call to the built in filter function.
+func (filterCall) Kind() NodeKind           { return NodeCall }
+func (f filterCall) Children() []Expression { return []Expression{f.array, f.predicate} }
+func (filterCall) FunctionName() string     { return filterFunction }
+func (f filterCall) withChildren(children []Expression) (Expression, error) {
+	return filterCall{array: children[0], predicate: children[1]}, nil
+}
+
+// calledConstant describes the function call it was calculated from.
+func (calledConstant) Kind() NodeKind           { return NodeCall }
+func (c calledConstant) Children() []Expression { return c.call.args }
+func (c calledConstant) FunctionName() string   { return c.call.name }
+func (c calledConstant) Value() any             { return c.value }
+func (c calledConstant) withChildren(children []Expression) (Expression, error) {
+	// the new children may no longer be constant so the calculated value can't be kept.
+	return c.call.withChildren(children)
+}
+
+func (not) Kind() NodeKind           { return NodeNot }
+func (n not) Children() []Expression { return []Expression{n.value} }
+func (n not) withChildren(children []Expression) (Expression, error) {
+	return not{value: children[0]}, nil
+}
+
+func (between) Kind() NodeKind           { return NodeBetween }
+func (b between) Children() []Expression { return []Expression{b.value, b.left, b.right} }
+func (b between) withChildren(children []Expression) (Expression, error) {
+	return between{value: children[0], left: children[1], right: children[2]}, nil
+}
+
+func (add) Kind() NodeKind           { return NodeAdd }
+func (a add) Children() []Expression { return []Expression{a.left, a.right} }
+func (a add) withChildren(children []Expression) (Expression, error) {
+	return add{left: children[0], right: children[1]}, nil
+}
+
+func (sub) Kind() NodeKind           { return NodeSubtract }
+func (s sub) Children() []Expression { return []Expression{s.left, s.right} }
+func (s sub) withChildren(children []Expression) (Expression, error) {
+	return sub{left: children[0], right: children[1]}, nil
+}
+
+func (multi) Kind() NodeKind           { return NodeMultiply }
+func (m multi) Children() []Expression { return []Expression{m.left, m.right} }
+func (m multi) withChildren(children []Expression) (Expression, error) {
+	return multi{left: children[0], right: children[1]}, nil
+}
+
+func (div) Kind() NodeKind           { return NodeDivide }
+func (d div) Children() []Expression { return []Expression{d.left, d.right} }
+func (d div) withChildren(children []Expression) (Expression, error) {
+	return div{left: children[0], right: children[1]}, nil
+}
+
+func (eq) Kind() NodeKind           { return NodeEquals }
+func (e eq) Children() []Expression { return []Expression{e.left, e.right} }
+func (e eq) withChildren(children []Expression) (Expression, error) {
+	return eq{left: children[0], right: children[1]}, nil
+}
+
+func (gt) Kind() NodeKind           { return NodeGt }
+func (g gt) Children() []Expression { return []Expression{g.left, g.right} }
+func (g gt) withChildren(children []Expression) (Expression, error) {
+	return gt{left: children[0], right: children[1]}, nil
+}
+
+func (gte) Kind() NodeKind           { return NodeGte }
+func (g gte) Children() []Expression { return []Expression{g.left, g.right} }
+func (g gte) withChildren(children []Expression) (Expression, error) {
+	return gte{left: children[0], right: children[1]}, nil
+}
+
+func (lt) Kind() NodeKind           { return NodeLt }
+func (l lt) Children() []Expression { return []Expression{l.left, l.right} }
+func (l lt) withChildren(children []Expression) (Expression, error) {
+	return lt{left: children[0], right: children[1]}, nil
+}
+
+func (lte) Kind() NodeKind           { return NodeLte }
+func (l lte) Children() []Expression { return []Expression{l.left, l.right} }
+func (l lte) withChildren(children []Expression) (Expression, error) {
+	return lte{left: children[0], right: children[1]}, nil
+}
+
+func (and) Kind() NodeKind           { return NodeAnd }
+func (a and) Children() []Expression { return []Expression{a.left, a.right} }
+func (a and) withChildren(children []Expression) (Expression, error) {
+	return and{left: children[0], right: children[1]}, nil
+}
+
+func (or) Kind() NodeKind           { return NodeOr }
+func (o or) Children() []Expression { return []Expression{o.left, o.right} }
+func (o or) withChildren(children []Expression) (Expression, error) {
+	return or{left: children[0], right: children[1]}, nil
+}
+
+func (contains) Kind() NodeKind           { return NodeContains }
+func (c contains) Children() []Expression { return []Expression{c.left, c.right} }
+func (c contains) withChildren(children []Expression) (Expression, error) {
+	return contains{left: children[0], right: children[1]}, nil
+}
+
+func (containsAny) Kind() NodeKind           { return NodeContainsAny }
+func (c containsAny) Children() []Expression { return []Expression{c.left, c.right} }
+func (c containsAny) withChildren(children []Expression) (Expression, error) {
+	return containsAny{left: children[0], right: children[1]}, nil
+}
+
+func (containsAll) Kind() NodeKind           { return NodeContainsAll }
+func (c containsAll) Children() []Expression { return []Expression{c.left, c.right} }
+func (c containsAll) withChildren(children []Expression) (Expression, error) {
+	return containsAll{left: children[0], right: children[1]}, nil
+}
+
+func (in) Kind() NodeKind           { return NodeIn }
+func (i in) Children() []Expression { return []Expression{i.left, i.right} }
+func (i in) withChildren(children []Expression) (Expression, error) {
+	return in{left: children[0], right: children[1]}, nil
+}
+
+func (startsWith) Kind() NodeKind           { return NodeStartsWith }
+func (s startsWith) Children() []Expression { return []Expression{s.left, s.right} }
+func (s startsWith) withChildren(children []Expression) (Expression, error) {
+	return startsWith{left: children[0], right: children[1]}, nil
+}
+
+func (endsWith) Kind() NodeKind           { return NodeEndsWith }
+func (e endsWith) Children() []Expression { return []Expression{e.left, e.right} }
+func (e endsWith) withChildren(children []Expression) (Expression, error) {
+	return endsWith{left: children[0], right: children[1]}, nil
+}
+
+func (m matches) Kind() NodeKind {
+	if m.insensitive {
+		return NodeIMatches
+	}
+	return NodeMatches
+}
+func (m matches) Children() []Expression { return []Expression{m.left, m.right} }
+func (m matches) withChildren(children []Expression) (Expression, error) {
+	return newMatches(children[0], children[1], m.insensitive)
+}
+
+func (l like) Kind() NodeKind         { return l.kind }
+func (l like) Children() []Expression { return []Expression{l.left, l.right} }
+func (l like) withChildren(children []Expression) (Expression, error) {
+	return newLike(children[0], children[1], l.kind, l.escape)
+}
+
+func (exists) Kind() NodeKind                                    { return NodeExists }
+func (exists) Children() []Expression                            { return nil }
+func (e exists) Path() string                                    { return e.path }
+func (e exists) withChildren(_ []Expression) (Expression, error) { return e, nil }
+
+func (c isCheck) Kind() NodeKind         { return c.kind }
+func (c isCheck) Children() []Expression { return []Expression{c.value} }
+func (c isCheck) withChildren(children []Expression) (Expression, error) {
+	return isCheck{value: children[0], kind: c.kind}, nil
+}
+
+// quantifier returns the array followed by the predicate.
+func (q quantifier) Kind() NodeKind         { return q.kind }
+func (q quantifier) Children() []Expression { return []Expression{q.array, q.predicate} }
+func (q quantifier) withChildren(children []Expression) (Expression, error) {
+	return quantifier{kind: q.kind, array: children[0], predicate: children[1]}, nil
+}
+
+// conditional returns the conditions and values in the order they appear followed by the ELSE value if
+// present.
+func (c conditional) Kind() NodeKind { return c.kind }
+func (c conditional) Children() []Expression {
+	children := make([]Expression, 0, len(c.whens)+1)
+	children = append(children, c.whens...)
+	if c.otherwise != nil {
+		children = append(children, c.otherwise)
+	}
+	return children
+}
+func (c conditional) withChildren(children []Expression) (Expression, error) {
+	whens := make([]Expression, len(c.whens))
+	copy(whens, children)
+	result := conditional{kind: c.kind, whens: whens}
+	if c.otherwise != nil {
+		result.otherwise = children[len(whens)]
+	}
+	return result, nil
+}
+
+// COERCE nodes
+
+func (coerceDuration) Kind() NodeKind           { return NodeCoerce }
+func (c coerceDuration) Children() []Expression { return []Expression{c.value} }
+func (coerceDuration) Name() string             { return "_duration_" }
+func (coerceDuration) Args() []any              { return nil }
+func (c coerceDuration) withChildren(children []Expression) (Expression, error) {
+	return coerceDuration{value: children[0]}, nil
+}
+
+func (coerceDateTime) Kind() NodeKind           { return NodeCoerce }
+func (c coerceDateTime) Children() []Expression { return []Expression{c.value} }
+func (c coerceDateTime) Name() string {
+	if c.strict {
+		return "_datetime_strict_"
+	}
+	return "_datetime_"
+}
+
+// Args returns the layout and location, if supplied.
+func (c coerceDateTime) Args() []any {
+	switch {
+	case c.zone != "":
+		return []any{c.layout, c.zone}
+	case c.layout != "":
+		return []any{c.layout}
+	default:
+		return nil
+	}
+}
+
+func (c coerceDateTime) withChildren(children []Expression) (Expression, error) {
+	c.value = children[0]
+	return c, nil
+}
+
+func (coerceLowercase) Kind() NodeKind           { return NodeCoerce }
+func (c coerceLowercase) Children() []Expression { return []Expression{c.value} }
+func (coerceLowercase) Name() string             { return "_lowercase_" }
+func (coerceLowercase) Args() []any              { return nil }
+func (c coerceLowercase) withChildren(children []Expression) (Expression, error) {
+	return coerceLowercase{value: children[0]}, nil
+}
+
+func (coerceUppercase) Kind() NodeKind           { return NodeCoerce }
+func (c coerceUppercase) Children() []Expression { return []Expression{c.value} }
+func (coerceUppercase) Name() string             { return "_uppercase_" }
+func (coerceUppercase) Args() []any              { return nil }
+func (c coerceUppercase) withChildren(children []Expression) (Expression, error) {
+	return coerceUppercase{value: children[0]}, nil
+}
+
+func (coerceTitle) Kind() NodeKind           { return NodeCoerce }
+func (c coerceTitle) Children() []Expression { return []Expression{c.value} }
+func (coerceTitle) Name() string             { return "_title_" }
+func (coerceTitle) Args() []any              { return nil }
+func (c coerceTitle) withChildren(children []Expression) (Expression, error) {
+	return coerceTitle{value: children[0]}, nil
+}
+
+func (coerceString) Kind() NodeKind           { return NodeCoerce }
+func (c coerceString) Children() []Expression { return []Expression{c.value} }
+func (coerceString) Name() string             { return "_string_" }
+func (coerceString) Args() []any              { return nil }
+func (c coerceString) withChildren(children []Expression) (Expression, error) {
+	return coerceString{value: children[0]}, nil
+}
+
+func (coerceInt) Kind() NodeKind           { return NodeCoerce }
+func (c coerceInt) Children() []Expression { return []Expression{c.value} }
+func (coerceInt) Name() string             { return "_int_" }
+func (coerceInt) Args() []any              { return nil }
+func (c coerceInt) withChildren(children []Expression) (Expression, error) {
+	return coerceInt{value: children[0]}, nil
+}
+
+func (coerceDecimal) Kind() NodeKind           { return NodeCoerce }
+func (c coerceDecimal) Children() []Expression { return []Expression{c.value} }
+func (coerceDecimal) Name() string             { return "_decimal_" }
+func (coerceDecimal) Args() []any              { return nil }
+func (c coerceDecimal) withChildren(children []Expression) (Expression, error) {
+	return coerceDecimal{value: children[0]}, nil
+}
+
+func (coerceNumber) Kind() NodeKind           { return NodeCoerce }
+func (c coerceNumber) Children() []Expression { return []Expression{c.value} }
+func (coerceNumber) Name() string             { return "_number_" }
+func (coerceNumber) Args() []any              { return nil }
+func (c coerceNumber) withChildren(children []Expression) (Expression, error) {
+	return coerceNumber{value: children[0]}, nil
+}
+
+func (coerceSubstr) Kind() NodeKind           { return NodeCoerce }
+func (c coerceSubstr) Children() []Expression { return []Expression{c.value} }
+func (coerceSubstr) Name() string             { return "_substr_" }
+func (c coerceSubstr) Args() []any {
+	args := make([]any, 2)
+	if c.start.IsSome() {
+		args[0] = c.start.Unwrap()
+	}
+	if c.end.IsSome() {
+		args[1] = c.end.Unwrap()
+	}
+	return args
+}
+func (c coerceSubstr) withChildren(children []Expression) (Expression, error) {
+	return coerceSubstr{value: children[0], start: c.start, end: c.end}, nil
+}
+
+func (coerceRegex) Kind() NodeKind           { return NodeCoerce }
+func (c coerceRegex) Children() []Expression { return []Expression{c.value} }
+func (coerceRegex) Name() string             { return "_regex_" }
+func (c coerceRegex) Args() []any            { return []any{c.pattern, c.group} }
+func (c coerceRegex) withChildren(children []Expression) (Expression, error) {
+	return coerceRegex{value: children[0], pattern: c.pattern, re: c.re, group: c.group, index: c.index}, nil
+}
+
+// coercedConstant describes the COERCE expression it was calculated from.
+func (coercedConstant) Kind() NodeKind           { return NodeCoerce }
+func (c coercedConstant) Children() []Expression { return c.expression.Children() }
+func (c coercedConstant) Name() string           { return c.expression.Name() }
+func (c coercedConstant) Args() []any            { return c.expression.Args() }
+func (c coercedConstant) Value() any             { return c.value }
+func (c coercedConstant) withChildren(children []Expression) (Expression, error) {
+	// the new children may no longer be constant so the calculated value can't be kept.
+	return c.expression.withChildren(children)
+}
+
+func (coerceCustom) Kind() NodeKind                                    { return NodeCoerce }
+func (coerceCustom) Children() []Expression                            { return nil }
+func (c coerceCustom) Name() string                                    { return c.name }
+func (coerceCustom) Args() []any                                       { return nil }
+func (c coerceCustom) withChildren(_ []Expression) (Expression, error) { return c, nil }
@@ -0,0 +1,184 @@
+package ksql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name  string
+		exp   string
+		kinds []NodeKind
+	}{
+		{
+			name:  "arithmetic",
+			exp:   `.a + 1 * 2`,
+			kinds: []NodeKind{NodeAdd, NodeSelectorPath, NodeMultiply, NodeNumber, NodeNumber},
+		},
+		{
+			name:  "logical",
+			exp:   `.a == "x" && !.b || NULL == true`,
+			kinds: []NodeKind{NodeOr, NodeAnd, NodeEquals, NodeSelectorPath, NodeString, NodeNot, NodeSelectorPath, NodeEquals, NodeNull, NodeBool},
+		},
+		{
+			name:  "between value first",
+			exp:   `.a BETWEEN 1 .b`,
+			kinds: []NodeKind{NodeBetween, NodeSelectorPath, NodeNumber, NodeSelectorPath},
+		},
+		{
+			name:  "array",
+			exp:   `.a IN [1, .b]`,
+			kinds: []NodeKind{NodeIn, NodeSelectorPath, NodeArray, NodeNumber, NodeSelectorPath},
+		},
+		{
+			name:  "coerce chain",
+			exp:   `COERCE .a _lowercase_,_substr_[1:]`,
+			kinds: []NodeKind{NodeCoerce, NodeCoerce, NodeSelectorPath},
+		},
+		{
+			name:  "coerce constant",
+			exp:   `COERCE "A" _lowercase_`,
+			kinds: []NodeKind{NodeCoerce, NodeString},
+		},
+		{
+			name:  "negated operation",
+			exp:   `.a !CONTAINS_ANY ["x"]`,
+			kinds: []NodeKind{NodeNot, NodeContainsAny, NodeSelectorPath, NodeArray, NodeString},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			var kinds []NodeKind
+			Inspect(ex, func(e Expression) bool {
+				if e != nil {
+					kinds = append(kinds, KindOf(e))
+				}
+				return true
+			})
+			assert.Equal(tc.kinds, kinds)
+		})
+	}
+}
+
+func TestNodeDetails(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`COERCE .name _substr_[2:] == COERCE "ABC" _lowercase_`))
+	assert.NoError(err)
+
+	children := ChildrenOf(ex)
+	assert.Len(children, 2)
+
+	substr, ok := children[0].(Coercion)
+	assert.True(ok)
+	assert.Equal("_substr_", substr.Name())
+	assert.Equal([]any{2, nil}, substr.Args())
+	assert.Equal("name", substr.Children()[0].(Selector).Path())
+
+	lowercase, ok := children[1].(Coercion)
+	assert.True(ok)
+	assert.Equal("_lowercase_", lowercase.Name())
+	assert.Equal("ABC", lowercase.Children()[0].(Literal).Value())
+
+	folded, ok := children[1].(Literal)
+	assert.True(ok)
+	assert.Equal("abc", folded.Value())
+}
+
+func TestWalkCustomCoercion(t *testing.T) {
+	assert := require.New(t)
+
+	env := NewEnvironment()
+	env.SetCoercion("_walkstar_", func(_ *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
+		return false, &Star{expression}, nil
+	})
+
+	ex, err := ParseWith(env, []byte(`COERCE .name _walkstar_`))
+	assert.NoError(err)
+	assert.Equal(NodeCoerce, KindOf(ex))
+	assert.Equal("_walkstar_", ex.(Coercion).Name())
+	assert.Equal([]string{"name"}, SelectorPaths(ex))
+
+	result, err := ex.Calculate([]byte(`{"name":"abc"}`))
+	assert.NoError(err)
+	assert.Equal("***", result)
+}
+
+func TestRewriteCustomCoercion(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := ParseWith(repEnvironment(), []byte(`COERCE .name _lowercase_,_rep_[2] == "abab" && .name != ""`))
+	assert.NoError(err)
+
+	// the value of a custom coercion isn't one of its children so is calculated as parsed.
+	rewritten, err := Rewrite(ex, func(e Expression) (Expression, error) {
+		if s, ok := e.(Selector); ok && s.Path() == "name" {
+			return NewSelectorPath("first"), nil
+		}
+		return e, nil
+	})
+	assert.NoError(err)
+	assert.Equal(`COERCE .name _lowercase_,_rep_[2] == "abab" && .first != ""`, Format(rewritten))
+	assert.Equal([]string{"name", "first"}, SelectorPaths(rewritten))
+
+	result, err := rewritten.Calculate([]byte(`{"name":"AB","first":"x"}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
+
+func TestSelectorPaths(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`.a + .b.c > .a && COERCE .d _string_ IN ["x", .e]`))
+	assert.NoError(err)
+	assert.Equal([]string{"a", "b.c", "d", "e"}, SelectorPaths(ex))
+
+	ex, err = Parse([]byte(`ANY .items (.qty > 10 && . != .a) && count(filter(.tags, . == .b)) > .c`))
+	assert.NoError(err)
+	assert.Equal([]string{"items", "tags", "c"}, SelectorPaths(ex))
+}
+
+func TestRewrite(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`.old + 1 == 3 && COERCE .old _string_ == "2"`))
+	assert.NoError(err)
+
+	rewritten, err := Rewrite(ex, func(e Expression) (Expression, error) {
+		if s, ok := e.(Selector); ok && s.Path() == "old" {
+			return NewSelectorPath("new"), nil
+		}
+		return e, nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"new"}, SelectorPaths(rewritten))
+	assert.Equal([]string{"old"}, SelectorPaths(ex))
+
+	result, err := rewritten.Calculate([]byte(`{"new":2}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
+
+func TestNewLiteral(t *testing.T) {
+	assert := require.New(t)
+
+	for _, v := range []any{nil, true, 1.5, "s"} {
+		l, err := NewLiteral(v)
+		assert.NoError(err)
+		assert.Equal(v, l.Value())
+	}
+
+	_, err := NewLiteral(1)
+	assert.Error(err)
+}
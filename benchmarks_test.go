@@ -1,6 +1,9 @@
 package ksql
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -136,6 +139,213 @@ func BenchmarkExecutionCoerceDateTimeSelectorConstant(b *testing.B) {
 	benchExecution(b, `COERCE "2022-01-02" _datetime_ == COERCE "2022-01-02" _datetime_`, ``)
 }
 
+func BenchmarkExecutionRule(b *testing.B) {
+	benchExecution(b, `.age >= 18 && .country == "NZ" || IF .vip THEN .score * 2 > 100 ELSE .score > 100`, `{"age":30,"country":"AU","vip":true,"score":75.5}`)
+}
+
+func BenchmarkCompiledExecutionNumPlusNum(b *testing.B) {
+	benchCompiledExecution(b, "1 + 1 + 1 + 1 + 1", ``)
+}
+
+func BenchmarkCompiledExecutionIdentNum(b *testing.B) {
+	benchCompiledExecution(b, ".field1 + 1", `{"field1":1}`)
+}
+
+func BenchmarkCompiledExecutionIdentIdent(b *testing.B) {
+	benchCompiledExecution(b, ".field1 + .field2", `{"field1":1,"field2":1}`)
+}
+
+func BenchmarkCompiledExecutionFNameLName(b *testing.B) {
+	benchCompiledExecution(b, `.first_name + " " + .last_name`, `{"first_name":"Joey","last_name":"Bloggs"}`)
+}
+
+func BenchmarkCompiledExecutionParenDiv(b *testing.B) {
+	benchCompiledExecution(b, `(1 + 1) / 2`, ``)
+}
+
+func BenchmarkCompiledExecutionParenDivIdents(b *testing.B) {
+	benchCompiledExecution(b, `(.field1 + .field2) / .field3`, `{"field1":1,"field2":1,"field3":2}`)
+}
+
+func BenchmarkCompiledExecutionCompanyEmployees(b *testing.B) {
+	benchCompiledExecution(b, `.properties.employees > 20`, `{"name":"Company","properties":{"employees":50}}`)
+}
+
+func BenchmarkCompiledExecutionParenNot(b *testing.B) {
+	benchCompiledExecution(b, `!(.f1 != .f2)`, `{"f1":true,"f2":false}`)
+}
+
+func BenchmarkCompiledExecutionCoerceDateTimeSelector(b *testing.B) {
+	benchCompiledExecution(b, `COERCE .dt1 _datetime_ == COERCE .dt2 _datetime_`, `{"dt1":"2022-01-02","dt2":"2022-01-02"}`)
+}
+
+func BenchmarkCompiledExecutionCoerceDateTimeSelectorMixed(b *testing.B) {
+	benchCompiledExecution(b, `COERCE .dt1 _datetime_ == COERCE "2022-01-02" _datetime_`, `{"dt1":"2022-01-02"}`)
+}
+
+func BenchmarkCompiledExecutionCoerceDateTimeSelectorConstant(b *testing.B) {
+	benchCompiledExecution(b, `COERCE "2022-01-02" _datetime_ == COERCE "2022-01-02" _datetime_`, ``)
+}
+
+func BenchmarkCompiledExecutionRule(b *testing.B) {
+	benchCompiledExecution(b, `.age >= 18 && .country == "NZ" || IF .vip THEN .score * 2 > 100 ELSE .score > 100`, `{"age":30,"country":"AU","vip":true,"score":75.5}`)
+}
+
+func BenchmarkRuleSet(b *testing.B) {
+	rules, input := benchRules(b)
+	rs := NewRuleSet(rules...)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, result := range rs.Calculate(input) {
+			if result.Err != nil {
+				b.Fatal(result.Err)
+			}
+		}
+	}
+}
+
+func BenchmarkRuleSetIndividually(b *testing.B) {
+	rules, input := benchRules(b)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, rule := range rules {
+			_, err := rule.Calculate(input)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// benchRules returns 100 rules over 50 fields of a document.
+func benchRules(b *testing.B) ([]Expression, []byte) {
+	var sb strings.Builder
+	sb.WriteString(`{"padding":"` + strings.Repeat("x", 1024) + `"`)
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&sb, `,"field%d":{"num":%d,"name":"name%d"}`, i, i, i)
+	}
+	sb.WriteString("}")
+
+	var rules []Expression
+	for i := 0; i < 50; i++ {
+		for _, exp := range []string{
+			fmt.Sprintf(`.field%d.num > %d`, i, i/2),
+			fmt.Sprintf(`.field%d.name == "name%d" && .field%d.num < 25`, i, i, (i+1)%50),
+		} {
+			ex, err := Parse([]byte(exp))
+			if err != nil {
+				b.Fatal(err)
+			}
+			rules = append(rules, ex)
+		}
+	}
+	return rules, []byte(sb.String())
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	rules, input := benchMatcherRules(b)
+	m := NewMatcher(rules...)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if len(m.Match(input)) == 0 {
+			b.Fatal("expected a match")
+		}
+	}
+}
+
+func BenchmarkMatcherNaive(b *testing.B) {
+	rules, input := benchMatcherRules(b)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var matched []RuleID
+		for _, rule := range rules {
+			result, err := rule.Expression.Calculate(input)
+			if b, ok := result.(bool); ok && b && err == nil {
+				matched = append(matched, rule.ID)
+			}
+		}
+		if len(matched) == 0 {
+			b.Fatal("expected a match")
+		}
+	}
+}
+
+// benchMatcherRules returns 10,000 rules over events of 1,000 types.
+func benchMatcherRules(b *testing.B) ([]Rule, []byte) {
+	var rules []Rule
+	for i := 0; i < 10000; i++ {
+		var exp string
+		switch i % 4 {
+		case 0:
+			exp = fmt.Sprintf(`.type == "type%d" && .severity > %d`, i%1000, i%10)
+		case 1:
+			exp = fmt.Sprintf(`.source IN ["source%d", "source%d"] && .type == "type%d"`, i, i+1, i%1000)
+		case 2:
+			exp = fmt.Sprintf(`.severity >= %d && .user.name STARTSWITH "user%d"`, i/10, i%100)
+		default:
+			exp = fmt.Sprintf(`.user.id == %d`, i)
+		}
+		ex, err := Parse([]byte(exp))
+		if err != nil {
+			b.Fatal(err)
+		}
+		rules = append(rules, Rule{ID: RuleID(fmt.Sprint(i)), Expression: ex})
+	}
+	return rules, []byte(`{"type":"type4","source":"source8","severity":95,"user":{"id":3,"name":"user42"}}`)
+}
+
+func BenchmarkCalculateValueStruct(b *testing.B) {
+	ex, value := benchStruct(b)
+
+	for i := 0; i < b.N; i++ {
+		_, err := CalculateValue(ex, value)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCalculateValueStructMarshalled(b *testing.B) {
+	ex, value := benchStruct(b)
+
+	for i := 0; i < b.N; i++ {
+		src, err := json.Marshal(value)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = ex.Calculate(src)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type benchCompany struct {
+	Name       string              `json:"name"`
+	Properties map[string]any      `json:"properties"`
+	Employees  []map[string]string `json:"employees"`
+}
+
+func benchStruct(b *testing.B) (Expression, *benchCompany) {
+	ex, err := Parse([]byte(`.properties.employees > 20 && .name == "Company"`))
+	if err != nil {
+		b.Fatal(err)
+	}
+	value := &benchCompany{Name: "Company", Properties: map[string]any{"employees": 50}}
+	for i := 0; i < 50; i++ {
+		value.Employees = append(value.Employees, map[string]string{"name": fmt.Sprint("employee", i)})
+	}
+	return ex, value
+}
+
 func benchExecution(b *testing.B, expression, input string) {
 	ex, err := Parse([]byte(expression))
 	if err != nil {
@@ -152,6 +362,23 @@ func benchExecution(b *testing.B, expression, input string) {
 	}
 }
 
+func benchCompiledExecution(b *testing.B, expression, input string) {
+	ex, err := Parse([]byte(expression))
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := Compile(ex)
+	in := []byte(input)
+	b.SetBytes(int64(len(in)))
+
+	for i := 0; i < b.N; i++ {
+		_, err := c.Calculate(in)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func benchParsing(b *testing.B, expression string) {
 	b.SetBytes(int64(len(expression)))
 
@@ -0,0 +1,664 @@
+package ksql
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Check infers the type of the expression and each of its nodes from a JSON Schema describing the data it will
+// be calculated against, returning an error for any part of the expression that can never be calculated
+// successfully, so invalid expressions can be rejected before being calculated against any data. The errors
+// returned are:
+//
+//   - ErrUnknownField for a selector path not declared by the schema, unless the object is not constrained
+//     by `properties` or `additionalProperties`.
+//   - ErrUnsupportedTypeComparison for an operation whose values can never be of types it supports
+//     eg. `.name > 5` where `.name` is a string, or `.tags STARTSWITH "x"` where `.tags` is an array.
+//   - ErrUnsupportedCoerce for a COERCE whose value can never be of a type it supports.
+//   - ErrFunctionArgument for a function argument that can never be of a type the function accepts, whose
+//     Value is the ArgType of the argument.
+//
+// An operation is only an error when none of the types its values may be are supported, so an operation that
+// fails only for some values eg. a selector path that may be NULL or a string that may not be a valid number
+// is not an error. Properties not listed as `required` by the schema may be missing, so may be NULL.
+//
+// Selector paths are resolved through `properties`, `patternProperties`, `additionalProperties`, `items`,
+// `prefixItems`, local `$ref`s and `allOf`, `anyOf` and `oneOf`. Paths using gjson features other than
+// object keys, array indexes, `#` and `@this`, custom coercions, unbound parameters and expressions not
+// implemented by this package are of any type, ArgAny.
+func Check(e Expression, schema []byte) (ArgType, error) {
+	var root any
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return 0, err
+	}
+	c := checker{root: root}
+	result, err := c.check(e, root)
+	if err != nil {
+		return 0, err
+	}
+	return result.t, nil
+}
+
+// checked is the type inferred for an expression.
+type checked struct {
+	t ArgType
+
+	// schema is the JSON Schema of the value, if known, used to check the predicates of quantifiers and filter
+	// against the elements of an array.
+	schema any
+
+	// value is the value of a literal, used in place of samples of its type.
+	value    any
+	constant bool
+}
+
+var anyType = checked{t: ArgAny}
+
+type checker struct {
+	root any
+}
+
+// check returns the type of the expression whose selector paths are resolved using the schema.
+func (c checker) check(e Expression, schema any) (checked, error) {
+	switch n := e.(type) {
+	case *Compiled:
+		return c.check(n.source, schema)
+
+	case Literal:
+		return checked{t: typeOfValue(n.Value()), value: n.Value(), constant: true}, nil
+
+	case selectorPath:
+		return c.path(n.s, schema)
+
+	case exists:
+		if _, err := c.path(n.path, schema); err != nil {
+			return checked{}, err
+		}
+		return checked{t: ArgBool}, nil
+
+	case parameter:
+		return anyType, nil
+
+	case coerceCustom:
+		// the types a custom coercion supports and returns are unknown.
+		if _, err := c.check(n.value, schema); err != nil {
+			return checked{}, err
+		}
+		return anyType, nil
+
+	case quantifier:
+		arr, err := c.check(n.array, schema)
+		if err != nil {
+			return checked{}, err
+		}
+		if arr.t&(ArgArray|ArgNull) == 0 {
+			return checked{}, ErrUnsupportedTypeComparison{s: Format(e)}
+		}
+		if _, err := c.check(n.predicate, c.elements(arr.schema)); err != nil {
+			return checked{}, err
+		}
+		return checked{t: ArgBool}, nil
+
+	case filterCall:
+		arr, err := c.check(n.array, schema)
+		if err != nil {
+			return checked{}, err
+		}
+		if arr.t&(ArgArray|ArgNull) == 0 {
+			return checked{}, ErrFunctionArgument{Function: filterFunction, Index: 0, Expected: ArgArray, Value: arr.t}
+		}
+		if _, err := c.check(n.predicate, c.elements(arr.schema)); err != nil {
+			return checked{}, err
+		}
+		return checked{t: ArgArray | ArgNull, schema: arr.schema}, nil
+
+	case conditional:
+		var t ArgType
+		for i, when := range n.whens {
+			result, err := c.check(when, schema)
+			if err != nil {
+				return checked{}, err
+			}
+			if i%2 == 1 {
+				t |= result.t
+			}
+		}
+		if n.otherwise == nil {
+			t |= ArgNull
+		} else {
+			result, err := c.check(n.otherwise, schema)
+			if err != nil {
+				return checked{}, err
+			}
+			t |= result.t
+		}
+		return checked{t: t}, nil
+
+	case array:
+		for _, element := range n.vec {
+			if _, err := c.check(element, schema); err != nil {
+				return checked{}, err
+			}
+		}
+		return checked{t: ArgArray}, nil
+
+	case object:
+		for _, value := range n.values {
+			if _, err := c.check(value, schema); err != nil {
+				return checked{}, err
+			}
+		}
+		return checked{t: ArgObject}, nil
+	}
+
+	node, ok := e.(Node)
+	if !ok {
+		return anyType, nil
+	}
+	children := node.Children()
+	args := make([]checked, len(children))
+	for i, child := range children {
+		result, err := c.check(child, schema)
+		if err != nil {
+			return checked{}, err
+		}
+		args[i] = result
+	}
+
+	if call, ok := e.(call); ok {
+		for i, arg := range args {
+			// a NULL argument not accepted by the function results in NULL rather than an error, but as with
+			// operations an argument that may also be of other types must be accepted when it isn't NULL.
+			argType := arg.t
+			if argType != ArgNull {
+				argType &^= ArgNull
+			}
+			if t := call.fn.argType(i); argType&t == 0 && argType != ArgNull {
+				return checked{}, ErrFunctionArgument{Function: call.name, Index: i, Expected: t, Value: arg.t}
+			}
+		}
+		if !call.fn.Pure {
+			// the function may have side effects so is not called with samples of its arguments.
+			return anyType, nil
+		}
+	}
+
+	t, ok := calculateSamples(node, args)
+	if ok {
+		return checked{t: t}, nil
+	}
+	for _, arg := range args {
+		if arg.t == ArgAny {
+			// any type includes those returned by custom coercions, which may be supported.
+			return anyType, nil
+		}
+	}
+	switch e.(type) {
+	case call:
+		// a pure function may return an error for the samples of its arguments rather than their types.
+		return anyType, nil
+	case Coercion:
+		return checked{}, ErrUnsupportedCoerce{s: Format(e)}
+	default:
+		return checked{}, ErrUnsupportedTypeComparison{s: Format(e)}
+	}
+}
+
+// maxSamples is the maximum number of combinations of sample values calculated for a single node, beyond
+// which its type is not inferred.
+const maxSamples = 4096
+
+// calculateSamples calculates the node using every combination of samples of the types of its children,
+// returning the types of the results or false if none could be calculated. A combination in which a child that
+// may be NULL or of other types is NULL is not enough for the node to be calculated, as an operation eg.
+// `.name > 5` failing for every value of `.name` other than NULL will never succeed for a value present.
+func calculateSamples(node Node, args []checked) (ArgType, bool) {
+	samples := make([][]any, len(args))
+	combinations := 1
+	for i, arg := range args {
+		if arg.constant {
+			samples[i] = []any{arg.value}
+		} else {
+			samples[i] = samplesOf(arg.t)
+		}
+		if combinations *= len(samples[i]); combinations > maxSamples {
+			return ArgAny, true
+		}
+	}
+
+	var t ArgType
+	var calculated bool
+	children := make([]Expression, len(args))
+	indexes := make([]int, len(args))
+	for {
+		for i, index := range indexes {
+			children[i] = sample{value: samples[i][index]}
+		}
+		if e, err := node.withChildren(children); err == nil {
+			if result, err := e.Calculate(nil); err == nil {
+				t |= typeOfValue(result)
+				calculated = calculated || !nulled(args, children)
+			}
+		}
+
+		// advance to the next combination of samples.
+		i := len(indexes) - 1
+		for ; i >= 0; i-- {
+			if indexes[i]++; indexes[i] < len(samples[i]) {
+				break
+			}
+			indexes[i] = 0
+		}
+		if i < 0 {
+			return t, calculated
+		}
+	}
+}
+
+// nulled returns if any of the children that may be NULL or of other types is a NULL sample.
+func nulled(args []checked, children []Expression) bool {
+	for i, arg := range args {
+		if arg.t != ArgNull && arg.t&ArgNull != 0 && children[i].(sample).value == nil {
+			return true
+		}
+	}
+	return false
+}
+
+var _ Expression = (*sample)(nil)
+
+// sample is a value standing in for any value of its type when checking an expression.
+type sample struct {
+	value any
+}
+
+func (s sample) Calculate(_ []byte) (any, error) {
+	return s.value, nil
+}
+
+// samples are the values standing in for each type, including strings that can be coerced to numbers,
+// DateTimes and Durations.
+var samples = []struct {
+	t      ArgType
+	values []any
+}{
+	{ArgNull, []any{nil}},
+	{ArgBool, []any{true, false}},
+	{ArgNumber, []any{1.0, int64(1)}},
+	{ArgString, []any{"a", "1", "2022-01-02T03:04:05Z", "1h"}},
+	{ArgArray, []any{[]any{}}},
+	{ArgObject, []any{map[string]any{}}},
+	{ArgDateTime, []any{time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)}},
+	{ArgDuration, []any{time.Hour}},
+}
+
+func samplesOf(t ArgType) []any {
+	var values []any
+	for _, s := range samples {
+		if t&s.t != 0 {
+			values = append(values, s.values...)
+		}
+	}
+	return values
+}
+
+// typeOfValue returns the ArgType of a calculated value, ArgAny for a type not produced by this package.
+func typeOfValue(value any) ArgType {
+	if t := argTypeOf(value); t != 0 {
+		return t
+	}
+	return ArgAny
+}
+
+// path returns the type of the selector path within the schema.
+func (c checker) path(path string, schema any) (checked, error) {
+	segments, ok := pathSegments(path)
+	if !ok || schema == nil {
+		return anyType, nil
+	}
+
+	var optional bool
+	for i, segment := range segments {
+		if segment == "#" {
+			if i == len(segments)-1 {
+				// the number of elements, NULL when not an array.
+				t := ArgNumber
+				if c.typeOf(schema) != ArgArray || optional {
+					t |= ArgNull
+				}
+				return checked{t: t}, nil
+			}
+			// the values of the remaining path within each element.
+			elements, err := c.path(strings.Join(segments[i+1:], "."), c.elements(schema))
+			if err != nil {
+				return checked{}, ErrUnknownField{Path: "." + path}
+			}
+			return checked{t: ArgArray | ArgNull, schema: map[string]any{"type": "array", "items": elements.schema}}, nil
+		}
+
+		child, required, known, err := c.child(schema, segment)
+		if err != nil {
+			return checked{}, ErrUnknownField{Path: "." + path}
+		}
+		if !known {
+			return anyType, nil
+		}
+		optional = optional || !required
+		schema = child
+	}
+
+	t := c.typeOf(schema)
+	if optional {
+		t |= ArgNull
+	}
+	return checked{t: t, schema: schema}, nil
+}
+
+// pathSegments splits a selector path into its object keys and array indexes, returning false if it uses
+// other gjson features.
+func pathSegments(path string) ([]string, bool) {
+	if path == "@this" {
+		return nil, true
+	}
+	var segments []string
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch b := path[i]; b {
+		case '\\':
+			if i++; i < len(path) {
+				sb.WriteByte(path[i])
+			}
+		case '.':
+			segments = append(segments, sb.String())
+			sb.Reset()
+		case '*', '?', '|', '@', '!', '=', '<', '>', '%', '(', ')', '[', ']', '{', '}':
+			return nil, false
+		default:
+			sb.WriteByte(b)
+		}
+	}
+	segments = append(segments, sb.String())
+	for _, segment := range segments {
+		if segment == "" || (segment != "#" && strings.Contains(segment, "#")) {
+			return nil, false
+		}
+	}
+	return segments, true
+}
+
+// maxSchemaDepth is the maximum depth of `$ref`s and `allOf`, `anyOf` and `oneOf` followed, beyond which a
+// schema is assumed to be recursive.
+const maxSchemaDepth = 32
+
+// candidates returns the schemas the value must or may match, following `$ref`s and the schemas of `allOf`,
+// `anyOf` and `oneOf`.
+func (c checker) candidates(schema any) []map[string]any {
+	var result []map[string]any
+	var add func(s any, depth int)
+	add = func(s any, depth int) {
+		obj, ok := s.(map[string]any)
+		if !ok || depth > maxSchemaDepth {
+			if b, isBool := s.(bool); isBool && b {
+				result = append(result, map[string]any{})
+			}
+			return
+		}
+		if ref, ok := obj["$ref"].(string); ok {
+			add(c.ref(ref), depth+1)
+		}
+		result = append(result, obj)
+		for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+			if schemas, ok := obj[key].([]any); ok {
+				for _, s := range schemas {
+					add(s, depth+1)
+				}
+			}
+		}
+	}
+	add(schema, 0)
+	return result
+}
+
+// ref returns the schema of a local `$ref` eg. `#/$defs/address`, or nil if not found.
+func (c checker) ref(ref string) any {
+	if !strings.HasPrefix(ref, "#") {
+		return nil
+	}
+	s := c.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch v := s.(type) {
+		case map[string]any:
+			s = v[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			s = v[i]
+		default:
+			return nil
+		}
+	}
+	return s
+}
+
+// constrained returns if the schema constrains the keys of an object, or the indexes of an array when isIndex,
+// so a key or index it doesn't declare can't be present. Schemas combining others using `$ref`, `allOf`,
+// `anyOf` or `oneOf` are constrained by those schemas.
+func constrained(s map[string]any, isIndex bool) bool {
+	for _, key := range []string{"$ref", "allOf", "anyOf", "oneOf", "properties", "patternProperties"} {
+		if _, ok := s[key]; ok {
+			return true
+		}
+	}
+	if additional, ok := s["additionalProperties"].(bool); ok {
+		return !additional
+	}
+	if isIndex {
+		if _, ok := s["items"]; ok {
+			return true
+		}
+		if _, ok := s["prefixItems"]; ok {
+			return true
+		}
+	}
+
+	// a value that can't be an object or array has no keys or indexes.
+	var t ArgType
+	switch v := s["type"].(type) {
+	case string:
+		t = schemaTypes[v]
+	case []any:
+		for _, name := range v {
+			if name, ok := name.(string); ok {
+				t |= schemaTypes[name]
+			}
+		}
+	default:
+		return false
+	}
+	if isIndex {
+		return t&(ArgObject|ArgArray) == 0
+	}
+	return t&ArgObject == 0
+}
+
+// child returns the schema of the object key or array index within the schema, whether it is required, and
+// known is false if the schema does not constrain the value. An error is returned if it can't be present.
+func (c checker) child(schema any, key string) (child any, required, known bool, err error) {
+	candidates := c.candidates(schema)
+	index, indexErr := strconv.Atoi(key)
+	isIndex := indexErr == nil && index >= 0
+
+	var found []any
+	for _, s := range candidates {
+		if props, ok := s["properties"].(map[string]any); ok {
+			if p, ok := props[key]; ok {
+				found = append(found, p)
+			}
+		}
+		if reqs, ok := s["required"].([]any); ok {
+			for _, r := range reqs {
+				if r == key {
+					required = true
+				}
+			}
+		}
+		if isIndex {
+			if element := itemSchema(s, index); element != nil {
+				found = append(found, element)
+				required = false
+			}
+		}
+	}
+	if len(found) == 0 {
+		for _, s := range candidates {
+			if patterns, ok := s["patternProperties"].(map[string]any); ok {
+				for pattern, p := range patterns {
+					if re, err := regexp.Compile(pattern); err == nil && re.MatchString(key) {
+						found = append(found, p)
+					}
+				}
+			}
+			if additional, ok := s["additionalProperties"].(map[string]any); ok {
+				found = append(found, additional)
+			}
+		}
+		required = false
+	}
+
+	switch len(found) {
+	case 0:
+		for _, s := range candidates {
+			if !constrained(s, isIndex) {
+				return nil, false, false, nil
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, false, false, nil
+		}
+		return nil, false, true, ErrUnknownField{Path: key}
+	case 1:
+		return found[0], required, true, nil
+	default:
+		return map[string]any{"anyOf": found}, required, true, nil
+	}
+}
+
+// itemSchema returns the schema of the element at the index of an array, or of every element when negative.
+func itemSchema(s map[string]any, index int) any {
+	if index >= 0 {
+		if prefix, ok := s["prefixItems"].([]any); ok && index < len(prefix) {
+			return prefix[index]
+		}
+		if tuple, ok := s["items"].([]any); ok && index < len(tuple) {
+			return tuple[index]
+		}
+	}
+	if items, ok := s["items"].(map[string]any); ok {
+		return items
+	}
+	return nil
+}
+
+// elements returns the schema of the elements of an array, or nil if unknown.
+func (c checker) elements(schema any) any {
+	var found []any
+	for _, s := range c.candidates(schema) {
+		if element := itemSchema(s, -1); element != nil {
+			found = append(found, element)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil
+	case 1:
+		return found[0]
+	default:
+		return map[string]any{"anyOf": found}
+	}
+}
+
+var schemaTypes = map[string]ArgType{
+	"null":    ArgNull,
+	"boolean": ArgBool,
+	"integer": ArgNumber,
+	"number":  ArgNumber,
+	"string":  ArgString,
+	"array":   ArgArray,
+	"object":  ArgObject,
+}
+
+// typeOf returns the types of the values described by the schema.
+func (c checker) typeOf(schema any) ArgType {
+	return c.typeOfDepth(schema, 0)
+}
+
+func (c checker) typeOfDepth(schema any, depth int) ArgType {
+	s, ok := schema.(map[string]any)
+	if !ok || depth > maxSchemaDepth {
+		return ArgAny
+	}
+
+	t := ArgAny
+	switch v := s["type"].(type) {
+	case string:
+		t = schemaTypes[v]
+	case []any:
+		t = 0
+		for _, name := range v {
+			if name, ok := name.(string); ok {
+				t |= schemaTypes[name]
+			}
+		}
+	default:
+		switch {
+		case s["const"] != nil:
+			t = typeOfValue(s["const"])
+		case s["enum"] != nil:
+			if values, ok := s["enum"].([]any); ok {
+				t = 0
+				for _, value := range values {
+					t |= typeOfValue(value)
+				}
+			}
+		case s["properties"] != nil:
+			t = ArgObject
+		case s["items"] != nil || s["prefixItems"] != nil:
+			t = ArgArray
+		}
+	}
+	if t == 0 {
+		t = ArgAny
+	}
+	if nullable, _ := s["nullable"].(bool); nullable && t != ArgAny {
+		t |= ArgNull
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		t &= c.typeOfDepth(c.ref(ref), depth+1)
+	}
+	if schemas, ok := s["allOf"].([]any); ok {
+		for _, sub := range schemas {
+			t &= c.typeOfDepth(sub, depth+1)
+		}
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		if schemas, ok := s[key].([]any); ok {
+			var union ArgType
+			for _, sub := range schemas {
+				union |= c.typeOfDepth(sub, depth+1)
+			}
+			t &= union
+		}
+	}
+	if t == 0 {
+		// contradictory schemas are not checked.
+		return ArgAny
+	}
+	return t
+}
@@ -0,0 +1,317 @@
+package ksql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var checkSchema = []byte(`{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["name", "age", "tags", "address", "items", "created", "vip"],
+	"properties": {
+		"name": {"type": "string"},
+		"age": {"type": "integer"},
+		"score": {"type": "number"},
+		"nickname": {"type": ["string", "null"]},
+		"vip": {"type": "boolean"},
+		"created": {"type": "string", "format": "date-time"},
+		"status": {"enum": ["active", "inactive"]},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"address": {"$ref": "#/$defs/address"},
+		"items": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["sku", "qty"],
+				"properties": {
+					"sku": {"type": "string"},
+					"qty": {"type": "integer"}
+				}
+			}
+		},
+		"point": {"type": "array", "prefixItems": [{"type": "number"}, {"type": "string"}]},
+		"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+		"extra": {},
+		"metadata": {"type": "object"}
+	},
+	"additionalProperties": false,
+	"$defs": {
+		"address": {
+			"type": "object",
+			"required": ["city"],
+			"properties": {
+				"city": {"type": "string"},
+				"geo": {
+					"type": "object",
+					"properties": {"lat": {"type": "number"}, "lng": {"type": "number"}}
+				}
+			}
+		}
+	}
+}`)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		exp      string
+		expected ArgType
+		err      string
+	}{
+		{
+			name:     "comparison",
+			exp:      `.age >= 18 && .name == "joey"`,
+			expected: ArgBool,
+		},
+		{
+			name: "string compared to number",
+			exp:  `.name > 5`,
+			err:  "unsupported type comparison: `.name > 5`",
+		},
+		{
+			name: "array startswith",
+			exp:  `.tags STARTSWITH "x"`,
+			err:  "unsupported type comparison: `.tags STARTSWITH \"x\"`",
+		},
+		{
+			name: "nested array startswith",
+			exp:  `.vip && .tags STARTSWITH "x"`,
+			err:  "unsupported type comparison: `.tags STARTSWITH \"x\"`",
+		},
+		{
+			name:     "string startswith",
+			exp:      `.name STARTSWITH "x"`,
+			expected: ArgBool,
+		},
+		{
+			name:     "add strings",
+			exp:      `.name + "!"`,
+			expected: ArgString,
+		},
+		{
+			name:     "add numbers",
+			exp:      `.age + .score`,
+			expected: ArgNumber,
+		},
+		{
+			name: "optional string compared to number",
+			exp:  `.nickname > 5`,
+			err:  "unsupported type comparison: `.nickname > 5`",
+		},
+		{
+			name:     "optional string",
+			exp:      `.nickname + "!"`,
+			expected: ArgString,
+		},
+		{
+			name:     "enum",
+			exp:      `.status`,
+			expected: ArgString | ArgNull,
+		},
+		{
+			name: "unknown field",
+			exp:  `.nmae == "joey"`,
+			err:  "unknown field `.nmae`",
+		},
+		{
+			name: "unknown nested field",
+			exp:  `.address.street == "Queen"`,
+			err:  "unknown field `.address.street`",
+		},
+		{
+			name:     "ref",
+			exp:      `.address.city`,
+			expected: ArgString,
+		},
+		{
+			name:     "nested optional",
+			exp:      `.address.geo.lat`,
+			expected: ArgNumber | ArgNull,
+		},
+		{
+			name: "unknown field in exists",
+			exp:  `.address.street IS MISSING`,
+			err:  "unknown field `.address.street`",
+		},
+		{
+			name:     "unconstrained object",
+			exp:      `.metadata.anything > 5`,
+			expected: ArgBool,
+		},
+		{
+			name:     "unconstrained value",
+			exp:      `.extra.anything`,
+			expected: ArgAny,
+		},
+		{
+			name:     "additional properties",
+			exp:      `.labels.team`,
+			expected: ArgString | ArgNull,
+		},
+		{
+			name:     "array index",
+			exp:      `.items.0.qty * 2`,
+			expected: ArgNumber,
+		},
+		{
+			name:     "prefix items",
+			exp:      `.point.1`,
+			expected: ArgString | ArgNull,
+		},
+		{
+			name:     "array length",
+			exp:      `.tags.#`,
+			expected: ArgNumber,
+		},
+		{
+			name:     "array of values",
+			exp:      `.items.#.sku`,
+			expected: ArgArray | ArgNull,
+		},
+		{
+			name: "unknown field in array of values",
+			exp:  `.items.#.price`,
+			err:  "unknown field `.items.#.price`",
+		},
+		{
+			name:     "quantifier",
+			exp:      `ANY .items (.qty > 2)`,
+			expected: ArgBool,
+		},
+		{
+			name: "quantifier unknown field",
+			exp:  `ANY .items (.price > 2)`,
+			err:  "unknown field `.price`",
+		},
+		{
+			name: "quantifier predicate comparison",
+			exp:  `ALL .items (.sku > 2)`,
+			err:  "unsupported type comparison: `.sku > 2`",
+		},
+		{
+			name: "quantifier of string",
+			exp:  `ANY .name (.qty > 2)`,
+			err:  "unsupported type comparison: `ANY .name (.qty > 2)`",
+		},
+		{
+			name:     "filter",
+			exp:      `filter(.items, .qty > 2)`,
+			expected: ArgArray | ArgNull,
+		},
+		{
+			name: "filter of number",
+			exp:  `filter(.age, .qty > 2)`,
+			err:  "invalid argument 1 for function `filter`, expected array found: number",
+		},
+		{
+			name:     "coerce datetime",
+			exp:      `COERCE .created _datetime_ > COERCE "2022-01-01" _datetime_`,
+			expected: ArgBool,
+		},
+		{
+			name: "invalid coerce",
+			exp:  `COERCE .tags _datetime_`,
+			err:  "unsupported type comparison for COERCE: `COERCE .tags _datetime_`",
+		},
+		{
+			name:     "coerce number",
+			exp:      `COERCE .name _number_`,
+			expected: ArgNumber,
+		},
+		{
+			name: "function argument",
+			exp:  `len(.vip)`,
+			err:  "invalid argument 1 for function `len`, expected string|array|object found: bool",
+		},
+		{
+			name: "optional function argument",
+			exp:  `upper(.score)`,
+			err:  "invalid argument 1 for function `upper`, expected string found: null|number",
+		},
+		{
+			name: "array function argument",
+			exp:  `upper(.tags)`,
+			err:  "invalid argument 1 for function `upper`, expected string found: array",
+		},
+		{
+			name:     "optional function argument accepted",
+			exp:      `upper(.nickname)`,
+			expected: ArgString | ArgNull,
+		},
+		{
+			name:     "null function argument",
+			exp:      `upper(NULL)`,
+			expected: ArgNull,
+		},
+		{
+			name:     "function",
+			exp:      `len(.tags) > 2`,
+			expected: ArgBool,
+		},
+		{
+			name:     "conditional",
+			exp:      `CASE WHEN .vip THEN .name ELSE .age END`,
+			expected: ArgString | ArgNumber,
+		},
+		{
+			name:     "conditional without else",
+			exp:      `CASE WHEN .vip THEN .name END`,
+			expected: ArgString | ArgNull,
+		},
+		{
+			name:     "array literal",
+			exp:      `[.name, .age]`,
+			expected: ArgArray,
+		},
+		{
+			name:     "in",
+			exp:      `.status IN ["active", "inactive"]`,
+			expected: ArgBool,
+		},
+		{
+			name:     "between",
+			exp:      `.age BETWEEN 1 10`,
+			expected: ArgBool,
+		},
+		{
+			name:     "parameter",
+			exp:      `.age > $min`,
+			expected: ArgBool,
+		},
+		{
+			name:     "gjson modifier",
+			exp:      `.tags|@reverse`,
+			expected: ArgAny,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := Check(ex, checkSchema)
+			if tc.err != "" {
+				assert.EqualError(err, tc.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result, "expected %s got %s", tc.expected, result)
+		})
+	}
+}
+
+func TestCheckInvalidSchema(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`.name`))
+	assert.NoError(err)
+
+	_, err = Check(ex, []byte(`{`))
+	assert.Error(err)
+}
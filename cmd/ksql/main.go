@@ -2,10 +2,14 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/go-playground/ksql"
 	"github.com/go-playground/pkg/v5/bytes"
@@ -14,11 +18,17 @@ import (
 func main() {
 
 	var outputOriginal bool
+	var inputFormat string
 	flag.BoolVar(&outputOriginal, "o", false, "Indicates if the original data will be output after applying the expression. The results of the expression MUST be a boolean otherwise the output will be ignored.")
+	flag.StringVar(&inputFormat, "input-format", string(ksql.InputJSON), "The format of the data, one of json, yaml, msgpack, cbor or toml. Data in formats other than json is read as a stream of documents, toml being a single document, and output as JSON.")
 	flag.Usage = usage
 	flag.Parse()
 
 	isPipe := isInputFromPipe()
+	if flag.Arg(0) == "fmt" {
+		format(isPipe)
+		return
+	}
 	if (flag.NArg() < 2 && !isPipe) || (flag.NArg() < 1 && isPipe) {
 		flag.Usage()
 		return
@@ -26,7 +36,12 @@ func main() {
 
 	ex, err := ksql.Parse([]byte(flag.Arg(0)))
 	if err != nil {
-		flag.Usage()
+		printParseError(err)
+		os.Exit(1)
+	}
+
+	if format := ksql.InputFormat(inputFormat); format != ksql.InputJSON {
+		calculateFormat(ex, format, outputOriginal, isPipe)
 		return
 	}
 
@@ -107,8 +122,112 @@ func main() {
 	}
 }
 
+// calculateFormat outputs the result of the expression for each document of the data in a format other than
+// JSON, either piped in or the data argument.
+func calculateFormat(ex ksql.Expression, format ksql.InputFormat, outputOriginal, isPipe bool) {
+	var r io.Reader = os.Stdin
+	if !isPipe {
+		r = strings.NewReader(flag.Arg(1))
+	}
+	dec, err := ksql.NewDecoder(format, r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if err := w.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, "writing standard output:", err)
+		}
+	}()
+
+	enc := json.NewEncoder(w)
+	for {
+		document, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "reading input:", err)
+			return
+		}
+		result, err := ksql.CalculateValue(ex, document)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "calculating expression:", err)
+			return
+		}
+		if outputOriginal {
+			if result, ok := result.(bool); !ok || !result {
+				continue
+			}
+			result = document
+		}
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintln(os.Stderr, "encoding result to standard output:", err)
+			return
+		}
+	}
+}
+
+// format outputs the canonical form of the expression argument or of each expression line piped in.
+func format(isPipe bool) {
+	if flag.NArg() < 2 && !isPipe {
+		flag.Usage()
+		return
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if err := w.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, "writing standard output:", err)
+		}
+	}()
+
+	formatOne := func(expression []byte) bool {
+		ex, err := ksql.Parse(expression)
+		if err != nil {
+			printParseError(err)
+			return false
+		}
+		if _, err := fmt.Fprintln(w, ksql.Format(ex)); err != nil {
+			fmt.Fprintln(os.Stderr, "writing standard output:", err)
+			return false
+		}
+		return true
+	}
+
+	if flag.NArg() >= 2 {
+		formatOne([]byte(flag.Arg(1)))
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if !formatOne(scanner.Bytes()) {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "reading standard input:", err)
+	}
+}
+
+// printParseError outputs the parse error along with the location of the error within the expression.
+func printParseError(err error) {
+	fmt.Fprintln(os.Stderr, "parsing expression:", err)
+	var syntaxErr ksql.ErrSyntax
+	if errors.As(err, &syntaxErr) {
+		fmt.Fprintln(os.Stderr, syntaxErr.Snippet())
+	}
+}
+
 func usage() {
 	fmt.Println("ksql [OPTIONS] <EXPRESSION> [DATA]")
+	fmt.Println("ksql fmt <EXPRESSION>")
 	flag.PrintDefaults()
 }
 
@@ -0,0 +1,192 @@
+package ksql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditional(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		src      string
+		expected any
+	}{
+		{
+			name:     "if true",
+			exp:      `IF .premium THEN 0 ELSE 2.5`,
+			src:      `{"premium":true}`,
+			expected: 0.0,
+		},
+		{
+			name:     "if false",
+			exp:      `IF .premium THEN 0 ELSE 2.5`,
+			src:      `{"premium":false}`,
+			expected: 2.5,
+		},
+		{
+			name:     "if non boolean condition is false",
+			exp:      `IF .premium THEN 0 ELSE 2.5`,
+			src:      `{}`,
+			expected: 2.5,
+		},
+		{
+			name:     "if parenthesised",
+			exp:      `IF(.premium) THEN(0) ELSE(2.5)`,
+			src:      `{"premium":false}`,
+			expected: 2.5,
+		},
+		{
+			name:     "case parenthesised",
+			exp:      `CASE WHEN(.a) THEN(1) ELSE(2) END`,
+			src:      `{"a":true}`,
+			expected: 1.0,
+		},
+		{
+			name:     "if only calculates the branch taken",
+			exp:      `IF .premium THEN 0 ELSE .fee / "x"`,
+			src:      `{"premium":true}`,
+			expected: 0.0,
+		},
+		{
+			name:     "if condition expression",
+			exp:      `IF .total > 100 && .country == "CA" THEN "free" ELSE "paid"`,
+			src:      `{"total":150,"country":"CA"}`,
+			expected: "free",
+		},
+		{
+			name:     "if else extends",
+			exp:      `IF .premium THEN 0 ELSE 2.5 * 2`,
+			src:      `{"premium":false}`,
+			expected: 5.0,
+		},
+		{
+			name:     "if parenthesised operand",
+			exp:      `(IF .premium THEN 0 ELSE 2.5) * 2 == 5`,
+			src:      `{"premium":false}`,
+			expected: true,
+		},
+		{
+			name:     "if nested",
+			exp:      `IF .a THEN IF .b THEN 1 ELSE 2 ELSE 3`,
+			src:      `{"a":true,"b":false}`,
+			expected: 2.0,
+		},
+		{
+			name:     "if within array",
+			exp:      `[IF .a THEN 1 ELSE 2, 3]`,
+			src:      `{"a":true}`,
+			expected: []any{1.0, 3.0},
+		},
+		{
+			name:     "if right operand",
+			exp:      `1 + IF .a THEN 1 ELSE 2`,
+			src:      `{"a":true}`,
+			expected: 2.0,
+		},
+		{
+			name:     "case first true branch",
+			exp:      `CASE WHEN .total > 1000 THEN "gold" WHEN .total > 100 THEN "silver" ELSE "bronze" END`,
+			src:      `{"total":500}`,
+			expected: "silver",
+		},
+		{
+			name:     "case else",
+			exp:      `CASE WHEN .total > 1000 THEN "gold" WHEN .total > 100 THEN "silver" ELSE "bronze" END`,
+			src:      `{"total":5}`,
+			expected: "bronze",
+		},
+		{
+			name:     "case without else is null",
+			exp:      `CASE WHEN .total > 1000 THEN "gold" END`,
+			src:      `{"total":5}`,
+			expected: nil,
+		},
+		{
+			name:     "case only calculates the branch taken",
+			exp:      `CASE WHEN true THEN 1 WHEN .a / "x" THEN 2 ELSE .b / "x" END`,
+			expected: 1.0,
+		},
+		{
+			name:     "case followed by operation",
+			exp:      `CASE WHEN .a THEN 1 ELSE 2 END + 1 == 3`,
+			src:      `{"a":false}`,
+			expected: true,
+		},
+		{
+			name:     "case within parenthesis",
+			exp:      `(CASE WHEN .a THEN .b END)`,
+			src:      `{"a":true,"b":"b"}`,
+			expected: "b",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(tc.src))
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestConditionalParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name string
+		exp  string
+		err  string
+	}{
+		{
+			name: "if missing then",
+			exp:  `IF .a ELSE 1`,
+			err:  "1:7: unexpected token `ELSE`, expected THEN",
+		},
+		{
+			name: "if missing else",
+			exp:  `IF .a THEN 1`,
+			err:  "1:13: expression ends unexpectedly, expected ELSE",
+		},
+		{
+			name: "case missing when",
+			exp:  `CASE ELSE 1 END`,
+			err:  "1:6: unexpected token `ELSE`, expected WHEN",
+		},
+		{
+			name: "case missing end",
+			exp:  `CASE WHEN .a THEN 1`,
+			err:  "1:20: expression ends unexpectedly, expected one of WHEN, ELSE, END",
+		},
+		{
+			name: "case else missing end",
+			exp:  `CASE WHEN .a THEN 1 ELSE 2 WHEN .b THEN 3 END`,
+			err:  "1:28: unexpected token `WHEN`, expected END",
+		},
+		{
+			name: "case missing value",
+			exp:  `CASE WHEN .a THEN END`,
+			err:  "1:19: token is not a valid value `END`, expected one of selector path, string, number, true, false, NULL, parameter, function, IF, CASE, EXISTS, ANY, ALL, NONE, [, {, (, !, COERCE",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.exp))
+			assert.Error(err)
+			assert.Equal(tc.err, err.Error())
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package ksql
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseDuration parses either a Go duration eg. `72h30m` or an ISO-8601 duration eg. `P3DT12H`. ISO-8601 years
+// and months are not supported as their length varies.
+func parseDuration(s string) (time.Duration, error) {
+	iso := strings.TrimPrefix(s, "-")
+	if len(iso) == 0 || iso[0] != 'P' {
+		return time.ParseDuration(s)
+	}
+	d, err := parseISODuration(iso[1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid ISO-8601 duration `%s`: %w", s, err)
+	}
+	if len(iso) != len(s) {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseISODuration parses the designators of an ISO-8601 duration following the `P`.
+func parseISODuration(s string) (time.Duration, error) {
+	if s == "" || s == "T" {
+		return 0, errors.New("no values")
+	}
+	var d time.Duration
+	var inTime bool
+	for len(s) > 0 {
+		if s[0] == 'T' {
+			if inTime {
+				return 0, errors.New("multiple `T`")
+			}
+			inTime = true
+			s = s[1:]
+			if s == "" {
+				return 0, errors.New("no values after `T`")
+			}
+			continue
+		}
+
+		i := strings.IndexFunc(s, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.' && r != ','
+		})
+		if i <= 0 {
+			return 0, errors.New("expected a number")
+		}
+		n, err := strconv.ParseFloat(strings.Replace(s[:i], ",", ".", 1), 64)
+		if err != nil {
+			return 0, err
+		}
+
+		var unit time.Duration
+		switch designator := s[i]; {
+		case !inTime && designator == 'W':
+			unit = 7 * 24 * time.Hour
+		case !inTime && designator == 'D':
+			unit = 24 * time.Hour
+		case inTime && designator == 'H':
+			unit = time.Hour
+		case inTime && designator == 'M':
+			unit = time.Minute
+		case inTime && designator == 'S':
+			unit = time.Second
+		case !inTime && (designator == 'Y' || designator == 'M'):
+			return 0, errors.New("years and months are not supported")
+		default:
+			return 0, fmt.Errorf("unexpected designator `%c`", designator)
+		}
+
+		v := n * float64(unit)
+		if v+float64(d) > math.MaxInt64 {
+			return 0, errors.New("duration out of range")
+		}
+		d += time.Duration(math.Round(v))
+		s = s[i+1:]
+	}
+	return d, nil
+}
+
+// timeArithmetic applies the arithmetic operator to the values if either is a duration, or when subtracting a
+// DateTime from another, returning false if not. Durations may be added to or subtracted from DateTimes and
+// other durations, multiplied by a number and divided by a number or another duration.
+func timeArithmetic(op byte, left, right any) (any, bool, error) {
+	switch l := left.(type) {
+	case time.Time:
+		switch r := right.(type) {
+		case time.Duration:
+			switch op {
+			case '+':
+				return l.Add(r), true, nil
+			case '-':
+				return l.Add(-r), true, nil
+			}
+		case time.Time:
+			if op == '-' {
+				return l.Sub(r), true, nil
+			}
+		}
+
+	case time.Duration:
+		switch r := right.(type) {
+		case time.Duration:
+			switch op {
+			case '+':
+				return l + r, true, nil
+			case '-':
+				return l - r, true, nil
+			case '/':
+				if r == 0 {
+					return nil, true, ErrDivisionByZero{}
+				}
+				return float64(l) / float64(r), true, nil
+			}
+		case time.Time:
+			if op == '+' {
+				return r.Add(l), true, nil
+			}
+		default:
+			if argTypeOf(right) != ArgNumber {
+				break
+			}
+			n := toFloat(right)
+			switch op {
+			case '*':
+				return time.Duration(math.Round(float64(l) * n)), true, nil
+			case '/':
+				if n == 0 {
+					return nil, true, ErrDivisionByZero{}
+				}
+				return time.Duration(math.Round(float64(l) / n)), true, nil
+			}
+		}
+
+	default:
+		if r, ok := right.(time.Duration); ok && op == '*' && argTypeOf(left) == ArgNumber {
+			return time.Duration(math.Round(toFloat(left) * float64(r))), true, nil
+		}
+	}
+	return nil, false, nil
+}
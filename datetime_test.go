@@ -0,0 +1,318 @@
+package ksql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		input    string
+		expected time.Duration
+		err      bool
+	}{
+		{input: "72h", expected: 72 * time.Hour},
+		{input: "1h30m", expected: 90 * time.Minute},
+		{input: "-5s", expected: -5 * time.Second},
+		{input: "P3D", expected: 72 * time.Hour},
+		{input: "P2W", expected: 14 * 24 * time.Hour},
+		{input: "PT1H30M", expected: 90 * time.Minute},
+		{input: "P1DT0.5S", expected: 24*time.Hour + 500*time.Millisecond},
+		{input: "PT1,5H", expected: 90 * time.Minute},
+		{input: "-P1D", expected: -24 * time.Hour},
+		{input: "P1Y", err: true},
+		{input: "P1M", err: true},
+		{input: "PT1D", err: true},
+		{input: "P", err: true},
+		{input: "PT", err: true},
+		{input: "P1DT", err: true},
+		{input: "PD", err: true},
+		{input: "P1D1", err: true},
+		{input: "P9999999999999D", err: true},
+		{input: "3 days", err: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			t.Parallel()
+
+			d, err := parseDuration(tc.input)
+			if tc.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, d)
+		})
+	}
+}
+
+func TestDateTimeArithmetic(t *testing.T) {
+	assert := require.New(t)
+
+	const src = `{"created":"2022-01-01T00:00:00Z","updated":"2022-01-04T12:00:00Z","timeout":90,"ttl":"PT1H","bad":"soon"}`
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		exp      string
+		expected any
+		err      bool
+	}{
+		{name: "duration", exp: `COERCE "72h" _duration_`, expected: 72 * time.Hour},
+		{name: "iso duration", exp: `COERCE .ttl _duration_`, expected: time.Hour},
+		{name: "duration from seconds", exp: `COERCE .timeout _duration_`, expected: 90 * time.Second},
+		{name: "duration missing", exp: `COERCE .missing _duration_`, expected: nil},
+		{name: "duration invalid", exp: `COERCE .bad _duration_`, err: true},
+		{name: "datetime plus duration", exp: `COERCE .created _datetime_ + COERCE "P3D" _duration_`, expected: created.Add(72 * time.Hour)},
+		{name: "duration plus datetime", exp: `COERCE "P3D" _duration_ + COERCE .created _datetime_`, expected: created.Add(72 * time.Hour)},
+		{name: "datetime minus duration", exp: `COERCE .created _datetime_ - COERCE "24h" _duration_`, expected: created.Add(-24 * time.Hour)},
+		{name: "datetime minus datetime", exp: `COERCE .updated _datetime_ - COERCE .created _datetime_`, expected: 84 * time.Hour},
+		{name: "duration arithmetic", exp: `COERCE "1h" _duration_ + COERCE "30m" _duration_ - COERCE "PT15M" _duration_`, expected: 75 * time.Minute},
+		{name: "duration multiplied", exp: `2 * COERCE "1h" _duration_ * 1.5`, expected: 3 * time.Hour},
+		{name: "duration divided", exp: `COERCE "1h" _duration_ / 4`, expected: 15 * time.Minute},
+		{name: "duration ratio", exp: `COERCE "1h" _duration_ / COERCE "15m" _duration_`, expected: 4.0},
+		{name: "duration divided by zero", exp: `COERCE "1h" _duration_ / 0`, err: true},
+		{name: "older than", exp: `COERCE .updated _datetime_ - COERCE .created _datetime_ > COERCE "P3D" _duration_`, expected: true},
+		{name: "not older than", exp: `COERCE .updated _datetime_ - COERCE .created _datetime_ >= COERCE "P4D" _duration_`, expected: false},
+		{name: "duration lt", exp: `COERCE "1m" _duration_ < COERCE "PT61S" _duration_`, expected: true},
+		{name: "duration lte", exp: `COERCE "1m" _duration_ <= COERCE "PT60S" _duration_`, expected: true},
+		{name: "duration equals", exp: `COERCE "1m" _duration_ == COERCE "PT60S" _duration_`, expected: true},
+		{name: "duration between", exp: `COERCE .ttl _duration_ BETWEEN COERCE "30m" _duration_ COERCE "2h" _duration_`, expected: true},
+		{name: "datetime plus number", exp: `COERCE .created _datetime_ + 1`, err: true},
+		{name: "datetime plus datetime", exp: `COERCE .created _datetime_ + COERCE .updated _datetime_`, err: true},
+		{name: "duration minus datetime", exp: `COERCE "1h" _duration_ - COERCE .created _datetime_`, err: true},
+		{name: "duration compared with number", exp: `COERCE "1h" _duration_ > 1`, err: true},
+		{name: "year", exp: `year(COERCE .updated _datetime_)`, expected: 2022.0},
+		{name: "month", exp: `month(COERCE .updated _datetime_) == 1`, expected: true},
+		{name: "day", exp: `day(COERCE .updated _datetime_)`, expected: 4.0},
+		{name: "weekday", exp: `weekday(COERCE .created _datetime_)`, expected: 6.0},
+		{name: "hour", exp: `hour(COERCE .updated _datetime_) BETWEEN 9 17`, expected: true},
+		{name: "minute", exp: `minute(COERCE .updated _datetime_)`, expected: 0.0},
+		{name: "second", exp: `second(COERCE .updated _datetime_)`, expected: 0.0},
+		{name: "unix", exp: `unix(COERCE .created _datetime_) > 1600000000`, expected: true},
+		{name: "part of unparsable datetime", exp: `year(COERCE .bad _datetime_)`, expected: nil},
+		{name: "part not datetime", exp: `year(.timeout)`, err: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			if tc.err && err != nil {
+				return
+			}
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(src))
+			if tc.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestNowClock(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	env := NewEnvironment()
+	env.SetFunction("now", NowFunction(func() time.Time { return now }))
+
+	ex, err := env.Parse([]byte(`now() - COERCE .created _datetime_ > COERCE "P30D" _duration_`))
+	assert.NoError(err)
+
+	result, err := ex.Calculate([]byte(`{"created":"2022-01-01T00:00:00Z"}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+
+	result, err = ex.Calculate([]byte(`{"created":"2022-01-15T00:00:00Z"}`))
+	assert.NoError(err)
+	assert.Equal(false, result)
+
+	now = now.Add(14 * 24 * time.Hour)
+	result, err = ex.Calculate([]byte(`{"created":"2022-01-15T00:00:00Z"}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
+
+func TestDurationParameter(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := ParseWithParams([]byte(`COERCE .a _datetime_ - COERCE .b _datetime_ > $max_age`), map[string]any{"max_age": time.Hour})
+	assert.NoError(err)
+
+	result, err := ex.Calculate([]byte(`{"a":"2022-01-01T02:00:00Z","b":"2022-01-01T00:00:00Z"}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
+
+func TestDurationParseError(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := Parse([]byte(`COERCE "3 days" _duration_`))
+	assert.Error(err)
+	assert.Equal("1:17: unsupported type comparison for COERCE: `unsupported type COERCE for value: 3 days to a Duration`", err.Error())
+}
+
+func TestDateTimeLayoutsAndLocations(t *testing.T) {
+	assert := require.New(t)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(err)
+
+	const src = `{"eu":"01/02/2022","local":"2022-02-01 10:00","zoned":"2022-02-01T10:00:00Z","bad":"soon"}`
+
+	tests := []struct {
+		name     string
+		exp      string
+		opts     ParseOptions
+		expected any
+		err      error
+	}{
+		{
+			name:     "detected month first",
+			exp:      `COERCE .eu _datetime_`,
+			expected: time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "detected day first",
+			exp:      `COERCE .eu _datetime_`,
+			opts:     ParseOptions{PreferDayFirst: true},
+			expected: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "layout",
+			exp:      `COERCE .eu _datetime_["02/01/2006"]`,
+			expected: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "layout and location",
+			exp:      `COERCE .local _datetime_["2006-01-02 15:04", "Europe/Berlin"]`,
+			expected: time.Date(2022, 2, 1, 10, 0, 0, 0, berlin),
+		},
+		{
+			name:     "detected with location",
+			exp:      `COERCE .local _datetime_["", "Europe/Berlin"]`,
+			expected: time.Date(2022, 2, 1, 10, 0, 0, 0, berlin),
+		},
+		{
+			name:     "default location",
+			exp:      `COERCE .local _datetime_`,
+			opts:     ParseOptions{Location: berlin},
+			expected: time.Date(2022, 2, 1, 10, 0, 0, 0, berlin),
+		},
+		{
+			name:     "default location with layout",
+			exp:      `COERCE .local _datetime_["2006-01-02 15:04"]`,
+			opts:     ParseOptions{Location: berlin},
+			expected: time.Date(2022, 2, 1, 10, 0, 0, 0, berlin),
+		},
+		{
+			name:     "explicit location takes precedence",
+			exp:      `COERCE .local _datetime_["2006-01-02 15:04", "UTC"]`,
+			opts:     ParseOptions{Location: berlin},
+			expected: time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "compared across locations",
+			exp:      `COERCE .local _datetime_["2006-01-02 15:04", "Europe/Berlin"] < COERCE .zoned _datetime_`,
+			expected: true,
+		},
+		{
+			name:     "layout mismatch is null",
+			exp:      `COERCE .eu _datetime_["2006-01-02"]`,
+			expected: nil,
+		},
+		{
+			name:     "strict",
+			exp:      `COERCE .eu _datetime_strict_["02/01/2006"]`,
+			expected: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "strict layout mismatch",
+			exp:  `COERCE .eu _datetime_strict_["2006-01-02"]`,
+			err:  ErrInvalidDateTime{},
+		},
+		{
+			name: "strict detected invalid",
+			exp:  `COERCE .bad _datetime_strict_`,
+			err:  ErrInvalidDateTime{},
+		},
+		{
+			name:     "chained",
+			exp:      `COERCE .eu _datetime_["02/01/2006"],_string_`,
+			expected: "2022-02-01T00:00:00Z",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := ParseWithOptions([]byte(tc.exp), tc.opts)
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(src))
+			if tc.err != nil {
+				assert.IsType(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestDateTimeLayoutParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name string
+		exp  string
+		err  string
+	}{
+		{
+			name: "invalid location",
+			exp:  `COERCE .a _datetime_["", "Mars/Olympus"]`,
+			err:  "1:26: invalid location `Mars/Olympus`",
+		},
+		{
+			name: "layout not a string",
+			exp:  `COERCE .a _datetime_[1]`,
+			err:  "1:22: unexpected token `1`, expected string",
+		},
+		{
+			name: "unclosed",
+			exp:  `COERCE .a _datetime_["2006"`,
+			err:  "1:28: expression ends unexpectedly, expected one of ,, ]",
+		},
+		{
+			name: "strict constant",
+			exp:  `COERCE "2022-13-45" _datetime_strict_["2006-01-02"]`,
+			err:  "1:21: invalid DateTime `2022-13-45` for layout `2006-01-02`: parsing time \"2022-13-45\": month out of range",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.exp))
+			assert.Error(err)
+			assert.Equal(tc.err, err.Error())
+		})
+	}
+}
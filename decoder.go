@@ -0,0 +1,309 @@
+package ksql
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// InputFormat is the encoding of the data an expression is calculated against, see CalculateFormat.
+//
+// Any format not listed below is an ErrUnsupportedInputFormat.
+type InputFormat string
+
+const (
+	// InputJSON is JSON, calculated directly as with Expression.Calculate.
+	InputJSON InputFormat = "json"
+
+	// InputYAML is YAML.
+	InputYAML InputFormat = "yaml"
+
+	// InputMessagePack is MessagePack.
+	InputMessagePack InputFormat = "msgpack"
+
+	// InputCBOR is CBOR.
+	InputCBOR InputFormat = "cbor"
+
+	// InputTOML is TOML, which is a single document.
+	InputTOML InputFormat = "toml"
+)
+
+// CalculateFormat calculates the expression against data encoded in the supplied format, which is decoded
+// into Go values and calculated using CalculateValue. Only the first document of the data is calculated.
+//
+// Values without a JSON equivalent are calculated as if they were encoded as JSON:
+//
+//   - Timestamps eg. YAML `!!timestamp`, TOML date-times, the MessagePack timestamp extension and CBOR tags 0
+//     and 1 are strings in UTC formatted using RFC 3339 with nanoseconds, as encoding/json encodes a time.Time,
+//     which can be coerced using `_datetime_`. TOML local date-times and dates are in UTC, as YAML timestamps
+//     without a time zone are, while TOML local times are strings formatted as `15:04:05.999999999`.
+//   - Binary eg. YAML `!!binary`, MessagePack bin and CBOR byte strings are strings of the standard base64
+//     encoding of the bytes.
+//   - Integers are numbers, CBOR bignums included, which are exact when parsed with ExactNumbers.
+//   - Map keys that aren't strings are the JSON text of the key eg. `1`, `true` or `null`, with timestamps and
+//     binary keys converted to strings as above. Keys that are the same once converted eg. `1` and `"1"`
+//     return an ErrDecode.
+//   - The content of any other CBOR tag is used as the value, ignoring the tag.
+//
+// NaN and infinite numbers return an error when calculated, as they can't be encoded as JSON.
+func CalculateFormat(e Expression, format InputFormat, src []byte) (any, error) {
+	if format == InputJSON {
+		return e.Calculate(src)
+	}
+	d, err := NewDecoder(format, bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	value, err := d.Decode()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return CalculateValue(e, value)
+}
+
+// Decoder decodes a stream of documents encoded in an InputFormat into values calculated using CalculateValue,
+// converting values without a JSON equivalent as described by CalculateFormat.
+type Decoder struct {
+	format InputFormat
+	decode func() (any, error)
+}
+
+// NewDecoder returns a Decoder decoding documents in the supplied format from the reader. JSON documents are
+// returned as a json.RawMessage without being decoded.
+func NewDecoder(format InputFormat, r io.Reader) (*Decoder, error) {
+	d := &Decoder{format: format}
+	switch format {
+	case InputJSON:
+		dec := json.NewDecoder(r)
+		d.decode = func() (any, error) {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+			return raw, nil
+		}
+
+	case InputYAML:
+		dec := yaml.NewDecoder(r)
+		d.decode = func() (any, error) {
+			var node yaml.Node
+			if err := dec.Decode(&node); err != nil {
+				return nil, err
+			}
+			if err := yamlBinaryToBase64(&node); err != nil {
+				return nil, err
+			}
+			var value any
+			if err := node.Decode(&value); err != nil {
+				return nil, err
+			}
+			return value, nil
+		}
+
+	case InputMessagePack:
+		dec := msgpack.NewDecoder(r)
+		dec.SetMapDecoder(func(dec *msgpack.Decoder) (any, error) {
+			return dec.DecodeUntypedMap()
+		})
+		d.decode = dec.DecodeInterface
+
+	case InputCBOR:
+		mode, err := cbor.DecOptions{MaxNestedLevels: maxValueDepth}.DecMode()
+		if err != nil {
+			return nil, err
+		}
+		dec := mode.NewDecoder(r)
+		d.decode = func() (any, error) {
+			var value any
+			if err := dec.Decode(&value); err != nil {
+				return nil, err
+			}
+			return value, nil
+		}
+
+	case InputTOML:
+		// a TOML document is the whole of the data, so there is only ever one.
+		var decoded bool
+		d.decode = func() (any, error) {
+			if decoded {
+				return nil, io.EOF
+			}
+			decoded = true
+			value := make(map[string]any)
+			if _, err := toml.NewDecoder(r).Decode(&value); err != nil {
+				return nil, err
+			}
+			return tomlValue(value), nil
+		}
+
+	default:
+		return nil, ErrUnsupportedInputFormat{Format: format}
+	}
+	return d, nil
+}
+
+// Decode returns the next document, or io.EOF when there are none remaining.
+func (d *Decoder) Decode() (any, error) {
+	value, err := d.decode()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, ErrDecode{Format: d.format, Err: err}
+	}
+	if d.format == InputJSON {
+		return value, nil
+	}
+	value, err = decodedValue(value)
+	if err != nil {
+		return nil, ErrDecode{Format: d.format, Err: err}
+	}
+	return value, nil
+}
+
+// yamlBinaryToBase64 replaces the `!!binary` scalars within the node with strings of their base64 encoding,
+// which would otherwise be decoded into a string of the bytes.
+func yamlBinaryToBase64(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!binary" {
+		// the value may be split across lines so is decoded and encoded again.
+		b, err := base64.StdEncoding.DecodeString(n.Value)
+		if err != nil {
+			return fmt.Errorf("invalid !!binary value at line %d: %w", n.Line, err)
+		}
+		n.Tag = "!!str"
+		n.Value = base64.StdEncoding.EncodeToString(b)
+		return nil
+	}
+	for _, child := range n.Content {
+		if err := yamlBinaryToBase64(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tomlValue converts the arrays of tables within the value decoded from TOML to []any and its local date-times
+// and dates, decoded in the local time zone, to UTC as YAML timestamps without a time zone are. Local times have
+// no date so are formatted as strings.
+func tomlValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, elem := range v {
+			v[key] = tomlValue(elem)
+		}
+		return v
+
+	case []map[string]any:
+		arr := make([]any, len(v))
+		for i, elem := range v {
+			arr[i] = tomlValue(elem)
+		}
+		return arr
+
+	case []any:
+		for i, elem := range v {
+			v[i] = tomlValue(elem)
+		}
+		return v
+
+	case time.Time:
+		// the toml package names the time zones of local values.
+		switch v.Location().String() {
+		case "datetime-local", "date-local":
+			return time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), time.UTC)
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		}
+		return v
+
+	default:
+		return value
+	}
+}
+
+// decodedValue converts the values decoded from a format other than JSON that have no JSON equivalent.
+func decodedValue(value any) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, elem := range v {
+			converted, err := decodedValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+
+	case map[any]any:
+		obj := make(map[string]any, len(v))
+		for key, elem := range v {
+			k, err := decodedKey(key)
+			if err != nil {
+				return nil, err
+			}
+			if _, found := obj[k]; found {
+				return nil, fmt.Errorf("duplicate map key `%s`", k)
+			}
+			converted, err := decodedValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = converted
+		}
+		return obj, nil
+
+	case []any:
+		for i, elem := range v {
+			converted, err := decodedValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), nil
+
+	case cbor.ByteString:
+		return base64.StdEncoding.EncodeToString([]byte(v)), nil
+
+	case big.Int:
+		return &v, nil
+
+	case cbor.Tag:
+		return decodedValue(v.Content)
+
+	default:
+		return value, nil
+	}
+}
+
+// decodedKey returns the map key as the key of a JSON object.
+func decodedKey(key any) (string, error) {
+	k, err := decodedValue(key)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := k.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(k)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
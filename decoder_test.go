@@ -0,0 +1,421 @@
+package ksql
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestCalculateFormatMatchesJSON(t *testing.T) {
+	assert := require.New(t)
+
+	doc := map[string]any{
+		"name":    "joey",
+		"age":     30,
+		"score":   1.5,
+		"tags":    []any{"a", "b"},
+		"address": map[string]any{"city": "Auckland", "geo": map[string]any{"lat": -36.8}},
+		"items":   []any{map[string]any{"sku": "a", "qty": 1}, map[string]any{"sku": "b", "qty": 3}},
+		"nil":     nil,
+		"vip":     true,
+	}
+	packed, err := msgpack.Marshal(doc)
+	assert.NoError(err)
+	encoded, err := cbor.Marshal(doc)
+	assert.NoError(err)
+
+	sources := map[InputFormat][]byte{
+		InputJSON: []byte(`{"name":"joey","age":30,"score":1.5,"tags":["a","b"],"address":{"city":"Auckland","geo":{"lat":-36.8}},
+"items":[{"sku":"a","qty":1},{"sku":"b","qty":3}],"nil":null,"vip":true}`),
+		InputYAML: []byte(`
+name: joey
+age: 30
+score: 1.5
+tags: [a, b]
+address:
+  city: Auckland
+  geo: {lat: -36.8}
+items:
+  - {sku: a, qty: 1}
+  - {sku: b, qty: 3}
+nil: ~
+vip: true
+`),
+		InputMessagePack: packed,
+		InputCBOR:        encoded,
+		// TOML has no null so .nil is missing.
+		InputTOML: []byte(`
+name = "joey"
+age = 30
+score = 1.5
+tags = ["a", "b"]
+vip = true
+
+[address]
+city = "Auckland"
+geo = {lat = -36.8}
+
+[[items]]
+sku = "a"
+qty = 1
+
+[[items]]
+sku = "b"
+qty = 3
+`),
+	}
+
+	for _, exp := range []string{
+		`.name == "joey" && .age >= 18`,
+		`.age + .score`,
+		`.address.geo.lat < 0`,
+		`.address.city + "!"`,
+		`.items.#.sku`,
+		`.items.1.qty * 2`,
+		`.tags`,
+		`.address`,
+		`.nil IS NULL && .missing IS MISSING`,
+		`ANY .items (.qty > 2)`,
+		`.t*s.0`,
+		`.vip`,
+	} {
+		for _, exactNumbers := range []bool{false, true} {
+			ex, err := ParseWithOptions([]byte(exp), ParseOptions{ExactNumbers: exactNumbers})
+			assert.NoError(err, exp)
+
+			expected, err := ex.Calculate(sources[InputJSON])
+			assert.NoError(err, exp)
+
+			for format, src := range sources {
+				if format == InputTOML && exp == `.nil IS NULL && .missing IS MISSING` {
+					continue
+				}
+				result, err := CalculateFormat(ex, format, src)
+				assert.NoError(err, "exp: %s format: %s", exp, format)
+				assert.Equal(expected, result, "exp: %s format: %s", exp, format)
+			}
+		}
+	}
+}
+
+func TestCalculateFormat(t *testing.T) {
+	created := time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	packed := func(v any) []byte {
+		b, err := msgpack.Marshal(v)
+		require.NoError(t, err)
+		return b
+	}
+	encoded := func(v any) []byte {
+		b, err := cbor.Marshal(v)
+		require.NoError(t, err)
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		format   InputFormat
+		exp      string
+		src      []byte
+		expected any
+		err      string
+	}{
+		{
+			name:     "yaml timestamp",
+			format:   InputYAML,
+			exp:      `.created`,
+			src:      []byte(`created: 2022-01-02T03:04:05.000000006Z`),
+			expected: "2022-01-02T03:04:05.000000006Z",
+		},
+		{
+			name:     "yaml timestamp coerced",
+			format:   InputYAML,
+			exp:      `COERCE .created _datetime_ > COERCE "2022-01-01" _datetime_`,
+			src:      []byte(`created: 2022-01-02`),
+			expected: true,
+		},
+		{
+			name:     "yaml quoted timestamp",
+			format:   InputYAML,
+			exp:      `.created`,
+			src:      []byte(`created: "2022-01-02"`),
+			expected: "2022-01-02",
+		},
+		{
+			name:     "yaml binary",
+			format:   InputYAML,
+			exp:      `.raw`,
+			src:      []byte("raw: !!binary |\n  aGVs\n  bG8=\n"),
+			expected: "aGVsbG8=",
+		},
+		{
+			name:     "yaml non-string keys",
+			format:   InputYAML,
+			exp:      `[.1, .true, .null, .1\.5]`,
+			src:      []byte("1: one\ntrue: yes\n~: nothing\n1.5: half\n"),
+			expected: []any{"one", "yes", "nothing", "half"},
+		},
+		{
+			name:     "yaml merge key",
+			format:   InputYAML,
+			exp:      `.b.x + .b.y`,
+			src:      []byte("a: &a {x: 1}\nb:\n  <<: *a\n  y: 2\n"),
+			expected: 3.0,
+		},
+		{
+			name:     "yaml first document",
+			format:   InputYAML,
+			exp:      `.n`,
+			src:      []byte("n: 1\n---\nn: 2\n"),
+			expected: 1.0,
+		},
+		{
+			name:     "yaml empty",
+			format:   InputYAML,
+			exp:      `.n IS MISSING`,
+			src:      []byte(""),
+			expected: true,
+		},
+		{
+			name:   "yaml invalid",
+			format: InputYAML,
+			exp:    `.n`,
+			src:    []byte("n: [1"),
+			err:    "decoding yaml: yaml: line 1: did not find expected ',' or ']'",
+		},
+		{
+			name:     "yaml timestamp with offset",
+			format:   InputYAML,
+			exp:      `.created`,
+			src:      []byte(`created: 2022-01-02T16:04:05+13:00`),
+			expected: "2022-01-02T03:04:05Z",
+		},
+		{
+			name:     "msgpack timestamp",
+			format:   InputMessagePack,
+			exp:      `.created`,
+			src:      packed(map[string]any{"created": created}),
+			expected: "2022-01-02T03:04:05.000000006Z",
+		},
+		{
+			name:     "msgpack binary",
+			format:   InputMessagePack,
+			exp:      `.raw`,
+			src:      packed(map[string]any{"raw": []byte("hello")}),
+			expected: "aGVsbG8=",
+		},
+		{
+			name:     "msgpack non-string keys",
+			format:   InputMessagePack,
+			exp:      `.1 + .2\.5`,
+			src:      packed(map[any]any{int8(1): 10, 2.5: 20}),
+			expected: 30.0,
+		},
+		{
+			name:   "msgpack duplicate keys",
+			format: InputMessagePack,
+			exp:    `.1`,
+			src:    packed(map[any]any{int8(1): "one", "1": "other"}),
+			err:    "decoding msgpack: duplicate map key `1`",
+		},
+		{
+			name:     "msgpack integers",
+			format:   InputMessagePack,
+			exp:      `.small + .large`,
+			src:      packed(map[string]any{"small": int8(-1), "large": uint64(1 << 40)}),
+			expected: float64(1<<40 - 1),
+		},
+		{
+			name:     "cbor timestamp",
+			format:   InputCBOR,
+			exp:      `.created`,
+			src:      []byte{0xa1, 0x67, 'c', 'r', 'e', 'a', 't', 'e', 'd', 0xc1, 0x1a, 0x61, 0xd1, 0x16, 0x25},
+			expected: "2022-01-02T03:04:05Z",
+		},
+		{
+			name:     "cbor binary",
+			format:   InputCBOR,
+			exp:      `.raw`,
+			src:      encoded(map[string]any{"raw": []byte("hello")}),
+			expected: "aGVsbG8=",
+		},
+		{
+			name:     "cbor binary key",
+			format:   InputCBOR,
+			exp:      `.aGVsbG8=`,
+			src:      encoded(map[any]any{cbor.ByteString("hello"): "world"}),
+			expected: "world",
+		},
+		{
+			name:     "cbor bignum",
+			format:   InputCBOR,
+			exp:      `.n`,
+			src:      encoded(map[string]any{"n": new(big.Int).Lsh(big.NewInt(1), 70)}),
+			expected: 1180591620717411303424.0,
+		},
+		{
+			name:     "cbor unknown tag",
+			format:   InputCBOR,
+			exp:      `.v`,
+			src:      encoded(map[string]any{"v": cbor.Tag{Number: 9999, Content: "inner"}}),
+			expected: "inner",
+		},
+		{
+			name:     "toml offset date-time",
+			format:   InputTOML,
+			exp:      `.created`,
+			src:      []byte(`created = 2022-01-02T16:04:05.000000006+13:00`),
+			expected: "2022-01-02T03:04:05.000000006Z",
+		},
+		{
+			name:     "toml local date-time",
+			format:   InputTOML,
+			exp:      `.created`,
+			src:      []byte(`created = 2022-01-02T03:04:05`),
+			expected: "2022-01-02T03:04:05Z",
+		},
+		{
+			name:     "toml local date coerced",
+			format:   InputTOML,
+			exp:      `.created == "2022-01-02T00:00:00Z" && COERCE .created _datetime_ > COERCE "2022-01-01" _datetime_`,
+			src:      []byte(`created = 2022-01-02`),
+			expected: true,
+		},
+		{
+			name:     "toml local time",
+			format:   InputTOML,
+			exp:      `.opens`,
+			src:      []byte(`opens = 07:32:00.5`),
+			expected: "07:32:00.5",
+		},
+		{
+			name:     "toml date-times within arrays of tables",
+			format:   InputTOML,
+			exp:      `.releases.#.at`,
+			src:      []byte("[[releases]]\nat = 2022-01-02\n\n[[releases]]\nat = 2023-01-02T03:04:05Z\n"),
+			expected: []any{"2022-01-02T00:00:00Z", "2023-01-02T03:04:05Z"},
+		},
+		{
+			name:     "toml empty",
+			format:   InputTOML,
+			exp:      `.n IS MISSING`,
+			src:      []byte(""),
+			expected: true,
+		},
+		{
+			name:   "toml invalid",
+			format: InputTOML,
+			exp:    `.n`,
+			src:    []byte("n = [1"),
+			err:    "decoding toml: toml: line 1 (last key \"n\"): expected a comma (',') or array terminator (']'), but got end of file",
+		},
+		{
+			name:   "unsupported",
+			format: "xml",
+			exp:    `.n`,
+			src:    []byte(`<n>1</n>`),
+			err:    "unsupported input format `xml`",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := CalculateFormat(ex, tc.format, tc.src)
+			if tc.err != "" {
+				assert.EqualError(err, tc.err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestCalculateFormatExactNumbers(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := ParseWithOptions([]byte(`.n + 1`), ParseOptions{ExactNumbers: true})
+	assert.NoError(err)
+
+	src := []byte(`{"n": 9007199254740993}`)
+	expected, err := ex.Calculate(src)
+	assert.NoError(err)
+
+	// JSON is also valid YAML.
+	result, err := CalculateFormat(ex, InputYAML, src)
+	assert.NoError(err)
+	assert.Equal(expected, result)
+	assert.NotEqual(9007199254740994.0, result)
+}
+
+func TestDecoder(t *testing.T) {
+	assert := require.New(t)
+
+	var stream bytes.Buffer
+	for _, v := range []any{map[string]any{"n": 1}, map[string]any{"n": 2}} {
+		b, err := msgpack.Marshal(v)
+		assert.NoError(err)
+		stream.Write(b)
+	}
+
+	tests := []struct {
+		format InputFormat
+		src    []byte
+	}{
+		{format: InputJSON, src: []byte("{\"n\":1}\n{\"n\":2}\n")},
+		{format: InputYAML, src: []byte("n: 1\n---\nn: 2\n")},
+		{format: InputMessagePack, src: stream.Bytes()},
+	}
+
+	ex, err := Parse([]byte(`.n`))
+	assert.NoError(err)
+
+	for _, tc := range tests {
+		d, err := NewDecoder(tc.format, bytes.NewReader(tc.src))
+		assert.NoError(err)
+
+		var results []any
+		for {
+			value, err := d.Decode()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.NoError(err, tc.format)
+			result, err := CalculateValue(ex, value)
+			assert.NoError(err)
+			results = append(results, result)
+		}
+		assert.Equal([]any{1.0, 2.0}, results, tc.format)
+	}
+
+	_, err = NewDecoder("xml", nil)
+	assert.Equal(ErrUnsupportedInputFormat{Format: "xml"}, err)
+}
+
+func TestDecoderTOMLSingleDocument(t *testing.T) {
+	assert := require.New(t)
+
+	d, err := NewDecoder(InputTOML, bytes.NewReader([]byte("n = 1\n")))
+	assert.NoError(err)
+
+	value, err := d.Decode()
+	assert.NoError(err)
+	assert.Equal(map[string]any{"n": int64(1)}, value)
+
+	_, err = d.Decode()
+	assert.ErrorIs(err, io.EOF)
+}
@@ -0,0 +1,84 @@
+package ksql
+
+import "strings"
+
+// Environment holds the coercions and functions available to the expressions parsed using it, allowing
+// different sets to be used side by side eg. per tenant, without modifying the global Coercions and
+// Functions which remain the default used by Parse.
+//
+// An Environment must not be modified while it is being used to parse expressions.
+type Environment struct {
+	// Options configures how expressions parsed using the Environment are parsed.
+	Options ParseOptions
+
+	coercions map[string]coercionFunc
+	functions map[string]Function
+}
+
+// NewEnvironment returns an Environment containing a copy of the coercions and functions currently
+// registered within Coercions and Functions.
+func NewEnvironment() *Environment {
+	coercions := Coercions.RLock()
+	defer coercions.RUnlock()
+	functions := Functions.RLock()
+	defer functions.RUnlock()
+
+	env := &Environment{coercions: coercions.T, functions: functions.T}
+	return env.Clone()
+}
+
+// Clone returns a copy of the Environment that can be modified independently.
+func (env *Environment) Clone() *Environment {
+	clone := &Environment{
+		Options:   env.Options,
+		coercions: make(map[string]coercionFunc, len(env.coercions)),
+		functions: make(map[string]Function, len(env.functions)),
+	}
+	for name, fn := range env.coercions {
+		clone.coercions[name] = fn
+	}
+	for name, fn := range env.functions {
+		clone.functions[name] = fn
+	}
+	return clone
+}
+
+// SetCoercion registers or replaces the coercion for the identifier, which must start and end with an
+// underscore eg. `_star_`.
+func (env *Environment) SetCoercion(identifier string, fn func(p *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error)) {
+	env.coercions[identifier] = fn
+}
+
+// RemoveCoercion removes the coercion for the identifier.
+func (env *Environment) RemoveCoercion(identifier string) {
+	delete(env.coercions, identifier)
+}
+
+// SetFunction registers or replaces the function with the case insensitive name.
+func (env *Environment) SetFunction(name string, fn Function) {
+	env.functions[strings.ToLower(name)] = fn
+}
+
+// RemoveFunction removes the function with the case insensitive name.
+func (env *Environment) RemoveFunction(name string) {
+	delete(env.functions, strings.ToLower(name))
+}
+
+// Parse lex's' the provided expression using the coercions and functions of the Environment, see Parse.
+func (env *Environment) Parse(expression []byte) (Expression, error) {
+	return env.ParseWithParams(expression, nil)
+}
+
+// ParseWithParams lex's' the provided expression using the coercions and functions of the Environment,
+// binding the supplied values to its named parameters, see ParseWithParams.
+func (env *Environment) ParseWithParams(expression []byte, params map[string]any) (Expression, error) {
+	p := newParser(expression)
+	p.env = env
+	p.params = params
+	return p.parse()
+}
+
+// ParseWith lex's' the provided expression using the coercions and functions of the supplied Environment.
+func ParseWith(env *Environment, expression []byte) (Expression, error) {
+	return env.Parse(expression)
+}
@@ -0,0 +1,44 @@
+package ksql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironment(t *testing.T) {
+	assert := require.New(t)
+
+	tenantA := NewEnvironment()
+	tenantA.SetCoercion("_envstar_", func(_ *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
+		return constEligible, &Star{expression}, nil
+	})
+	tenantA.RemoveFunction("UPPER")
+
+	tenantB := tenantA.Clone()
+	tenantB.RemoveCoercion("_envstar_")
+
+	ex, err := ParseWith(tenantA, []byte(`COERCE "abc" _envstar_`))
+	assert.NoError(err)
+	result, err := ex.Calculate(nil)
+	assert.NoError(err)
+	assert.Equal("***", result)
+
+	_, err = ParseWith(tenantB, []byte(`COERCE "abc" _envstar_`))
+	assert.EqualError(err, "1:14: invalid COERCE data type `_envstar_`")
+
+	_, err = Parse([]byte(`COERCE "abc" _envstar_`))
+	assert.EqualError(err, "1:14: invalid COERCE data type `_envstar_`")
+
+	_, err = tenantA.Parse([]byte(`upper("abc")`))
+	assert.EqualError(err, "1:1: unknown function `upper`")
+
+	_, err = Parse([]byte(`upper("abc")`))
+	assert.NoError(err)
+
+	ex, err = tenantB.ParseWithParams([]byte(`lower($name)`), map[string]any{"name": "ABC"})
+	assert.NoError(err)
+	result, err = ex.Calculate(nil)
+	assert.NoError(err)
+	assert.Equal("abc", result)
+}
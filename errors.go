@@ -2,19 +2,143 @@ package ksql
 
 import (
 	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	optionext "github.com/go-playground/pkg/v5/values/option"
 )
 
+// ErrSyntax represents an error lexing or parsing an expression, describing where within the expression
+// the error occurred. All errors returned from Parse and Tokenizer.Next are of this type.
+type ErrSyntax struct {
+	// Offset is the byte offset of the offending token within the expression, or the expression length when
+	// the expression ended unexpectedly.
+	Offset int
+
+	// Line is the 1-based line number of Offset.
+	Line int
+
+	// Column is the 1-based column, in runes, of Offset within the line.
+	Column int
+
+	// Token is the text of the offending token, which is empty when the expression ended unexpectedly.
+	Token string
+
+	// Expected is the set of tokens that would have been valid at Offset, which may be empty if unknown.
+	Expected []TokenKind
+
+	// Err is the underlying error.
+	Err error
+
+	line string
+}
+
+func newErrSyntax(expression []byte, offset int, token string, expected []TokenKind, err error) ErrSyntax {
+	if offset > len(expression) {
+		offset = len(expression)
+	}
+	lineStart := strings.LastIndexByte(string(expression[:offset]), '\n') + 1
+	lineEnd := len(expression)
+	if i := strings.IndexByte(string(expression[offset:]), '\n'); i >= 0 {
+		lineEnd = offset + i
+	}
+	return ErrSyntax{
+		Offset:   offset,
+		Line:     strings.Count(string(expression[:offset]), "\n") + 1,
+		Column:   utf8.RuneCount(expression[lineStart:offset]) + 1,
+		Token:    token,
+		Expected: expected,
+		Err:      err,
+		line:     string(expression[lineStart:lineEnd]),
+	}
+}
+
+func (e ErrSyntax) Error() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "%d:%d: %s", e.Line, e.Column, e.Err)
+	if len(e.Expected) > 0 {
+		sb.WriteString(", expected ")
+		if len(e.Expected) > 1 {
+			sb.WriteString("one of ")
+		}
+		for i, kind := range e.Expected {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(kind.String())
+		}
+	}
+	return sb.String()
+}
+
+func (e ErrSyntax) Unwrap() error {
+	return e.Err
+}
+
+// Snippet returns the line of the expression containing the error with the offending token underlined by
+// carets on the following line eg.
+//
+//	.a == 1 && )
+//	           ^
+func (e ErrSyntax) Snippet() string {
+	var sb strings.Builder
+	sb.WriteString(e.line)
+	sb.WriteByte('\n')
+
+	// keep tabs so the carets line up with the line above
+	for i, r := range []rune(e.line) {
+		if i >= e.Column-1 {
+			break
+		}
+		if r == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	underline := utf8.RuneCountInString(e.Token)
+	if remaining := utf8.RuneCountInString(e.line) - (e.Column - 1); underline > remaining {
+		underline = remaining
+	}
+	if underline < 1 {
+		underline = 1
+	}
+	sb.WriteString(strings.Repeat("^", underline))
+	return sb.String()
+}
+
 // Lexer errors
 
+// lexerError is implemented by errors returned when lexing a token, to describe the error as an ErrSyntax.
+type lexerError interface {
+	error
+
+	// token returns the offending text.
+	token() string
+
+	// expected returns the token kind that was being lexed, if known.
+	expected() (TokenKind, bool)
+}
+
 // ErrUnsupportedCharacter represents an unsupported character is expression being lexed.
 type ErrUnsupportedCharacter struct {
-	b byte
+	b    byte
+	kind optionext.Option[TokenKind]
 }
 
 func (e ErrUnsupportedCharacter) Error() string {
 	return fmt.Sprintf("Unsupported Character `%s`", string(e.b))
 }
 
+func (e ErrUnsupportedCharacter) token() string { return string(e.b) }
+
+func (e ErrUnsupportedCharacter) expected() (TokenKind, bool) {
+	if e.kind.IsNone() {
+		return 0, false
+	}
+	return e.kind.Unwrap(), true
+}
+
 // ErrUnterminatedString represents an unterminated string
 type ErrUnterminatedString struct {
 	s string
@@ -24,6 +148,10 @@ func (e ErrUnterminatedString) Error() string {
 	return fmt.Sprintf("Unterminated string `%s`", e.s)
 }
 
+func (e ErrUnterminatedString) token() string { return e.s }
+
+func (e ErrUnterminatedString) expected() (TokenKind, bool) { return QuotedString, true }
+
 // ErrInvalidSelectorPath represents an invalid selector string
 type ErrInvalidSelectorPath struct {
 	s string
@@ -33,6 +161,10 @@ func (e ErrInvalidSelectorPath) Error() string {
 	return fmt.Sprintf("Invalid selector path `%s`", e.s)
 }
 
+func (e ErrInvalidSelectorPath) token() string { return e.s }
+
+func (e ErrInvalidSelectorPath) expected() (TokenKind, bool) { return SelectorPath, true }
+
 // ErrInvalidBool represents an invalid boolean
 type ErrInvalidBool struct {
 	s string
@@ -42,15 +174,24 @@ func (e ErrInvalidBool) Error() string {
 	return fmt.Sprintf("Invalid boolean `%s`", e.s)
 }
 
+func (e ErrInvalidBool) token() string { return e.s }
+
+func (e ErrInvalidBool) expected() (TokenKind, bool) { return 0, false }
+
 // ErrInvalidKeyword represents an invalid keyword keyword
 type ErrInvalidKeyword struct {
-	s string
+	s    string
+	kind TokenKind
 }
 
 func (e ErrInvalidKeyword) Error() string {
 	return fmt.Sprintf("Invalid keyword `%s`", e.s)
 }
 
+func (e ErrInvalidKeyword) token() string { return e.s }
+
+func (e ErrInvalidKeyword) expected() (TokenKind, bool) { return e.kind, true }
+
 // ErrInvalidNumber represents an invalid number
 type ErrInvalidNumber struct {
 	s string
@@ -60,6 +201,23 @@ func (e ErrInvalidNumber) Error() string {
 	return fmt.Sprintf("Invalid number `%s`", e.s)
 }
 
+func (e ErrInvalidNumber) token() string { return e.s }
+
+func (e ErrInvalidNumber) expected() (TokenKind, bool) { return Number, true }
+
+// ErrInvalidParameter represents an invalid named parameter
+type ErrInvalidParameter struct {
+	s string
+}
+
+func (e ErrInvalidParameter) Error() string {
+	return fmt.Sprintf("Invalid parameter `%s`", e.s)
+}
+
+func (e ErrInvalidParameter) token() string { return e.s }
+
+func (e ErrInvalidParameter) expected() (TokenKind, bool) { return Parameter, true }
+
 // Parser errors
 
 // ErrUnsupportedTypeComparison represents a comparison of incompatible types
@@ -80,6 +238,10 @@ func (e ErrInvalidIdentifier) Error() string {
 	return fmt.Sprintf("Invalid identifier `%s`", e.s)
 }
 
+func (e ErrInvalidIdentifier) token() string { return e.s }
+
+func (e ErrInvalidIdentifier) expected() (TokenKind, bool) { return Identifier, true }
+
 // ErrUnsupportedCoerce represents a comparison of incompatible types type casts
 type ErrUnsupportedCoerce struct {
 	s string
@@ -106,3 +268,156 @@ type ErrInvalidCoerce struct {
 func (e ErrInvalidCoerce) Error() string {
 	return fmt.Sprintf("invalid COERCE: `%s`", e.Err.Error())
 }
+
+// ErrUnboundParameter represents a named parameter that was calculated without a value being bound to it.
+type ErrUnboundParameter struct {
+	Name string
+}
+
+func (e ErrUnboundParameter) Error() string {
+	return fmt.Sprintf("unbound parameter `$%s`", e.Name)
+}
+
+// ErrUnsupportedParameter represents a value bound to a named parameter that is not of a supported type.
+type ErrUnsupportedParameter struct {
+	Name  string
+	Value any
+}
+
+func (e ErrUnsupportedParameter) Error() string {
+	return fmt.Sprintf("unsupported value for parameter `$%s`: %T", e.Name, e.Value)
+}
+
+// ErrFunctionArgument represents an argument of an unsupported type passed to a function.
+type ErrFunctionArgument struct {
+	// Function is the name of the function called.
+	Function string
+
+	// Index is the 0-based index of the argument.
+	Index int
+
+	// Expected is the set of types the argument accepts.
+	Expected ArgType
+
+	// Value is the value of the argument.
+	Value any
+}
+
+func (e ErrFunctionArgument) Error() string {
+	return fmt.Sprintf("invalid argument %d for function `%s`, expected %s found: %v", e.Index+1, e.Function, e.Expected, e.Value)
+}
+
+// ErrDivisionByZero represents the division of an exact number by zero.
+type ErrDivisionByZero struct{}
+
+func (e ErrDivisionByZero) Error() string {
+	return "division by zero"
+}
+
+// ErrInvalidRegex represents a MATCHES or `_regex_` pattern that is not a valid regular expression.
+type ErrInvalidRegex struct {
+	// Pattern is the invalid pattern.
+	Pattern string
+
+	// Err is the error compiling the pattern.
+	Err error
+}
+
+func (e ErrInvalidRegex) Error() string {
+	return fmt.Sprintf("invalid regular expression `%s`: %s", e.Pattern, e.Err)
+}
+
+func (e ErrInvalidRegex) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidPattern represents a LIKE, ILIKE or GLOB pattern that is not valid eg. an unterminated `[` class.
+type ErrInvalidPattern struct {
+	// Pattern is the invalid pattern.
+	Pattern string
+
+	// Err describes why the pattern is invalid.
+	Err error
+}
+
+func (e ErrInvalidPattern) Error() string {
+	return fmt.Sprintf("invalid pattern `%s`: %s", e.Pattern, e.Err)
+}
+
+func (e ErrInvalidPattern) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidDateTime represents a value that `_datetime_strict_` could not parse into a DateTime.
+type ErrInvalidDateTime struct {
+	// Value is the value that could not be parsed.
+	Value string
+
+	// Layout is the layout supplied to the coercion, if any.
+	Layout string
+
+	// Err is the error parsing the value.
+	Err error
+}
+
+func (e ErrInvalidDateTime) Error() string {
+	if e.Layout != "" {
+		return fmt.Sprintf("invalid DateTime `%s` for layout `%s`: %s", e.Value, e.Layout, e.Err)
+	}
+	return fmt.Sprintf("invalid DateTime `%s`: %s", e.Value, e.Err)
+}
+
+func (e ErrInvalidDateTime) Unwrap() error {
+	return e.Err
+}
+
+// ErrUnsupportedInputFormat represents an InputFormat that data can't be decoded from.
+type ErrUnsupportedInputFormat struct {
+	Format InputFormat
+}
+
+func (e ErrUnsupportedInputFormat) Error() string {
+	return fmt.Sprintf("unsupported input format `%s`", e.Format)
+}
+
+// ErrDecode represents data that could not be decoded from an InputFormat.
+type ErrDecode struct {
+	// Format is the format of the data.
+	Format InputFormat
+
+	// Err is the error decoding the data.
+	Err error
+}
+
+func (e ErrDecode) Error() string {
+	return fmt.Sprintf("decoding %s: %s", e.Format, e.Err)
+}
+
+func (e ErrDecode) Unwrap() error {
+	return e.Err
+}
+
+// ErrLimitExceeded represents a calculation exceeding one of the Limits supplied to CalculateWithLimits, or an
+// expression exceeding a limit of its ParseOptions, which is returned as the Err of an ErrSyntax.
+type ErrLimitExceeded struct {
+	// Limit is the limit exceeded.
+	Limit Limit
+
+	// Max is the value of the limit.
+	Max int
+}
+
+func (e ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("exceeded maximum %s of %d", e.Limit, e.Max)
+}
+
+// ErrUnknownField represents a selector path not declared by the JSON Schema an expression is checked against,
+// see Check.
+type ErrUnknownField struct {
+	// Path is the selector path eg. `.address.street`.
+	Path string
+}
+
+func (e ErrUnknownField) Error() string {
+	return fmt.Sprintf("unknown field `%s`", e.Path)
+}
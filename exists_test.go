@@ -0,0 +1,113 @@
+package ksql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExistsAndIsChecks(t *testing.T) {
+	assert := require.New(t)
+
+	const src = `{"value":1,"null":null,"empty":"","nested":{"null":null}}`
+
+	tests := []struct {
+		name     string
+		exp      string
+		expected any
+	}{
+		{name: "exists value", exp: `EXISTS .value`, expected: true},
+		{name: "exists null", exp: `EXISTS .null`, expected: true},
+		{name: "exists missing", exp: `EXISTS .missing`, expected: false},
+		{name: "exists nested null", exp: `EXISTS .nested.null`, expected: true},
+		{name: "exists negated", exp: `!EXISTS .missing`, expected: true},
+		{name: "exists parenthesised", exp: `EXISTS(.value) && !EXISTS(.missing)`, expected: true},
+		{name: "is null value", exp: `.value IS NULL`, expected: false},
+		{name: "is null null", exp: `.null IS NULL`, expected: true},
+		{name: "is null missing", exp: `.missing IS NULL`, expected: false},
+		{name: "is not null value", exp: `.value IS NOT NULL`, expected: true},
+		{name: "is not null empty string", exp: `.empty IS NOT NULL`, expected: true},
+		{name: "is not null null", exp: `.null IS NOT NULL`, expected: false},
+		{name: "is not null missing", exp: `.missing IS NOT NULL`, expected: false},
+		{name: "is missing value", exp: `.value IS MISSING`, expected: false},
+		{name: "is missing null", exp: `.null IS MISSING`, expected: false},
+		{name: "is missing missing", exp: `.missing IS MISSING`, expected: true},
+		{name: "is missing nested", exp: `.nested.missing IS MISSING`, expected: true},
+		{name: "is not missing null", exp: `.null IS NOT MISSING`, expected: true},
+		{name: "is not missing missing", exp: `.missing IS NOT MISSING`, expected: false},
+		{name: "equals null does not distinguish", exp: `.null == NULL && .missing == NULL`, expected: true},
+		{name: "expression is null", exp: `coalesce(.missing, .null) IS NULL`, expected: true},
+		{name: "expression is never missing", exp: `len(.missing) IS MISSING`, expected: false},
+		{name: "literal is not null", exp: `1 IS NOT NULL`, expected: true},
+		{name: "precedence", exp: `.null IS NULL && .value + 1 IS NOT NULL`, expected: true},
+		{name: "compared", exp: `.missing IS MISSING == true`, expected: true},
+		{name: "within condition", exp: `IF .value IS MISSING THEN 0 ELSE .value`, expected: 1.0},
+		{name: "multiple spaces", exp: `.null IS   NOT   NULL`, expected: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(src))
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestExistsAndIsChecksParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name string
+		exp  string
+		err  string
+	}{
+		{
+			name: "exists non selector",
+			exp:  `EXISTS 1`,
+			err:  "1:8: unexpected token `1`, expected selector path",
+		},
+		{
+			name: "is without null or missing",
+			exp:  `.a IS 1`,
+			err:  "1:7: unexpected token `1`, expected one of NULL, MISSING",
+		},
+		{
+			name: "is not at end",
+			exp:  `.a IS NOT `,
+			err:  "1:11: expression ends unexpectedly, expected one of NULL, MISSING",
+		},
+		{
+			name: "is at end",
+			exp:  `.a IS`,
+			err:  "1:6: expression ends unexpectedly, expected NULL, MISSING or NOT",
+		},
+		{
+			name: "is at end with whitespace",
+			exp:  `.a IS `,
+			err:  "1:7: expression ends unexpectedly, expected NULL, MISSING or NOT",
+		},
+		{
+			name: "is not at end without whitespace",
+			exp:  `.a IS NOT`,
+			err:  "1:10: expression ends unexpectedly, expected one of NULL, MISSING",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.exp))
+			assert.Error(err)
+			assert.Equal(tc.err, err.Error())
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package ksql
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Format returns the canonical text of a parsed expression.
+//
+// The canonical form uses a single space between values and operations, `==` for equality, negated
+// operators eg. `!=` over `!(... == ...)` and only the parenthesis required by operator precedence.
+// Chained coercions are output as a single COERCE eg. `COERCE .x _lowercase_,_substr_[0:3]`.
+// Parsing the formatted text results in an expression equal to the one formatted.
+//
+// Expressions not implemented by this package are formatted using fmt.Sprint.
+func Format(e Expression) string {
+	var sb strings.Builder
+	formatExpression(&sb, e)
+	return sb.String()
+}
+
+// coercionArgsFormatter is implemented by coercions that accept arguments, returning them as they are
+// written after the identifier eg. `[1:5]`.
+type coercionArgsFormatter interface {
+	formatArgs() string
+}
+
+// operatorText returns the text of the binary operator for a node kind, or "" if not a binary operator.
+func operatorText(kind NodeKind) string {
+	switch kind {
+	case NodeAdd:
+		return "+"
+	case NodeSubtract:
+		return "-"
+	case NodeMultiply:
+		return "*"
+	case NodeDivide:
+		return "/"
+	case NodeEquals:
+		return "=="
+	case NodeGt:
+		return ">"
+	case NodeGte:
+		return ">="
+	case NodeLt:
+		return "<"
+	case NodeLte:
+		return "<="
+	case NodeAnd:
+		return "&&"
+	case NodeOr:
+		return "||"
+	case NodeContains:
+		return "CONTAINS"
+	case NodeContainsAny:
+		return "CONTAINS_ANY"
+	case NodeContainsAll:
+		return "CONTAINS_ALL"
+	case NodeIn:
+		return "IN"
+	case NodeStartsWith:
+		return "STARTSWITH"
+	case NodeEndsWith:
+		return "ENDSWITH"
+	case NodeMatches:
+		return "MATCHES"
+	case NodeIMatches:
+		return "IMATCHES"
+	case NodeLike:
+		return "LIKE"
+	case NodeILike:
+		return "ILIKE"
+	case NodeGlob:
+		return "GLOB"
+	case NodeBetween:
+		return "BETWEEN"
+	default:
+		return ""
+	}
+}
+
+// nodePrecedence returns the precedence the expression is formatted with, values and prefix
+// operations bind tighter than any binary operation.
+func nodePrecedence(e Expression) uint8 {
+	switch kind := KindOf(e); kind {
+	case NodeOr:
+		return precedenceOr
+	case NodeAnd:
+		return precedenceAnd
+	case NodeEquals, NodeGt, NodeGte, NodeLt, NodeLte, NodeIsNull, NodeIsNotNull, NodeIsMissing, NodeIsNotMissing:
+		return precedenceComparison
+	case NodeContains, NodeContainsAny, NodeContainsAll, NodeIn, NodeStartsWith, NodeEndsWith, NodeMatches, NodeIMatches, NodeLike, NodeILike, NodeGlob, NodeBetween:
+		return precedenceStringArray
+	case NodeAdd, NodeSubtract:
+		return precedenceAdditive
+	case NodeMultiply, NodeDivide:
+		return precedenceMultiplicative
+	case NodeNot:
+		if negated := ChildrenOf(e)[0]; isNegatableOperation(negated) {
+			return nodePrecedence(negated)
+		}
+		return precedenceMultiplicative + 1
+	case NodeIf:
+		// the ELSE value extends as far as possible so an IF must be parenthesised when an operand
+		return precedenceNone
+	default:
+		return precedenceMultiplicative + 1
+	}
+}
+
+// isNegatableOperation returns if the expression is formatted using a negated operator eg. `!=` when
+// wrapped by a `!`.
+func isNegatableOperation(e Expression) bool {
+	switch KindOf(e) {
+	case NodeEquals, NodeGt, NodeGte, NodeLt, NodeLte,
+		NodeContains, NodeContainsAny, NodeContainsAll, NodeIn, NodeStartsWith, NodeEndsWith, NodeMatches, NodeIMatches, NodeLike, NodeILike, NodeGlob, NodeBetween:
+		return true
+	default:
+		return false
+	}
+}
+
+// formatOperand formats a child expression, wrapping it in parenthesis if it binds looser than
+// minPrecedence.
+func formatOperand(sb *strings.Builder, e Expression, minPrecedence uint8) {
+	if nodePrecedence(e) < minPrecedence {
+		sb.WriteByte('(')
+		formatExpression(sb, e)
+		sb.WriteByte(')')
+		return
+	}
+	formatExpression(sb, e)
+}
+
+func formatExpression(sb *strings.Builder, e Expression) {
+	n, ok := e.(Node)
+	if !ok {
+		sb.WriteString(fmt.Sprint(e))
+		return
+	}
+
+	switch kind := n.Kind(); kind {
+	case NodeNull, NodeBool, NodeNumber, NodeString:
+		formatLiteral(sb, n.(Literal).Value())
+
+	case NodeSelectorPath:
+		sb.WriteByte('.')
+		sb.WriteString(n.(Selector).Path())
+
+	case NodeExists:
+		sb.WriteString("EXISTS .")
+		sb.WriteString(n.(Selector).Path())
+
+	case NodeIsNull, NodeIsNotNull, NodeIsMissing, NodeIsNotMissing:
+		formatOperand(sb, n.Children()[0], precedenceComparison)
+		sb.WriteString(isCheckText(kind))
+
+	case NodeParameter:
+		sb.WriteByte('$')
+		sb.WriteString(n.(NamedParameter).ParameterName())
+
+	case NodeArray:
+		sb.WriteByte('[')
+		formatList(sb, n.Children())
+		sb.WriteByte(']')
+
+	case NodeObject:
+		sb.WriteByte('{')
+		for i, v := range n.Children() {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(quoteString(n.(Object).Keys()[i]))
+			sb.WriteString(": ")
+			formatExpression(sb, v)
+		}
+		sb.WriteByte('}')
+
+	case NodeCall:
+		sb.WriteString(n.(Call).FunctionName())
+		sb.WriteByte('(')
+		formatList(sb, n.Children())
+		sb.WriteByte(')')
+
+	case NodeNot:
+		value := n.Children()[0]
+		if isNegatableOperation(value) {
+			formatBinary(sb, value, "!")
+			return
+		}
+		sb.WriteByte('!')
+		formatOperand(sb, value, precedenceMultiplicative+1)
+
+	case NodeCoerce:
+		formatCoerce(sb, n.(Coercion))
+
+	case NodeIf, NodeCase:
+		formatConditional(sb, n)
+
+	case NodeAny, NodeAll, NodeNone:
+		children := n.Children()
+		sb.WriteString(strings.ToUpper(kind.String()))
+		sb.WriteByte(' ')
+		formatOperand(sb, children[0], precedenceMultiplicative+1)
+		sb.WriteString(" (")
+		formatExpression(sb, children[1])
+		sb.WriteByte(')')
+
+	default:
+		formatBinary(sb, n, "")
+	}
+}
+
+// isCheckText returns the text following the value of an IS check.
+func isCheckText(kind NodeKind) string {
+	switch kind {
+	case NodeIsNull:
+		return " IS NULL"
+	case NodeIsNotNull:
+		return " IS NOT NULL"
+	case NodeIsMissing:
+		return " IS MISSING"
+	default:
+		return " IS NOT MISSING"
+	}
+}
+
+// formatConditional formats an IF or CASE, whose branches are delimited by keywords and so never require
+// parenthesis.
+func formatConditional(sb *strings.Builder, n Node) {
+	children := n.Children()
+	if n.Kind() == NodeIf {
+		sb.WriteString("IF ")
+		formatExpression(sb, children[0])
+		sb.WriteString(" THEN ")
+		formatExpression(sb, children[1])
+		sb.WriteString(" ELSE ")
+		formatExpression(sb, children[2])
+		return
+	}
+
+	sb.WriteString("CASE")
+	for i := 0; i+1 < len(children); i += 2 {
+		sb.WriteString(" WHEN ")
+		formatExpression(sb, children[i])
+		sb.WriteString(" THEN ")
+		formatExpression(sb, children[i+1])
+	}
+	if len(children)%2 == 1 {
+		sb.WriteString(" ELSE ")
+		formatExpression(sb, children[len(children)-1])
+	}
+	sb.WriteString(" END")
+}
+
+// formatList formats comma separated array elements or function arguments.
+func formatList(sb *strings.Builder, values []Expression) {
+	for i, v := range values {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		formatExpression(sb, v)
+	}
+}
+
+// formatBinary formats a binary operation, prefixing the operator with the supplied prefix.
+func formatBinary(sb *strings.Builder, n Expression, prefix string) {
+	precedence := nodePrecedence(n)
+	children := ChildrenOf(n)
+	kind := KindOf(n)
+
+	formatOperand(sb, children[0], precedence)
+	sb.WriteByte(' ')
+	if prefix != "" && kind == NodeEquals {
+		sb.WriteString("!=")
+	} else {
+		sb.WriteString(prefix)
+		sb.WriteString(operatorText(kind))
+	}
+	sb.WriteByte(' ')
+
+	if kind == NodeBetween {
+		formatOperand(sb, children[1], precedenceAdditive)
+		sb.WriteByte(' ')
+		formatOperand(sb, children[2], precedenceAdditive)
+		return
+	}
+	// operators are left-associative so the same precedence on the right must keep its parenthesis
+	formatOperand(sb, children[1], precedence+1)
+	if l, ok := n.(like); ok && l.kind != NodeGlob && l.escape != '\\' {
+		sb.WriteString(" ESCAPE ")
+		sb.WriteString(quoteString(string(l.escape)))
+	}
+}
+
+func formatCoerce(sb *strings.Builder, c Coercion) {
+	// unwind the chain, the innermost coercion is applied first
+	chain := []Coercion{c}
+	value := coercedValue(c)
+	for {
+		inner, ok := value.(Coercion)
+		if !ok {
+			break
+		}
+		chain = append(chain, inner)
+		value = coercedValue(inner)
+	}
+
+	sb.WriteString("COERCE ")
+	formatOperand(sb, value, precedenceMultiplicative+1)
+	sb.WriteByte(' ')
+	for i := len(chain) - 1; i >= 0; i-- {
+		sb.WriteString(chain[i].Name())
+		if f, ok := chain[i].(coercionArgsFormatter); ok {
+			sb.WriteString(f.formatArgs())
+		}
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+	}
+}
+
+// coercedValue returns the value a coercion is applied to, which isn't a child of a custom coercion.
+func coercedValue(c Coercion) Expression {
+	if custom, ok := c.(coerceCustom); ok {
+		return custom.value
+	}
+	return c.Children()[0]
+}
+
+func formatLiteral(sb *strings.Builder, value any) {
+	switch v := value.(type) {
+	case nil:
+		sb.WriteString("NULL")
+	case bool:
+		sb.WriteString(strconv.FormatBool(v))
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if len(s) > 21 {
+			s = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		sb.WriteString(s)
+	case int64, *big.Int, *big.Rat:
+		sb.WriteString(formatExactNumber(v))
+	case string:
+		sb.WriteString(quoteString(v))
+	default:
+		sb.WriteString(fmt.Sprint(v))
+	}
+}
+
+// quoteString quotes a string literal so that it lexes back to the same string, preferring double quotes.
+func quoteString(s string) string {
+	for _, quote := range []byte{'"', '\''} {
+		quoted := string(quote) + s + string(quote)
+		if result, err := tokenizeString([]byte(quoted), quote); err == nil && int(result.len) == len(quoted) {
+			return quoted
+		}
+	}
+	return `"` + s + `"`
+}
+
+func (c coerceSubstr) formatArgs() string {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	if c.start.IsSome() {
+		sb.WriteString(strconv.Itoa(c.start.Unwrap()))
+	}
+	sb.WriteByte(':')
+	if c.end.IsSome() {
+		sb.WriteString(strconv.Itoa(c.end.Unwrap()))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+func (c coerceRegex) formatArgs() string {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	sb.WriteString(quoteString(c.pattern))
+	switch g := c.group.(type) {
+	case int:
+		sb.WriteString(", ")
+		sb.WriteString(strconv.Itoa(g))
+	case string:
+		sb.WriteString(", ")
+		sb.WriteString(quoteString(g))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+func (c coerceDateTime) formatArgs() string {
+	args := c.Args()
+	if len(args) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, arg := range args {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quoteString(arg.(string)))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+// formatArgs returns the text of the arguments the custom coercion read when parsed.
+func (c coerceCustom) formatArgs() string {
+	return c.args
+}
+
+func (c coercedConstant) formatArgs() string {
+	if f, ok := c.expression.(coercionArgsFormatter); ok {
+		return f.formatArgs()
+	}
+	return ""
+}
@@ -0,0 +1,258 @@
+package ksql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		expected string
+	}{
+		{
+			name:     "spacing",
+			exp:      `.a   +  1`,
+			expected: `.a + 1`,
+		},
+		{
+			name:     "single equals",
+			exp:      `.a = 1`,
+			expected: `.a == 1`,
+		},
+		{
+			name:     "redundant parenthesis",
+			exp:      `(.a * 2) + (.b)`,
+			expected: `.a * 2 + .b`,
+		},
+		{
+			name:     "required parenthesis",
+			exp:      `(.a + 2) * .b`,
+			expected: `(.a + 2) * .b`,
+		},
+		{
+			name:     "right associativity parenthesis kept",
+			exp:      `10 - (4 - 3)`,
+			expected: `10 - (4 - 3)`,
+		},
+		{
+			name:     "left associativity parenthesis removed",
+			exp:      `(10 - 4) - 3`,
+			expected: `10 - 4 - 3`,
+		},
+		{
+			name:     "logical",
+			exp:      `(.a == 1 && .b == 2) || (.c == 3)`,
+			expected: `.a == 1 && .b == 2 || .c == 3`,
+		},
+		{
+			name:     "or within and",
+			exp:      `.a && (.b || .c)`,
+			expected: `.a && (.b || .c)`,
+		},
+		{
+			name:     "negated comparison",
+			exp:      `!(.a == 1)`,
+			expected: `.a != 1`,
+		},
+		{
+			name:     "negated operator",
+			exp:      `.a   !CONTAINS_ANY   ["a","b"]`,
+			expected: `.a !CONTAINS_ANY ["a", "b"]`,
+		},
+		{
+			name:     "prefix not",
+			exp:      `!.a`,
+			expected: `!.a`,
+		},
+		{
+			name:     "prefix not on logical",
+			exp:      `!(.a && .b)`,
+			expected: `!(.a && .b)`,
+		},
+		{
+			name:     "double negation",
+			exp:      `!(.a != .b)`,
+			expected: `!(.a != .b)`,
+		},
+		{
+			name:     "between",
+			exp:      `.a BETWEEN (1) (.b + 1)`,
+			expected: `.a BETWEEN 1 .b + 1`,
+		},
+		{
+			name:     "literals",
+			exp:      `[NULL,true,false,1e3,-0.5,"s",'d"q']`,
+			expected: `[NULL, true, false, 1000, -0.5, "s", 'd"q']`,
+		},
+		{
+			name:     "selectors in array",
+			exp:      `[.a ,.b ]`,
+			expected: `[.a, .b]`,
+		},
+		{
+			name:     "selector followed by value in array",
+			exp:      `[.x,2]`,
+			expected: `[.x, 2]`,
+		},
+		{
+			name:     "coerce chain",
+			exp:      `COERCE .x _lowercase_,_substr_[0:3]`,
+			expected: `COERCE .x _lowercase_,_substr_[0:3]`,
+		},
+		{
+			name:     "nested coerce merged",
+			exp:      `COERCE (COERCE .x _lowercase_) _substr_[:3]`,
+			expected: `COERCE .x _lowercase_,_substr_[:3]`,
+		},
+		{
+			name:     "coerce constant",
+			exp:      `COERCE "2022-01-02" _datetime_ > COERCE .x _datetime_`,
+			expected: `COERCE "2022-01-02" _datetime_ > COERCE .x _datetime_`,
+		},
+		{
+			name:     "function call",
+			exp:      `MAX( .a ,.b ,1 + 2 )`,
+			expected: `max(.a, .b, 1 + 2)`,
+		},
+		{
+			name:     "function without arguments",
+			exp:      `now( ) > COERCE .dt _datetime_`,
+			expected: `now() > COERCE .dt _datetime_`,
+		},
+		{
+			name:     "coerce expression",
+			exp:      `COERCE (.a + .b) _string_`,
+			expected: `COERCE (.a + .b) _string_`,
+		},
+		{
+			name:     "matches",
+			exp:      `.a  IMATCHES   "^a\d+" && .b !MATCHES .c`,
+			expected: `.a IMATCHES "^a\d+" && .b !MATCHES .c`,
+		},
+		{
+			name:     "if",
+			exp:      `IF   .a THEN 1 ELSE (2 + 3)`,
+			expected: `IF .a THEN 1 ELSE 2 + 3`,
+		},
+		{
+			name:     "if operand",
+			exp:      `(IF .a THEN 1 ELSE 2) + 3`,
+			expected: `(IF .a THEN 1 ELSE 2) + 3`,
+		},
+		{
+			name:     "case",
+			exp:      `CASE WHEN .a THEN 1 WHEN (.b) THEN 2 END  == 1`,
+			expected: `CASE WHEN .a THEN 1 WHEN .b THEN 2 END == 1`,
+		},
+		{
+			name:     "is checks",
+			exp:      `.a IS  NOT NULL && (.b IS MISSING) && EXISTS .c`,
+			expected: `.a IS NOT NULL && .b IS MISSING && EXISTS .c`,
+		},
+		{
+			name:     "quantifiers",
+			exp:      `ANY  .items  ( (.qty > 10) ) && NONE (.a) (.b)`,
+			expected: `ANY .items (.qty > 10) && NONE .a (.b)`,
+		},
+		{
+			name:     "regex coercion",
+			exp:      `COERCE .v _regex_[ 'v(?P<major>\d+)' ,  "major" ]`,
+			expected: `COERCE .v _regex_["v(?P<major>\d+)", "major"]`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+			assert.Equal(tc.expected, Format(ex))
+		})
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	assert := require.New(t)
+
+	expressions := []string{
+		`.f1 + .f2`,
+		`.field1 + " " + .field2`,
+		`1 + 2 * 3 - 4 / 5`,
+		`(1 + 2) * (3 - 4) / 5`,
+		`10 - (4 - 3)`,
+		`8 / (4 / 2)`,
+		`.a == 1 && .b == 2 || .c == 3`,
+		`.a == 1 && (.b == 2 || .c == 3)`,
+		`!(.f1 != .f2) && !.f2`,
+		`!(.f1 && .f2)`,
+		`.properties.employees !> 50`,
+		`["a","b","c"] !CONTAINS_ALL ["a","b"]`,
+		`.field1 IN ["test","foo","bar",]`,
+		`"team" CONTAINS "ea" == false`,
+		`("a" IN ["a"]) IN [true]`,
+		`COERCE .dt1 _datetime_ == COERCE "2022-07-14T17:50:08.318426001Z" _datetime_`,
+		`COERCE "2022-01-02" _datetime_ BETWEEN COERCE "2022-01-01" _datetime_ COERCE "2022-01-30" _datetime_`,
+		`.a BETWEEN .b - 1 (.c)`,
+		`(.a BETWEEN 1 2) BETWEEN true true`,
+		`COERCE .name _uppercase_,_title_`,
+		`COERCE .name _substr_[4:] + COERCE "Joeybloggs" _substr_[3:5]`,
+		`COERCE "ABC" _lowercase_,_uppercase_`,
+		`-1e-3 == -0.001`,
+		`1e300 > 1e-300`,
+		`[.a, [1, [.b]], 'x']`,
+		`.MyValue != NULL && .MyValue > 19`,
+		`.age >= $min_age && COERCE $name _lowercase_ IN $names`,
+		`.email MATCHES "@example\.com$" || .email IMATCHES .pattern`,
+		`.email LIKE "%@example.com" && .name !ILIKE "jo_y" && .path GLOB "/api/[a-z]*/users"`,
+		`.s LIKE "100!%" ESCAPE "!" && .t !ILIKE .prefix + "#_" ESCAPE "#" || .u LIKE "a\%"`,
+		`IF .a > 1 THEN [IF .b THEN 1 ELSE 2, 3] ELSE CASE WHEN .c THEN "c" ELSE NULL END`,
+		`!(IF .a THEN true ELSE false) && 1 + (IF .b THEN 1 ELSE 2) == 2`,
+		`.a IS NULL == false || .b + 1 IS NOT MISSING || (.c IS NOT NULL) IN [true] || !EXISTS .d`,
+		`ANY .items (.qty > 10 && ALL .tags (.@this != "x")) || !NONE [1, 2] (.@this == 1)`,
+		`COERCE .v _regex_["(\d+)\.(\d+)", 2],_number_ > 1`,
+		`{"id": .id, "total": .price * .qty, "tags": [.a, .b], "nested": {}, "multi": .{a,b}}`,
+		`COERCE .a _datetime_["02/01/2006", "Europe/Berlin"] > COERCE .b _datetime_strict_[""],_string_ && COERCE "01/02/2022" _datetime_["02/01/2006"] > COERCE .c _datetime_strict_`,
+	}
+
+	for _, exp := range expressions {
+		exp := exp
+		t.Run(exp, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(exp))
+			assert.NoError(err)
+
+			formatted := Format(ex)
+			reparsed, err := Parse([]byte(formatted))
+			assert.NoError(err, formatted)
+			assert.Equal(ex, reparsed, formatted)
+			assert.Equal(formatted, Format(reparsed))
+		})
+	}
+}
+
+func TestFormatCustomCoercionArgs(t *testing.T) {
+	assert := require.New(t)
+
+	env := repEnvironment()
+	ex, err := ParseWith(env, []byte(`COERCE .name _rep_[2],_lowercase_ == "abab"`))
+	assert.NoError(err)
+
+	formatted := Format(ex)
+	assert.Equal(`COERCE .name _rep_[2],_lowercase_ == "abab"`, formatted)
+
+	reparsed, err := ParseWith(env, []byte(formatted))
+	assert.NoError(err)
+	assert.Equal(formatted, Format(reparsed))
+
+	result, err := reparsed.Calculate([]byte(`{"name":"AB"}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
@@ -0,0 +1,392 @@
+package ksql
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	syncext "github.com/go-playground/pkg/v5/sync"
+)
+
+// ArgType is a set of the value types a function argument accepts.
+type ArgType uint8
+
+const (
+	ArgNull ArgType = 1 << iota
+	ArgBool
+	ArgNumber
+	ArgString
+	ArgArray
+	ArgObject
+	ArgDateTime
+	ArgDuration
+
+	// ArgAny accepts a value of any type, including those returned by custom coercions.
+	ArgAny ArgType = math.MaxUint8
+)
+
+var argTypeNames = []struct {
+	t    ArgType
+	name string
+}{
+	{ArgNull, "null"},
+	{ArgBool, "bool"},
+	{ArgNumber, "number"},
+	{ArgString, "string"},
+	{ArgArray, "array"},
+	{ArgObject, "object"},
+	{ArgDateTime, "datetime"},
+	{ArgDuration, "duration"},
+}
+
+// String returns the names of the types within the set eg. `string|array`.
+func (t ArgType) String() string {
+	if t == ArgAny {
+		return "any"
+	}
+	var names []string
+	for _, n := range argTypeNames {
+		if t&n.t != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// argTypeOf returns the ArgType of a calculated value, or 0 for a type not produced by this package.
+func argTypeOf(value any) ArgType {
+	switch value.(type) {
+	case nil:
+		return ArgNull
+	case bool:
+		return ArgBool
+	case float64, int64, *big.Int, *big.Rat:
+		return ArgNumber
+	case string:
+		return ArgString
+	case []any:
+		return ArgArray
+	case map[string]any:
+		return ArgObject
+	case time.Time:
+		return ArgDateTime
+	case time.Duration:
+		return ArgDuration
+	default:
+		return 0
+	}
+}
+
+// Function describes a function that can be called from an expression eg. `len(.name)`, see Functions.
+type Function struct {
+	// MinArgs is the minimum number of arguments the function must be called with.
+	MinArgs int
+
+	// MaxArgs is the maximum number of arguments the function can be called with, or -1 for no maximum.
+	MaxArgs int
+
+	// Args are the types accepted by each argument, the last of which also applies to any further
+	// arguments. Arguments are checked before calling Fn, which is not called if an argument that does not
+	// accept ArgNull is NULL, the result being NULL instead. No arguments are checked when empty.
+	//
+	// Exact numbers, see ParseOptions.ExactNumbers, are passed to Fn as float64 unless the argument is ArgAny.
+	Args []ArgType
+
+	// Pure reports if the function always returns the same result for the same arguments, allowing calls
+	// whose arguments are all constant to be calculated once at parse time.
+	Pure bool
+
+	// Fn calculates the result of the function from its arguments.
+	Fn func(args []any) (any, error)
+}
+
+func (f Function) argType(i int) ArgType {
+	switch {
+	case len(f.Args) == 0:
+		return ArgAny
+	case i < len(f.Args):
+		return f.Args[i]
+	default:
+		return f.Args[len(f.Args)-1]
+	}
+}
+
+// checkArity returns an error if the function can't be called with the supplied number of arguments.
+func (f Function) checkArity(name string, n int) error {
+	switch {
+	case f.MinArgs == f.MaxArgs && n != f.MinArgs:
+		return fmt.Errorf("function `%s` expects %d argument(s), found %d", name, f.MinArgs, n)
+	case n < f.MinArgs:
+		return fmt.Errorf("function `%s` expects at least %d argument(s), found %d", name, f.MinArgs, n)
+	case f.MaxArgs >= 0 && n > f.MaxArgs:
+		return fmt.Errorf("function `%s` expects at most %d argument(s), found %d", name, f.MaxArgs, n)
+	default:
+		return nil
+	}
+}
+
+// call checks the calculated arguments against the declared types before calling the function.
+func (f Function) call(name string, args []any) (any, error) {
+	for i, arg := range args {
+		t := f.argType(i)
+		if t == ArgAny {
+			continue
+		}
+		if arg == nil && t&ArgNull == 0 {
+			return nil, nil
+		}
+		if argTypeOf(arg)&t == 0 {
+			return nil, ErrFunctionArgument{Function: name, Index: i, Expected: t, Value: arg}
+		}
+		if isExactNumber(arg) {
+			args[i] = toFloat(arg)
+		}
+	}
+	return f.Fn(args)
+}
+
+// foldCall calculates a call to a pure function whose arguments are all constant.
+func foldCall(c call) (Expression, error) {
+	if !c.fn.Pure {
+		return c, nil
+	}
+	for _, arg := range c.args {
+		if _, ok := arg.(Literal); !ok {
+			return c, nil
+		}
+	}
+	result, err := c.Calculate([]byte{})
+	if err != nil {
+		return nil, err
+	}
+	return calledConstant{value: result, call: c}, nil
+}
+
+// NowFunction returns the `now()` function using the supplied clock, allowing the current DateTime to be
+// controlled eg. within tests using Environment.SetFunction.
+func NowFunction(clock func() time.Time) Function {
+	return Function{
+		MinArgs: 0, MaxArgs: 0,
+		Fn: func(_ []any) (any, error) {
+			return clock(), nil
+		},
+	}
+}
+
+// dateTimePart returns a function extracting a number from a DateTime eg. its year.
+func dateTimePart(part func(t time.Time) float64) Function {
+	return Function{
+		MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgDateTime}, Pure: true,
+		Fn: func(args []any) (any, error) {
+			return part(args[0].(time.Time)), nil
+		},
+	}
+}
+
+var (
+	// Functions is a `map` of all functions, keyed by their lowercase name, guarded by a Mutex for use
+	// allowing registration, removal or even replacing of existing functions. Function names are case
+	// insensitive within expressions. These are the functions used by Parse and copied by NewEnvironment.
+	Functions = syncext.NewRWMutex2(map[string]Function{
+		"len": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgString | ArgArray | ArgObject}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				switch v := args[0].(type) {
+				case string:
+					return float64(utf8.RuneCountInString(v)), nil
+				case []any:
+					return float64(len(v)), nil
+				default:
+					return float64(len(v.(map[string]any))), nil
+				}
+			},
+		},
+		"lower": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgString}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				return strings.ToLower(args[0].(string)), nil
+			},
+		},
+		"upper": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgString}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				return strings.ToUpper(args[0].(string)), nil
+			},
+		},
+		"trim": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgString}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				return strings.TrimSpace(args[0].(string)), nil
+			},
+		},
+		"split": {
+			MinArgs: 2, MaxArgs: 2, Args: []ArgType{ArgString, ArgString}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				parts := strings.Split(args[0].(string), args[1].(string))
+				arr := make([]any, len(parts))
+				for i, part := range parts {
+					arr[i] = part
+				}
+				return arr, nil
+			},
+		},
+		"join": {
+			MinArgs: 2, MaxArgs: 2, Args: []ArgType{ArgArray, ArgString}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				arr := args[0].([]any)
+				parts := make([]string, len(arr))
+				for i, v := range arr {
+					s, ok := v.(string)
+					if !ok {
+						return nil, ErrFunctionArgument{Function: "join", Index: 0, Expected: ArgString, Value: v}
+					}
+					parts[i] = s
+				}
+				return strings.Join(parts, args[1].(string)), nil
+			},
+		},
+		"replace": {
+			MinArgs: 3, MaxArgs: 3, Args: []ArgType{ArgString, ArgString, ArgString}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				return strings.ReplaceAll(args[0].(string), args[1].(string), args[2].(string)), nil
+			},
+		},
+		"abs": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgNumber}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				return math.Abs(args[0].(float64)), nil
+			},
+		},
+		"round": {
+			MinArgs: 1, MaxArgs: 2, Args: []ArgType{ArgNumber, ArgNumber}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				if len(args) == 1 {
+					return math.Round(args[0].(float64)), nil
+				}
+				// round to the supplied number of decimal places
+				pow := math.Pow(10, math.Trunc(args[1].(float64)))
+				return math.Round(args[0].(float64)*pow) / pow, nil
+			},
+		},
+		"floor": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgNumber}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				return math.Floor(args[0].(float64)), nil
+			},
+		},
+		"ceil": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgNumber}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				return math.Ceil(args[0].(float64)), nil
+			},
+		},
+		"min": {
+			MinArgs: 1, MaxArgs: -1, Args: []ArgType{ArgNumber | ArgArray}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				if arr, ok := args[0].([]any); ok && len(args) == 1 {
+					return extremeElement("min", arr, false)
+				}
+				result, err := numberArg("min", args, 0)
+				if err != nil {
+					return nil, err
+				}
+				for i := range args[1:] {
+					n, err := numberArg("min", args, i+1)
+					if err != nil {
+						return nil, err
+					}
+					result = math.Min(result, n)
+				}
+				return result, nil
+			},
+		},
+		"max": {
+			MinArgs: 1, MaxArgs: -1, Args: []ArgType{ArgNumber | ArgArray}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				if arr, ok := args[0].([]any); ok && len(args) == 1 {
+					return extremeElement("max", arr, true)
+				}
+				result, err := numberArg("max", args, 0)
+				if err != nil {
+					return nil, err
+				}
+				for i := range args[1:] {
+					n, err := numberArg("max", args, i+1)
+					if err != nil {
+						return nil, err
+					}
+					result = math.Max(result, n)
+				}
+				return result, nil
+			},
+		},
+		"count": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgArray | ArgNull}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				var n float64
+				arr, _ := args[0].([]any)
+				for _, v := range arr {
+					if v != nil {
+						n++
+					}
+				}
+				return n, nil
+			},
+		},
+		"sum": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgArray}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				sum, n, err := sumElements("sum", args[0].([]any))
+				if err != nil || n == 0 {
+					return nil, err
+				}
+				return sum, nil
+			},
+		},
+		"avg": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgArray}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				return averageElements("avg", args[0].([]any))
+			},
+		},
+		"distinct": {
+			MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgArray}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				return distinctElements(args[0].([]any)), nil
+			},
+		},
+		"sort": {
+			MinArgs: 1, MaxArgs: 2, Args: []ArgType{ArgArray, ArgString}, Pure: true,
+			Fn: func(args []any) (any, error) {
+				order := "asc"
+				if len(args) == 2 {
+					order = args[1].(string)
+				}
+				return sortElements("sort", args[0].([]any), order)
+			},
+		},
+		"coalesce": {
+			MinArgs: 1, MaxArgs: -1, Pure: true,
+			Fn: func(args []any) (any, error) {
+				for _, arg := range args {
+					if arg != nil {
+						return arg, nil
+					}
+				}
+				return nil, nil
+			},
+		},
+		"now":     NowFunction(time.Now),
+		"year":    dateTimePart(func(t time.Time) float64 { return float64(t.Year()) }),
+		"month":   dateTimePart(func(t time.Time) float64 { return float64(t.Month()) }),
+		"day":     dateTimePart(func(t time.Time) float64 { return float64(t.Day()) }),
+		"weekday": dateTimePart(func(t time.Time) float64 { return float64(t.Weekday()) }),
+		"hour":    dateTimePart(func(t time.Time) float64 { return float64(t.Hour()) }),
+		"minute":  dateTimePart(func(t time.Time) float64 { return float64(t.Minute()) }),
+		"second":  dateTimePart(func(t time.Time) float64 { return float64(t.Second()) }),
+		"unix":    dateTimePart(func(t time.Time) float64 { return float64(t.Unix()) }),
+	})
+)
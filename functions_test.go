@@ -0,0 +1,308 @@
+package ksql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunctions(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		src      string
+		expected any
+		err      error
+	}{
+		{
+			name:     "len string",
+			exp:      `len(.name)`,
+			src:      `{"name":"Jöey"}`,
+			expected: 4.0,
+		},
+		{
+			name:     "len array",
+			exp:      `len(.tags) > 1`,
+			src:      `{"tags":["a","b"]}`,
+			expected: true,
+		},
+		{
+			name:     "len object",
+			exp:      `len(.props)`,
+			src:      `{"props":{"a":1}}`,
+			expected: 1.0,
+		},
+		{
+			name:     "len missing is null",
+			exp:      `len(.missing)`,
+			src:      `{}`,
+			expected: nil,
+		},
+		{
+			name: "len number",
+			exp:  `len(.n)`,
+			src:  `{"n":1}`,
+			err:  ErrFunctionArgument{Function: "len", Index: 0, Expected: ArgString | ArgArray | ArgObject, Value: 1.0},
+		},
+		{
+			name:     "lower",
+			exp:      `lower(.name) == "joey"`,
+			src:      `{"name":"JoEy"}`,
+			expected: true,
+		},
+		{
+			name:     "upper",
+			exp:      `upper(.name)`,
+			src:      `{"name":"JoEy"}`,
+			expected: "JOEY",
+		},
+		{
+			name:     "trim",
+			exp:      `trim(.name)`,
+			src:      `{"name":"  Joey \t"}`,
+			expected: "Joey",
+		},
+		{
+			name:     "split",
+			exp:      `split(.csv, ",")`,
+			src:      `{"csv":"a,b,c"}`,
+			expected: []any{"a", "b", "c"},
+		},
+		{
+			name:     "join",
+			exp:      `join(.tags, "-")`,
+			src:      `{"tags":["a","b"]}`,
+			expected: "a-b",
+		},
+		{
+			name: "join non string",
+			exp:  `join(.tags, "-")`,
+			src:  `{"tags":["a",1]}`,
+			err:  ErrFunctionArgument{Function: "join", Index: 0, Expected: ArgString, Value: 1.0},
+		},
+		{
+			name:     "replace",
+			exp:      `replace(.name, "o", "0")`,
+			src:      `{"name":"foo"}`,
+			expected: "f00",
+		},
+		{
+			name:     "abs",
+			exp:      `abs(.n - 10)`,
+			src:      `{"n":4}`,
+			expected: 6.0,
+		},
+		{
+			name:     "round",
+			exp:      `round(.n)`,
+			src:      `{"n":2.5}`,
+			expected: 3.0,
+		},
+		{
+			name:     "round places",
+			exp:      `round(.n, 2)`,
+			src:      `{"n":2.345}`,
+			expected: 2.35,
+		},
+		{
+			name:     "floor",
+			exp:      `floor(.n)`,
+			src:      `{"n":-2.5}`,
+			expected: -3.0,
+		},
+		{
+			name:     "ceil",
+			exp:      `ceil(.n)`,
+			src:      `{"n":2.1}`,
+			expected: 3.0,
+		},
+		{
+			name:     "min",
+			exp:      `min(.a, .b, 3)`,
+			src:      `{"a":5,"b":-1}`,
+			expected: -1.0,
+		},
+		{
+			name:     "max",
+			exp:      `max(.a, .b, 3)`,
+			src:      `{"a":5,"b":-1}`,
+			expected: 5.0,
+		},
+		{
+			name:     "min without whitespace",
+			exp:      `min(.a,.b)`,
+			src:      `{"a":5,"b":-1}`,
+			expected: -1.0,
+		},
+		{
+			name:     "replace path",
+			exp:      `replace(.name, "B", "R")`,
+			src:      `{"name":"Bob"}`,
+			expected: "Rob",
+		},
+		{
+			name:     "coalesce missing",
+			exp:      `coalesce(.missing, .name)`,
+			src:      `{"name":"joey"}`,
+			expected: "joey",
+		},
+		{
+			name:     "coalesce",
+			exp:      `coalesce(.a, .b, "default")`,
+			src:      `{"b":"b"}`,
+			expected: "b",
+		},
+		{
+			name:     "case insensitive",
+			exp:      `LEN(.name)`,
+			src:      `{"name":"abc"}`,
+			expected: 3.0,
+		},
+		{
+			name:     "nested",
+			exp:      `upper(trim(.name)) + "!"`,
+			src:      `{"name":" abc "}`,
+			expected: "ABC!",
+		},
+		{
+			name:     "within array and coerce",
+			exp:      `[len(.a), COERCE len(.a) _string_]`,
+			src:      `{"a":"xy"}`,
+			expected: []any{2.0, "2"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(tc.src))
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestFunctionsParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name   string
+		exp    string
+		offset int
+		err    string
+	}{
+		{
+			name:   "unknown function",
+			exp:    `.a == foo(1)`,
+			offset: 6,
+			err:    "1:7: unknown function `foo`",
+		},
+		{
+			name:   "too few arguments",
+			exp:    `replace("a", "b")`,
+			offset: 0,
+			err:    "1:1: function `replace` expects 3 argument(s), found 2",
+		},
+		{
+			name:   "too many arguments",
+			exp:    `round(1, 2, 3)`,
+			offset: 0,
+			err:    "1:1: function `round` expects at most 2 argument(s), found 3",
+		},
+		{
+			name:   "missing separator",
+			exp:    `min(1 2)`,
+			offset: 6,
+			err:    "1:7: unexpected token `2`, expected one of ,, )",
+		},
+		{
+			name:   "unclosed",
+			exp:    `min(1,`,
+			offset: 6,
+			err:    "1:7: unclosed function call `min(`, expected )",
+		},
+		{
+			name:   "constant argument type",
+			exp:    `lower(1)`,
+			offset: 0,
+			err:    "1:1: invalid argument 1 for function `lower`, expected string found: 1",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.exp))
+			assert.Error(err)
+
+			var syntaxErr ErrSyntax
+			assert.ErrorAs(err, &syntaxErr)
+			assert.Equal(tc.offset, syntaxErr.Offset)
+			assert.Equal(tc.err, err.Error())
+		})
+	}
+}
+
+func TestFunctionsConstantFolding(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`upper("abc")`))
+	assert.NoError(err)
+	folded, ok := ex.(Literal)
+	assert.True(ok)
+	assert.Equal("ABC", folded.Value())
+	assert.Equal("upper", ex.(Call).FunctionName())
+	assert.Equal(`upper("abc")`, Format(ex))
+
+	ex, err = Parse([]byte(`now()`))
+	assert.NoError(err)
+	_, ok = ex.(Literal)
+	assert.False(ok)
+	result, err := ex.Calculate(nil)
+	assert.NoError(err)
+	assert.IsType(time.Time{}, result)
+
+	ex, err = Parse([]byte(`len($name)`))
+	assert.NoError(err)
+	_, ok = ex.(Literal)
+	assert.False(ok)
+	bound, err := Bind(ex, map[string]any{"name": "abcd"})
+	assert.NoError(err)
+	folded, ok = bound.(Literal)
+	assert.True(ok)
+	assert.Equal(4.0, folded.Value())
+}
+
+func TestCustomFunction(t *testing.T) {
+	assert := require.New(t)
+
+	env := NewEnvironment()
+	env.SetFunction("Double", Function{
+		MinArgs: 1, MaxArgs: 1, Args: []ArgType{ArgNumber}, Pure: true,
+		Fn: func(args []any) (any, error) {
+			return args[0].(float64) * 2, nil
+		},
+	})
+
+	ex, err := ParseWith(env, []byte(`double(.n) == 4`))
+	assert.NoError(err)
+	assert.Equal(`double(.n) == 4`, Format(ex))
+
+	result, err := ex.Calculate([]byte(`{"n":2}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
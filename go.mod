@@ -3,11 +3,15 @@ module github.com/go-playground/ksql
 go 1.18
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/araddon/dateparse v0.0.0-20210429162001-6b43995a97de
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/go-playground/itertools v0.1.0
 	github.com/go-playground/pkg/v5 v5.22.0
 	github.com/stretchr/testify v1.8.4
 	github.com/tidwall/gjson v1.17.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -16,5 +20,6 @@ require (
 	github.com/stretchr/objx v0.5.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 )
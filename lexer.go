@@ -1,6 +1,8 @@
 package ksql
 
 import (
+	"math"
+
 	optionext "github.com/go-playground/pkg/v5/values/option"
 	resultext "github.com/go-playground/pkg/v5/values/result"
 )
@@ -8,21 +10,22 @@ import (
 // Token represents a lexed token
 type Token struct {
 	Start uint32
-	Len   uint16
+	Len   uint32
 	Kind  TokenKind
 }
 
 // LexerResult represents a token lexed result
 type LexerResult struct {
 	kind TokenKind
-	len  uint16
+	len  uint32
 }
 
 // TokenKind is the type of token lexed.
 type TokenKind uint8
 
+// New kinds are appended so the values of existing kinds don't change.
 const (
-	SelectorPath = iota
+	SelectorPath TokenKind = iota
 	QuotedString
 	Number
 	BooleanTrue
@@ -55,12 +58,109 @@ const (
 	Coerce
 	Identifier
 	Colon
+	Parameter
+	FunctionName
+	Matches
+	IMatches
+	Like
+	ILike
+	Glob
+	If
+	Then
+	Else
+	Case
+	When
+	End
+	Exists
+	Is
+	IsNot
+	Missing
+	Any
+	All
+	None
+	OpenBrace
+	CloseBrace
+	Escape
 )
 
+var tokenKindNames = [...]string{
+	SelectorPath: "selector path",
+	QuotedString: "string",
+	Number:       "number",
+	BooleanTrue:  "true",
+	BooleanFalse: "false",
+	Null:         "NULL",
+	Equals:       "==",
+	Add:          "+",
+	Subtract:     "-",
+	Multiply:     "*",
+	Divide:       "/",
+	Gt:           ">",
+	Gte:          ">=",
+	Lt:           "<",
+	Lte:          "<=",
+	And:          "&&",
+	Or:           "||",
+	Not:          "!",
+	Contains:     "CONTAINS",
+	ContainsAny:  "CONTAINS_ANY",
+	ContainsAll:  "CONTAINS_ALL",
+	In:           "IN",
+	Between:      "BETWEEN",
+	StartsWith:   "STARTSWITH",
+	EndsWith:     "ENDSWITH",
+	OpenBracket:  "[",
+	CloseBracket: "]",
+	Comma:        ",",
+	OpenParen:    "(",
+	CloseParen:   ")",
+	Coerce:       "COERCE",
+	Identifier:   "identifier",
+	Colon:        ":",
+	Parameter:    "parameter",
+	FunctionName: "function",
+	Matches:      "MATCHES",
+	IMatches:     "IMATCHES",
+	Like:         "LIKE",
+	ILike:        "ILIKE",
+	Glob:         "GLOB",
+	If:           "IF",
+	Then:         "THEN",
+	Else:         "ELSE",
+	Case:         "CASE",
+	When:         "WHEN",
+	End:          "END",
+	Exists:       "EXISTS",
+	Is:           "IS",
+	IsNot:        "IS NOT",
+	Missing:      "MISSING",
+	Any:          "ANY",
+	All:          "ALL",
+	None:         "NONE",
+	OpenBrace:    "{",
+	CloseBrace:   "}",
+	Escape:       "ESCAPE",
+}
+
+// String returns the text of the token kind, or a description for tokens without fixed text eg. `number`.
+func (k TokenKind) String() string {
+	if int(k) < len(tokenKindNames) && tokenKindNames[k] != "" {
+		return tokenKindNames[k]
+	}
+	return "unknown"
+}
+
 // / Try to lex a single token from the input stream.
 func tokenizeSingleToken(data []byte) (result LexerResult, err error) {
 	b := data[0]
 
+	// a name immediately followed by `(` is a function call, unless it is a keyword eg. `IF(.a)`.
+	if isAlphabetical(b) {
+		if result, ok := tokenizeFunction(data); ok {
+			return result, nil
+		}
+	}
+
 	switch b {
 	case '=':
 		if len(data) > 1 && data[1] == '=' {
@@ -105,12 +205,18 @@ func tokenizeSingleToken(data []byte) (result LexerResult, err error) {
 		result = LexerResult{kind: OpenBracket, len: 1}
 	case ']':
 		result = LexerResult{kind: CloseBracket, len: 1}
+	case '{':
+		result = LexerResult{kind: OpenBrace, len: 1}
+	case '}':
+		result = LexerResult{kind: CloseBrace, len: 1}
 	case ',':
 		result = LexerResult{kind: Comma, len: 1}
 	case '!':
 		result = LexerResult{kind: Not, len: 1}
 	case ':':
 		result = LexerResult{kind: Colon, len: 1}
+	case '$':
+		result, err = tokenizeParameter(data)
 	case '"', '\'':
 		result, err = tokenizeString(data, b)
 	case '.':
@@ -121,17 +227,19 @@ func tokenizeSingleToken(data []byte) (result LexerResult, err error) {
 		if len(data) > 1 && data[1] == '&' {
 			result = LexerResult{kind: And, len: 2}
 		} else {
-			err = ErrUnsupportedCharacter{b: b}
+			err = ErrUnsupportedCharacter{b: b, kind: optionext.Some[TokenKind](And)}
 		}
 	case '|':
 		if len(data) > 1 && data[1] == '|' {
 			result = LexerResult{kind: Or, len: 2}
 		} else {
-			err = ErrUnsupportedCharacter{b: b}
+			err = ErrUnsupportedCharacter{b: b, kind: optionext.Some[TokenKind](Or)}
 		}
 	case 'C':
 
-		if len(data) > 2 && data[2] == 'N' {
+		if len(data) > 1 && data[1] == 'A' {
+			result, err = tokenizeKeyword(data, "CASE", Case)
+		} else if len(data) > 2 && data[2] == 'N' {
 			// can be one of CONTAINS, CONTAINS_ANY, CONTAINS_ALL
 			if len(data) > 8 && data[8] == '_' {
 				if len(data) > 10 && data[10] == 'N' {
@@ -147,15 +255,63 @@ func tokenizeSingleToken(data []byte) (result LexerResult, err error) {
 		}
 
 	case 'I':
-		result, err = tokenizeKeyword(data, "IN", In)
+		switch {
+		case len(data) > 1 && data[1] == 'M':
+			result, err = tokenizeKeyword(data, "IMATCHES", IMatches)
+		case len(data) > 1 && data[1] == 'L':
+			result, err = tokenizeKeyword(data, "ILIKE", ILike)
+		case len(data) > 1 && data[1] == 'F':
+			result, err = tokenizeKeyword(data, "IF", If)
+		case len(data) > 1 && data[1] == 'S':
+			result, err = tokenizeIs(data)
+		default:
+			result, err = tokenizeKeyword(data, "IN", In)
+		}
+	case 'L':
+		result, err = tokenizeKeyword(data, "LIKE", Like)
+	case 'G':
+		result, err = tokenizeKeyword(data, "GLOB", Glob)
+	case 'M':
+		if len(data) > 1 && data[1] == 'I' {
+			// MISSING ends an IS and so may be directly followed by anything eg. `)` or the end of the expression
+			result, err = tokenizeWord(data, "MISSING", Missing)
+		} else {
+			result, err = tokenizeKeyword(data, "MATCHES", Matches)
+		}
 	case 'S':
 		result, err = tokenizeKeyword(data, "STARTSWITH", StartsWith)
 	case 'E':
-		result, err = tokenizeKeyword(data, "ENDSWITH", EndsWith)
+		switch {
+		case len(data) > 1 && data[1] == 'X':
+			result, err = tokenizeKeyword(data, "EXISTS", Exists)
+		case len(data) > 3 && data[3] == 'S':
+			result, err = tokenizeKeyword(data, "ENDSWITH", EndsWith)
+		case len(data) > 1 && data[1] == 'L':
+			result, err = tokenizeKeyword(data, "ELSE", Else)
+		case len(data) > 1 && data[1] == 'S':
+			result, err = tokenizeKeyword(data, "ESCAPE", Escape)
+		default:
+			// END terminates a CASE and so may be directly followed by anything eg. `)` or the end of the expression
+			result, err = tokenizeWord(data, "END", End)
+		}
+	case 'T':
+		result, err = tokenizeKeyword(data, "THEN", Then)
+	case 'W':
+		result, err = tokenizeKeyword(data, "WHEN", When)
 	case 'B':
 		result, err = tokenizeKeyword(data, "BETWEEN", Between)
 	case 'N':
-		result, err = tokenizeNull(data)
+		if len(data) > 1 && data[1] == 'O' {
+			result, err = tokenizeKeyword(data, "NONE", None)
+		} else {
+			result, err = tokenizeNull(data)
+		}
+	case 'A':
+		if len(data) > 1 && data[1] == 'N' {
+			result, err = tokenizeKeyword(data, "ANY", Any)
+		} else {
+			result, err = tokenizeKeyword(data, "ALL", All)
+		}
 	case '_':
 		result, err = tokenizeIdentifier(data)
 	default:
@@ -180,7 +336,43 @@ func tokenizeIdentifier(data []byte) (result LexerResult, err error) {
 			len:  end,
 		}
 	} else {
-		err = ErrInvalidIdentifier{s: string(data)}
+		err = ErrInvalidIdentifier{s: word(data)}
+	}
+	return
+}
+
+// keywords are the words lexed as keywords rather than function names when immediately followed by `(`.
+var keywords = map[string]struct{}{
+	"CONTAINS": {}, "CONTAINS_ANY": {}, "CONTAINS_ALL": {}, "IN": {}, "BETWEEN": {}, "STARTSWITH": {},
+	"ENDSWITH": {}, "MATCHES": {}, "IMATCHES": {}, "LIKE": {}, "ILIKE": {}, "GLOB": {}, "IF": {}, "THEN": {},
+	"ELSE": {}, "CASE": {}, "WHEN": {}, "END": {}, "EXISTS": {}, "IS": {}, "NOT": {}, "MISSING": {}, "ANY": {},
+	"ALL": {}, "NONE": {}, "NULL": {}, "COERCE": {}, "ESCAPE": {},
+}
+
+func tokenizeFunction(data []byte) (result LexerResult, ok bool) {
+	end := takeWhile(data, func(b byte) bool {
+		return isAlphanumeric(b) || b == '_'
+	})
+	if len(data) > int(end) && data[end] == '(' {
+		if _, found := keywords[string(data[:end])]; found {
+			return
+		}
+		return LexerResult{kind: FunctionName, len: end}, true
+	}
+	return
+}
+
+func tokenizeParameter(data []byte) (result LexerResult, err error) {
+	end := takeWhile(data[1:], func(b byte) bool {
+		return isAlphanumeric(b) || b == '_'
+	})
+	if end > 0 {
+		result = LexerResult{
+			kind: Parameter,
+			len:  end + 1,
+		}
+	} else {
+		err = ErrInvalidParameter{s: word(data)}
 	}
 	return
 }
@@ -210,14 +402,14 @@ func tokenizeNumber(data []byte) (result LexerResult, err error) {
 			len:  end,
 		}
 	} else {
-		err = ErrInvalidNumber{s: string(data)}
+		err = ErrInvalidNumber{s: word(data)}
 	}
 	return
 }
 
 func tokenizeKeyword(data []byte, keyword string, kind TokenKind) (result LexerResult, err error) {
 	end := takeWhile(data, func(b byte) bool {
-		return !isWhitespace(b)
+		return !isWhitespace(b) && b != '('
 	})
 	if end > 0 && len(data) > len(keyword) && string(data[:end]) == keyword {
 		result = LexerResult{
@@ -225,22 +417,47 @@ func tokenizeKeyword(data []byte, keyword string, kind TokenKind) (result LexerR
 			len:  end,
 		}
 	} else {
-		err = ErrInvalidKeyword{s: string(data)}
+		err = ErrInvalidKeyword{s: word(data), kind: kind}
 	}
 	return
 }
 
 func tokenizeNull(data []byte) (result LexerResult, err error) {
+	return tokenizeWord(data, "NULL", Null)
+}
+
+// tokenizeIs lexes `IS` or, when followed by `NOT`, `IS NOT` as a single token.
+func tokenizeIs(data []byte) (result LexerResult, err error) {
+	// unlike other keywords IS may end the expression, leaving the parser to report what must follow it.
+	if string(data) == "IS" {
+		return LexerResult{kind: Is, len: 2}, nil
+	}
+	if result, err = tokenizeKeyword(data, "IS", Is); err != nil {
+		return
+	}
+	start := result.len + takeWhile(data[result.len:], isWhitespace)
+	if string(data[start:]) == "NOT" {
+		return LexerResult{kind: IsNot, len: start + 3}, nil
+	}
+	if not, err := tokenizeKeyword(data[start:], "NOT", IsNot); err == nil {
+		result = LexerResult{kind: IsNot, len: start + not.len}
+	}
+	return result, nil
+}
+
+// tokenizeWord lexes a keyword that, unlike those lexed by tokenizeKeyword, may be directly followed by any
+// non-alphabetical character.
+func tokenizeWord(data []byte, keyword string, kind TokenKind) (result LexerResult, err error) {
 	end := takeWhile(data, func(b byte) bool {
 		return isAlphabetical(b)
 	})
-	if end > 0 && string(data[:end]) == "NULL" {
+	if end > 0 && string(data[:end]) == keyword {
 		result = LexerResult{
-			kind: Null,
+			kind: kind,
 			len:  end,
 		}
 	} else {
-		err = ErrInvalidKeyword{s: string(data)}
+		err = ErrInvalidKeyword{s: word(data), kind: kind}
 	}
 	return
 }
@@ -262,17 +479,46 @@ func tokenizeBool(data []byte) (result LexerResult, err error) {
 				len:  end,
 			}
 		default:
-			err = ErrInvalidBool{s: string(data)}
+			err = ErrInvalidBool{s: word(data)}
 		}
 	} else {
-		err = ErrInvalidBool{s: string(data)}
+		err = ErrInvalidBool{s: word(data)}
 	}
 	return
 }
 
 func tokenizeSelectorPath(data []byte) (result LexerResult, err error) {
+	// a `}`, `]` or `,` ends the path unless within a `{` or `[` within it eg. a gjson multipath `.{name,age}`,
+	// so paths can be separated by commas within arrays, objects and function calls eg. `max(.a, .b)`. A
+	// character escaped by a backslash never ends the path eg. `.a\,b`.
+	var braces, brackets int
+	var escaped bool
 	end := takeWhile(data[1:], func(b byte) bool {
-		return !isWhitespace(b) && b != ')' && b != ']'
+		if escaped {
+			escaped = false
+			return true
+		}
+		switch b {
+		case '\\':
+			escaped = true
+		case '{':
+			braces++
+		case '}':
+			if braces == 0 {
+				return false
+			}
+			braces--
+		case '[':
+			brackets++
+		case ']':
+			if brackets == 0 {
+				return false
+			}
+			brackets--
+		case ',':
+			return braces > 0 || brackets > 0
+		}
+		return !isWhitespace(b) && b != ')'
 	})
 	if end > 0 {
 		if len(data) > int(end) {
@@ -294,7 +540,8 @@ func tokenizeString(data []byte, quote byte) (result LexerResult, err error) {
 	end := takeWhile(data[1:], func(b byte) bool {
 		switch b {
 		case '\\':
-			lastBackslash = true
+			// an escaped backslash does not escape the character that follows it
+			lastBackslash = !lastBackslash
 			return true
 		case quote:
 			if lastBackslash {
@@ -304,6 +551,7 @@ func tokenizeString(data []byte, quote byte) (result LexerResult, err error) {
 			endedWithTerminator = true
 			return false
 		default:
+			lastBackslash = false
 			return true
 		}
 	})
@@ -332,7 +580,7 @@ func tokenizeString(data []byte, quote byte) (result LexerResult, err error) {
 }
 
 // / Consumes bytes while a predicate evaluates to true.
-func takeWhile(data []byte, pred func(byte) bool) (end uint16) {
+func takeWhile(data []byte, pred func(byte) bool) (end uint32) {
 	for _, b := range data {
 		if !pred(b) {
 			break
@@ -342,13 +590,25 @@ func takeWhile(data []byte, pred func(byte) bool) (end uint16) {
 	return
 }
 
+// word returns the text up until the next whitespace, used to describe the offending text of lexer errors.
+func word(data []byte) string {
+	return string(data[:takeWhile(data, func(b byte) bool {
+		return !isWhitespace(b)
+	})])
+}
+
 // Tokenizer is a lexer for the KSQL expression syntax.
 type Tokenizer struct {
 	pos       uint32
+	src       []byte
 	remaining []byte
+
+	// root lexes a `.` on its own as a selector path of the root, which the parser only accepts within the
+	// predicates of quantifiers and filter.
+	root bool
 }
 
-func skipWhitespace(data []byte) uint16 {
+func skipWhitespace(data []byte) uint32 {
 	return takeWhile(data, func(b byte) bool {
 		return isWhitespace(b)
 	})
@@ -358,11 +618,21 @@ func skipWhitespace(data []byte) uint16 {
 func NewTokenizer(src []byte) *Tokenizer {
 	return &Tokenizer{
 		pos:       0,
+		src:       src,
 		remaining: src,
 	}
 }
 
+// maxExpressionLength is the maximum length of an expression that can be lexed, as the offsets of tokens are
+// 32-bit.
+var maxExpressionLength uint64 = math.MaxUint32
+
+// Next returns the next token, if any, or an ErrSyntax describing why the next token could not be lexed.
 func (t *Tokenizer) Next() optionext.Option[resultext.Result[Token, error]] {
+	if uint64(len(t.src)) > maxExpressionLength {
+		err := ErrLimitExceeded{Limit: LimitExpressionLength, Max: int(maxExpressionLength)}
+		return optionext.Some(resultext.Err[Token, error](newErrSyntax(t.src, 0, "", nil, err)))
+	}
 	t.skipWhitespace()
 
 	if len(t.remaining) == 0 {
@@ -378,8 +648,11 @@ func (t *Tokenizer) skipWhitespace() {
 
 func (t *Tokenizer) nextToken() optionext.Option[resultext.Result[Token, error]] {
 	result, err := tokenizeSingleToken(t.remaining)
+	if _, ok := err.(ErrInvalidSelectorPath); ok && t.root {
+		result, err = LexerResult{kind: SelectorPath, len: 1}, nil
+	}
 	if err != nil {
-		return optionext.Some(resultext.Err[Token, error](err))
+		return optionext.Some(resultext.Err[Token, error](t.syntaxError(err)))
 	}
 	token := Token{
 		Start: t.pos,
@@ -390,9 +663,23 @@ func (t *Tokenizer) nextToken() optionext.Option[resultext.Result[Token, error]]
 	return optionext.Some(resultext.Ok[Token, error](token))
 }
 
-func (t *Tokenizer) chomp(num uint16) {
+func (t *Tokenizer) syntaxError(err error) ErrSyntax {
+	var (
+		token    string
+		expected []TokenKind
+	)
+	if le, ok := err.(lexerError); ok {
+		token = le.token()
+		if kind, ok := le.expected(); ok {
+			expected = []TokenKind{kind}
+		}
+	}
+	return newErrSyntax(t.src, int(t.pos), token, expected, err)
+}
+
+func (t *Tokenizer) chomp(num uint32) {
 	t.remaining = t.remaining[num:]
-	t.pos += uint32(num)
+	t.pos += num
 }
 
 func isAlphanumeric(c byte) bool {
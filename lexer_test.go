@@ -236,6 +236,98 @@ func Test(t *testing.T) {
 			input:  " ENDSWITH ",
 			tokens: []Token{{Kind: EndsWith, Start: 1, Len: 8}},
 		},
+		{
+			name:   "parse MATCHES",
+			input:  " MATCHES ",
+			tokens: []Token{{Kind: Matches, Start: 1, Len: 7}},
+		},
+		{
+			name:   "parse IMATCHES",
+			input:  " IMATCHES ",
+			tokens: []Token{{Kind: IMatches, Start: 1, Len: 8}},
+		},
+		{
+			name:   "parse LIKE",
+			input:  " LIKE ",
+			tokens: []Token{{Kind: Like, Start: 1, Len: 4}},
+		},
+		{
+			name:   "parse ILIKE",
+			input:  " ILIKE ",
+			tokens: []Token{{Kind: ILike, Start: 1, Len: 5}},
+		},
+		{
+			name:   "parse ESCAPE",
+			input:  " ESCAPE ",
+			tokens: []Token{{Kind: Escape, Start: 1, Len: 6}},
+		},
+		{
+			name:   "parse GLOB",
+			input:  " GLOB ",
+			tokens: []Token{{Kind: Glob, Start: 1, Len: 4}},
+		},
+		{
+			name:  "parse IF THEN ELSE",
+			input: "IF .a THEN 1 ELSE 2",
+			tokens: []Token{
+				{Kind: If, Start: 0, Len: 2},
+				{Kind: SelectorPath, Start: 3, Len: 2},
+				{Kind: Then, Start: 6, Len: 4},
+				{Kind: Number, Start: 11, Len: 1},
+				{Kind: Else, Start: 13, Len: 4},
+				{Kind: Number, Start: 18, Len: 1},
+			},
+		},
+		{
+			name:  "parse CASE WHEN END",
+			input: "(CASE WHEN true THEN 1 END)",
+			tokens: []Token{
+				{Kind: OpenParen, Start: 0, Len: 1},
+				{Kind: Case, Start: 1, Len: 4},
+				{Kind: When, Start: 6, Len: 4},
+				{Kind: BooleanTrue, Start: 11, Len: 4},
+				{Kind: Then, Start: 16, Len: 4},
+				{Kind: Number, Start: 21, Len: 1},
+				{Kind: End, Start: 23, Len: 3},
+				{Kind: CloseParen, Start: 26, Len: 1},
+			},
+		},
+		{
+			name:  "parse EXISTS and IS",
+			input: "EXISTS .a && .b IS NULL && .c IS  NOT MISSING",
+			tokens: []Token{
+				{Kind: Exists, Start: 0, Len: 6},
+				{Kind: SelectorPath, Start: 7, Len: 2},
+				{Kind: And, Start: 10, Len: 2},
+				{Kind: SelectorPath, Start: 13, Len: 2},
+				{Kind: Is, Start: 16, Len: 2},
+				{Kind: Null, Start: 19, Len: 4},
+				{Kind: And, Start: 24, Len: 2},
+				{Kind: SelectorPath, Start: 27, Len: 2},
+				{Kind: IsNot, Start: 30, Len: 7},
+				{Kind: Missing, Start: 38, Len: 7},
+			},
+		},
+		{
+			name:  "parse ANY ALL NONE",
+			input: "ANY ALL NONE NULL",
+			tokens: []Token{
+				{Kind: Any, Start: 0, Len: 3},
+				{Kind: All, Start: 4, Len: 3},
+				{Kind: None, Start: 8, Len: 4},
+				{Kind: Null, Start: 13, Len: 4},
+			},
+		},
+		{
+			name:   "parse string ending with escaped backslash",
+			input:  `"a\d\\" "b"`,
+			tokens: []Token{{Kind: QuotedString, Start: 0, Len: 7}, {Kind: QuotedString, Start: 8, Len: 3}},
+		},
+		{
+			name:   "parse string with regex escape",
+			input:  `"\d+"`,
+			tokens: []Token{{Kind: QuotedString, Start: 0, Len: 5}},
+		},
 		{
 			name:   "parse AND",
 			input:  "&&",
@@ -271,6 +363,21 @@ func Test(t *testing.T) {
 			input: " ENDSWITH",
 			err:   ErrInvalidKeyword{s: "ENDSWITH"},
 		},
+		{
+			name:  "parse bad MATCHES",
+			input: " MATCHES",
+			err:   ErrInvalidKeyword{s: "MATCHES"},
+		},
+		{
+			name:  "parse bad END",
+			input: "ENDING",
+			err:   ErrInvalidKeyword{s: "ENDING"},
+		},
+		{
+			name:  "parse bad GLOB",
+			input: " GLOBS ",
+			err:   ErrInvalidKeyword{s: "GLOBS"},
+		},
 		{
 			name:  "parse bad AND",
 			input: "&",
@@ -360,6 +467,61 @@ func Test(t *testing.T) {
 			input:  " +1e10 ",
 			tokens: []Token{{Kind: Number, Start: 1, Len: 5}},
 		},
+		{
+			name:   "parse parameter",
+			input:  " $min_age1 ",
+			tokens: []Token{{Kind: Parameter, Start: 1, Len: 9}},
+		},
+		{
+			name:   "parse parameter followed by paren",
+			input:  "($a)",
+			tokens: []Token{{Kind: OpenParen, Start: 0, Len: 1}, {Kind: Parameter, Start: 1, Len: 2}, {Kind: CloseParen, Start: 3, Len: 1}},
+		},
+		{
+			name:   "parse function",
+			input:  "len(.a)",
+			tokens: []Token{{Kind: FunctionName, Start: 0, Len: 3}, {Kind: OpenParen, Start: 3, Len: 1}, {Kind: SelectorPath, Start: 4, Len: 2}, {Kind: CloseParen, Start: 6, Len: 1}},
+		},
+		{
+			name:   "parse object",
+			input:  `{"a":.a}`,
+			tokens: []Token{{Kind: OpenBrace, Start: 0, Len: 1}, {Kind: QuotedString, Start: 1, Len: 3}, {Kind: Colon, Start: 4, Len: 1}, {Kind: SelectorPath, Start: 5, Len: 2}, {Kind: CloseBrace, Start: 7, Len: 1}},
+		},
+		{
+			name:   "parse selector multipath",
+			input:  ".{a,b}}",
+			tokens: []Token{{Kind: SelectorPath, Start: 0, Len: 6}, {Kind: CloseBrace, Start: 6, Len: 1}},
+		},
+		{
+			name:   "parse selector multipath with comma",
+			input:  ".[a,b],.{c,d}",
+			tokens: []Token{{Kind: SelectorPath, Start: 0, Len: 6}, {Kind: Comma, Start: 6, Len: 1}, {Kind: SelectorPath, Start: 7, Len: 6}},
+		},
+		{
+			name:   "parse selector followed by comma",
+			input:  "[.a,.b]",
+			tokens: []Token{{Kind: OpenBracket, Start: 0, Len: 1}, {Kind: SelectorPath, Start: 1, Len: 2}, {Kind: Comma, Start: 3, Len: 1}, {Kind: SelectorPath, Start: 4, Len: 2}, {Kind: CloseBracket, Start: 6, Len: 1}},
+		},
+		{
+			name:   "parse selector escaped comma",
+			input:  `.a\,b,`,
+			tokens: []Token{{Kind: SelectorPath, Start: 0, Len: 5}, {Kind: Comma, Start: 5, Len: 1}},
+		},
+		{
+			name:   "parse keyword followed by parenthesis",
+			input:  "IF(.a)",
+			tokens: []Token{{Kind: If, Start: 0, Len: 2}, {Kind: OpenParen, Start: 2, Len: 1}, {Kind: SelectorPath, Start: 3, Len: 2}, {Kind: CloseParen, Start: 5, Len: 1}},
+		},
+		{
+			name:   "parse function keyword prefix",
+			input:  "trim( true)",
+			tokens: []Token{{Kind: FunctionName, Start: 0, Len: 4}, {Kind: OpenParen, Start: 4, Len: 1}, {Kind: BooleanTrue, Start: 6, Len: 4}, {Kind: CloseParen, Start: 10, Len: 1}},
+		},
+		{
+			name:  "parse parameter without name",
+			input: "$ ",
+			err:   ErrInvalidParameter{s: "$"},
+		},
 	}
 
 	for _, tc := range tests {
@@ -378,6 +540,101 @@ func Test(t *testing.T) {
 	}
 }
 
+func TestLexerErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		input    string
+		offset   int
+		line     int
+		column   int
+		token    string
+		expected []TokenKind
+	}{
+		{
+			name:     "single ampersand",
+			input:    ".a & .b",
+			offset:   3,
+			line:     1,
+			column:   4,
+			token:    "&",
+			expected: []TokenKind{And},
+		},
+		{
+			name:     "single pipe",
+			input:    ".a | .b",
+			offset:   3,
+			line:     1,
+			column:   4,
+			token:    "|",
+			expected: []TokenKind{Or},
+		},
+		{
+			name:     "invalid keyword only contains offending word",
+			input:    ".a CONTAINZ .b && true",
+			offset:   3,
+			line:     1,
+			column:   4,
+			token:    "CONTAINZ",
+			expected: []TokenKind{Contains},
+		},
+		{
+			name:   "invalid bool",
+			input:  "true && fool == true",
+			offset: 8,
+			line:   1,
+			column: 9,
+			token:  "fool",
+		},
+		{
+			name:     "unterminated string",
+			input:    `.a == "abc`,
+			offset:   6,
+			line:     1,
+			column:   7,
+			token:    `"abc`,
+			expected: []TokenKind{QuotedString},
+		},
+		{
+			name:     "invalid number on second line",
+			input:    ".a == 1 &&\n  .b == 1.2.3",
+			offset:   19,
+			line:     2,
+			column:   9,
+			token:    "1.2.3",
+			expected: []TokenKind{Number},
+		},
+		{
+			name:     "column counts runes",
+			input:    `"ü" == NULLL`,
+			offset:   8,
+			line:     1,
+			column:   8,
+			token:    "NULLL",
+			expected: []TokenKind{Null},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := collect([]byte(tc.input))
+			assert.Error(err)
+
+			var syntaxErr ErrSyntax
+			assert.ErrorAs(err, &syntaxErr)
+			assert.Equal(tc.offset, syntaxErr.Offset)
+			assert.Equal(tc.line, syntaxErr.Line)
+			assert.Equal(tc.column, syntaxErr.Column)
+			assert.Equal(tc.token, syntaxErr.Token)
+			assert.Equal(tc.expected, syntaxErr.Expected)
+		})
+	}
+}
+
 // Collect tokenizes the input and returns tokens or error lexing them.
 func collect(src []byte) (tokens []Token, err error) {
 	tokenizer := NewTokenizer(src)
@@ -395,3 +652,15 @@ func collect(src []byte) (tokens []Token, err error) {
 	}
 	return
 }
+
+func TestTokenKindValues(t *testing.T) {
+	assert := require.New(t)
+
+	// the values of the original kinds must not change as new kinds are appended.
+	assert.Equal(TokenKind(0), SelectorPath)
+	assert.Equal(TokenKind(24), EndsWith)
+	assert.Equal(TokenKind(25), OpenBracket)
+	assert.Equal(TokenKind(32), Colon)
+	assert.Equal(TokenKind(33), Parameter)
+	assert.Equal(TokenKind(34), FunctionName)
+}
@@ -0,0 +1,261 @@
+package ksql
+
+import (
+	"context"
+
+	"github.com/tidwall/gjson"
+)
+
+// Limits bounds the work done calculating an expression, see CalculateWithLimits. A zero limit is unlimited.
+type Limits struct {
+	// MaxSteps is the maximum number of operations, selector paths and function calls calculated, each
+	// calculation of a quantifier or filter predicate against an element of an array counting separately.
+	MaxSteps int
+
+	// MaxStringLength is the maximum length in bytes of any string calculated, whether the result of an
+	// operation eg. `add` or the value of a selector path.
+	MaxStringLength int
+
+	// MaxArrayLength is the maximum number of elements of any array calculated, whether the result of an
+	// operation eg. filter or the value of a selector path eg. `.items.#.sku`.
+	MaxArrayLength int
+}
+
+// Limit identifies the limit exceeded by an ErrLimitExceeded, one of the Limits of a calculation or the
+// ParseOptions limiting an expression.
+type Limit uint8
+
+const (
+	// LimitSteps is Limits.MaxSteps.
+	LimitSteps Limit = iota
+
+	// LimitStringLength is Limits.MaxStringLength.
+	LimitStringLength
+
+	// LimitArrayLength is Limits.MaxArrayLength.
+	LimitArrayLength
+
+	// LimitDepth is ParseOptions.MaxDepth.
+	LimitDepth
+
+	// LimitExpressionLength is ParseOptions.MaxLength.
+	LimitExpressionLength
+
+	// LimitTokens is ParseOptions.MaxTokens.
+	LimitTokens
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LimitSteps:
+		return "steps"
+	case LimitStringLength:
+		return "string length"
+	case LimitArrayLength:
+		return "array length"
+	case LimitDepth:
+		return "depth"
+	case LimitExpressionLength:
+		return "expression length"
+	case LimitTokens:
+		return "tokens"
+	default:
+		return "unknown"
+	}
+}
+
+// CalculateContext applies the expression to the supplied data, returning the context's error if it is
+// cancelled or its deadline exceeded before the calculation completes. See CalculateWithLimits.
+func CalculateContext(ctx context.Context, e Expression, src []byte) (any, error) {
+	return CalculateWithLimits(ctx, e, src, Limits{})
+}
+
+// CalculateWithLimits applies the expression to the supplied data, returning an ErrLimitExceeded as soon as
+// the calculation exceeds any of the limits or the context's error if it is cancelled or its deadline exceeded
+// before the calculation completes.
+//
+// The context and limits are checked between each step of the calculation, so a single step eg. a selector
+// path searching very large data is not interrupted. Expressions not implemented by this package, including
+// custom coercions, are calculated as a single step.
+func CalculateWithLimits(ctx context.Context, e Expression, src []byte, limits Limits) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l := &limiter{ctx: ctx, done: ctx.Done(), limits: limits}
+	limited, err := limit(e, l)
+	if err != nil {
+		return nil, err
+	}
+	result, err := limited.Calculate(src)
+	if l.err != nil {
+		// an error exceeding a limit is returned rather than any error it caused eg. a quantifier of an array
+		// that was too large finding no elements.
+		return nil, l.err
+	}
+	return result, err
+}
+
+// limiter tracks the work done by a single calculation.
+type limiter struct {
+	ctx    context.Context
+	done   <-chan struct{}
+	limits Limits
+	steps  int
+
+	// err is the first error exceeding a limit, which stops the calculation.
+	err error
+}
+
+// step counts a step of the calculation, returning an error if a limit has been exceeded or the context is
+// done.
+func (l *limiter) step() error {
+	if l.err != nil {
+		return l.err
+	}
+	l.steps++
+	if l.limits.MaxSteps > 0 && l.steps > l.limits.MaxSteps {
+		l.err = ErrLimitExceeded{Limit: LimitSteps, Max: l.limits.MaxSteps}
+		return l.err
+	}
+	select {
+	case <-l.done:
+		l.err = l.ctx.Err()
+		return l.err
+	default:
+		return nil
+	}
+}
+
+// check returns an error if the calculated value exceeds the maximum string or array length.
+func (l *limiter) check(value any) error {
+	switch v := value.(type) {
+	case string:
+		if l.limits.MaxStringLength > 0 && len(v) > l.limits.MaxStringLength {
+			l.err = ErrLimitExceeded{Limit: LimitStringLength, Max: l.limits.MaxStringLength}
+		}
+	case []any:
+		if l.limits.MaxArrayLength > 0 && len(v) > l.limits.MaxArrayLength {
+			l.err = ErrLimitExceeded{Limit: LimitArrayLength, Max: l.limits.MaxArrayLength}
+		}
+	}
+	return l.err
+}
+
+// checkResult returns an error if the result of a selector path exceeds the maximum string or array length,
+// without decoding it.
+func (l *limiter) checkResult(result gjson.Result) error {
+	switch {
+	case result.Type == gjson.String:
+		return l.check(result.Str)
+	case result.IsArray() && l.limits.MaxArrayLength > 0:
+		var n int
+		result.ForEach(func(_, _ gjson.Result) bool {
+			n++
+			return n <= l.limits.MaxArrayLength
+		})
+		if n > l.limits.MaxArrayLength {
+			l.err = ErrLimitExceeded{Limit: LimitArrayLength, Max: l.limits.MaxArrayLength}
+		}
+	}
+	return l.err
+}
+
+// limit returns a copy of the expression counting each step of its calculation using the limiter. Literals are
+// constant so are not counted. An error is returned if a node can't be rebuilt with its limited children.
+func limit(e Expression, l *limiter) (Expression, error) {
+	switch n := e.(type) {
+	case Literal:
+		return e, nil
+	case selectorPath:
+		return limitedPath{path: n, limiter: l}, nil
+	case *Compiled:
+		return limit(n.source, l)
+	}
+
+	node, ok := e.(Node)
+	if !ok {
+		return limited{e: e, limiter: l}, nil
+	}
+	children := node.Children()
+	if len(children) > 0 {
+		limitedChildren := make([]Expression, len(children))
+		for i, child := range children {
+			if child == nil {
+				continue
+			}
+			var err error
+			if limitedChildren[i], err = limit(child, l); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if e, err = node.withChildren(limitedChildren); err != nil {
+			return nil, err
+		}
+	}
+	return limited{e: e, limiter: l}, nil
+}
+
+var _ Expression = (*limited)(nil)
+
+// limited is an expression whose calculation is counted as a step.
+type limited struct {
+	e       Expression
+	limiter *limiter
+}
+
+func (e limited) Calculate(src []byte) (any, error) {
+	if err := e.limiter.step(); err != nil {
+		return nil, err
+	}
+	result, err := e.e.Calculate(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.limiter.check(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+var _ pathResult = (*limitedPath)(nil)
+var _ pathLookup = (*limitedPath)(nil)
+
+// limitedPath is a selector path whose calculation is counted as a step.
+type limitedPath struct {
+	path    selectorPath
+	limiter *limiter
+}
+
+func (p limitedPath) Calculate(src []byte) (any, error) {
+	value, _, err := p.lookup(src)
+	return value, err
+}
+
+func (p limitedPath) lookup(src []byte) (any, bool, error) {
+	if err := p.limiter.step(); err != nil {
+		return nil, false, err
+	}
+	result := p.path.result(src)
+	if err := p.limiter.checkResult(result); err != nil {
+		return nil, false, err
+	}
+	return p.path.value(result), result.Exists(), nil
+}
+
+// result returns the result of the path, which is empty once a limit has been exceeded. The error exceeding
+// the limit is returned by the calculation once complete.
+func (p limitedPath) result(src []byte) gjson.Result {
+	if p.limiter.step() != nil {
+		return gjson.Result{}
+	}
+	result := p.path.result(src)
+	if p.limiter.checkResult(result) != nil {
+		return gjson.Result{}
+	}
+	return result
+}
+
+func (p limitedPath) value(result gjson.Result) any {
+	return p.path.value(result)
+}
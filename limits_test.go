@@ -0,0 +1,197 @@
+package ksql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateWithLimits(t *testing.T) {
+	items := `[` + strings.Repeat(`{"sku":"a","qty":1},`, 99) + `{"sku":"b","qty":2}]`
+	src := []byte(`{"name":"joey","tags":["a","b","c"],"items":` + items + `}`)
+
+	tests := []struct {
+		name     string
+		exp      string
+		limits   Limits
+		expected any
+		err      error
+	}{
+		{
+			name:     "unlimited",
+			exp:      `ANY .items (.qty > 1) && .name == "joey"`,
+			expected: true,
+		},
+		{
+			name:     "within steps",
+			exp:      `.name + "!" + .name`,
+			limits:   Limits{MaxSteps: 4},
+			expected: "joey!joey",
+		},
+		{
+			name:   "steps",
+			exp:    `.name + "!" + .name`,
+			limits: Limits{MaxSteps: 3},
+			err:    ErrLimitExceeded{Limit: LimitSteps, Max: 3},
+		},
+		{
+			name:   "predicate steps",
+			exp:    `ANY .items (.qty > 1)`,
+			limits: Limits{MaxSteps: 100},
+			err:    ErrLimitExceeded{Limit: LimitSteps, Max: 100},
+		},
+		{
+			name:     "constant",
+			exp:      `"a" + "b"`,
+			limits:   Limits{MaxSteps: 1},
+			expected: "ab",
+		},
+		{
+			name:     "within string length",
+			exp:      `.name + .name`,
+			limits:   Limits{MaxStringLength: 8},
+			expected: "joeyjoey",
+		},
+		{
+			name:   "string length",
+			exp:    `.name + .name + .name`,
+			limits: Limits{MaxStringLength: 8},
+			err:    ErrLimitExceeded{Limit: LimitStringLength, Max: 8},
+		},
+		{
+			name:   "selector string length",
+			exp:    `len(.name)`,
+			limits: Limits{MaxStringLength: 3},
+			err:    ErrLimitExceeded{Limit: LimitStringLength, Max: 3},
+		},
+		{
+			name:     "within array length",
+			exp:      `.tags`,
+			limits:   Limits{MaxArrayLength: 3},
+			expected: []any{"a", "b", "c"},
+		},
+		{
+			name:   "selector array length",
+			exp:    `.items.#.sku`,
+			limits: Limits{MaxArrayLength: 50},
+			err:    ErrLimitExceeded{Limit: LimitArrayLength, Max: 50},
+		},
+		{
+			name:   "quantified array length",
+			exp:    `ALL .items (.qty > 0)`,
+			limits: Limits{MaxArrayLength: 50},
+			err:    ErrLimitExceeded{Limit: LimitArrayLength, Max: 50},
+		},
+		{
+			name:   "IS MISSING array length",
+			exp:    `.items IS MISSING`,
+			limits: Limits{MaxArrayLength: 50},
+			err:    ErrLimitExceeded{Limit: LimitArrayLength, Max: 50},
+		},
+		{
+			name:   "calculated array length",
+			exp:    `split(.name + .name + .name, "")`,
+			limits: Limits{MaxArrayLength: 10},
+			err:    ErrLimitExceeded{Limit: LimitArrayLength, Max: 10},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			for _, e := range []Expression{ex, Compile(ex)} {
+				result, err := CalculateWithLimits(context.Background(), e, src, tc.limits)
+				if tc.err != nil {
+					assert.Equal(tc.err, err)
+					continue
+				}
+				assert.NoError(err)
+				assert.Equal(tc.expected, result)
+
+				expected, err := ex.Calculate(src)
+				assert.NoError(err)
+				assert.Equal(expected, result)
+			}
+		})
+	}
+}
+
+func TestCalculateContext(t *testing.T) {
+	assert := require.New(t)
+
+	src := []byte(`{"items":[` + strings.Repeat(`1,`, 999) + `1]}`)
+	ex, err := Parse([]byte(`ALL .items (.@this == 1)`))
+	assert.NoError(err)
+
+	result, err := CalculateContext(context.Background(), ex, src)
+	assert.NoError(err)
+	assert.Equal(true, result)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = CalculateContext(ctx, ex, src)
+	assert.ErrorIs(err, context.Canceled)
+
+	// cancelled while calculating the predicate of each element.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var calls int
+	ex, err = Parse([]byte(`ALL .items (.@this == 1 && now() != NULL)`))
+	assert.NoError(err)
+	ex, err = Rewrite(ex, func(e Expression) (Expression, error) {
+		if n, ok := e.(Node); ok && n.Kind() == NodeNot {
+			return cancelAfter{n: 10, calls: &calls, cancel: cancel}, nil
+		}
+		return e, nil
+	})
+	assert.NoError(err)
+	_, err = CalculateContext(ctx, ex, src)
+	assert.ErrorIs(err, context.Canceled)
+	assert.Equal(10, calls)
+}
+
+// cancelAfter is an expression cancelling a context after it has been calculated n times.
+type cancelAfter struct {
+	n      int
+	calls  *int
+	cancel context.CancelFunc
+}
+
+func (c cancelAfter) Calculate(_ []byte) (any, error) {
+	*c.calls++
+	if *c.calls == c.n {
+		c.cancel()
+	}
+	return true, nil
+}
+
+func TestCalculateWithLimitsCustomCoercion(t *testing.T) {
+	assert := require.New(t)
+
+	env := customCoercionEnvironment()
+	src := []byte(`{"name":"joey"}`)
+
+	ex, err := ParseWith(env, []byte(`COERCE .name _rep_[2] == "joeyjoey"`))
+	assert.NoError(err)
+	result, err := CalculateWithLimits(context.Background(), ex, src, Limits{MaxSteps: 10})
+	assert.NoError(err)
+	assert.Equal(true, result)
+
+	_, err = CalculateWithLimits(context.Background(), ex, src, Limits{MaxStringLength: 4})
+	assert.Equal(ErrLimitExceeded{Limit: LimitStringLength, Max: 4}, err)
+
+	// a custom coercion is calculated as a single step.
+	ex, err = ParseWith(env, []byte(`COERCE .name _pathstar_`))
+	assert.NoError(err)
+	result, err = CalculateWithLimits(context.Background(), ex, src, Limits{MaxSteps: 1})
+	assert.NoError(err)
+	assert.Equal("****", result)
+}
@@ -0,0 +1,308 @@
+package ksql
+
+import (
+	"sort"
+
+	"github.com/tidwall/gjson"
+)
+
+// RuleID identifies a rule added to a Matcher.
+type RuleID string
+
+// Rule is an expression identified by a RuleID for use with a Matcher.
+type Rule struct {
+	ID         RuleID
+	Expression Expression
+}
+
+// Matcher finds which of many rules match some data, a rule matching when it calculates to true.
+//
+// Rather than calculating every rule, each rule that requires a selector path to equal a value, be IN a list
+// of values or be within a range eg. `.type == "login" && .attempts > 5` is indexed by that predicate. Only the
+// rules whose indexed predicate is satisfied by the data, along with those that can't be indexed, are then
+// calculated in full. The predicates indexed are those of selector paths compared with numbers, strings,
+// booleans or NULL that must be true for the rule to be true, which excludes those within `||` or `!`.
+//
+// A Matcher is safe for concurrent use.
+type Matcher struct {
+	rules []Rule
+
+	// unindexed are the rules always calculated in full.
+	unindexed []int
+
+	indexes []*pathIndex
+	root    *pathNode
+	complex []int
+}
+
+// NewMatcher returns a Matcher for the supplied rules.
+func NewMatcher(rules ...Rule) *Matcher {
+	m := &Matcher{
+		rules: rules,
+		root:  &pathNode{index: -1},
+	}
+	paths := make(map[string]*pathIndex)
+	for i, rule := range rules {
+		p, ok := accessPredicate(rule.Expression)
+		if !ok {
+			m.unindexed = append(m.unindexed, i)
+			continue
+		}
+		index, found := paths[p.path]
+		if !found {
+			index = &pathIndex{path: p.path, equals: make(map[any][]int)}
+			paths[p.path] = index
+			if !m.root.add(p.path, len(m.indexes)) {
+				m.complex = append(m.complex, len(m.indexes))
+			}
+			m.indexes = append(m.indexes, index)
+		}
+		index.add(p, i)
+	}
+	for _, index := range m.indexes {
+		for _, r := range index.ranges {
+			r.sort()
+		}
+	}
+	return m
+}
+
+// Match returns the IDs of the rules matching the supplied data in the order they were supplied. A rule that
+// returns an error when calculated does not match.
+func (m *Matcher) Match(src []byte) []RuleID {
+	results := make([]gjson.Result, len(m.indexes))
+	m.root.resolve(gjson.ParseBytes(src), results)
+	for _, i := range m.complex {
+		results[i] = gjson.GetBytes(src, m.indexes[i].path)
+	}
+
+	candidates := append([]int(nil), m.unindexed...)
+	for i, index := range m.indexes {
+		if results[i].IsObject() || results[i].IsArray() {
+			// neither equal to nor within the range of any indexed predicate.
+			continue
+		}
+		candidates = index.candidates(results[i].Value(), candidates)
+	}
+	sort.Ints(candidates)
+
+	var matched []RuleID
+	for _, i := range candidates {
+		result, err := m.rules[i].Expression.Calculate(src)
+		if b, ok := result.(bool); ok && b && err == nil {
+			matched = append(matched, m.rules[i].ID)
+		}
+	}
+	return matched
+}
+
+// predicate is a comparison of a selector path with a constant value that must be true for a rule to match.
+type predicate struct {
+	path string
+
+	// op is the comparison of the path with the values, NodeEquals for both `==` and IN.
+	op     NodeKind
+	values []any
+}
+
+// accessPredicate returns the predicate used to index the expression, preferring those comparing for
+// equality. Only the predicates that must be true for the expression to be true are considered ie. both
+// sides of `&&`.
+func accessPredicate(e Expression) (predicate, bool) {
+	if a, ok := e.(and); ok {
+		left, lok := accessPredicate(a.left)
+		right, rok := accessPredicate(a.right)
+		if rok && (!lok || (right.op == NodeEquals && left.op != NodeEquals)) {
+			return right, true
+		}
+		return left, lok
+	}
+
+	var op NodeKind
+	var path, constant Expression
+	switch n := e.(type) {
+	case eq:
+		op, path, constant = NodeEquals, n.left, n.right
+	case gt:
+		op, path, constant = NodeGt, n.left, n.right
+	case gte:
+		op, path, constant = NodeGte, n.left, n.right
+	case lt:
+		op, path, constant = NodeLt, n.left, n.right
+	case lte:
+		op, path, constant = NodeLte, n.left, n.right
+	case between:
+		// BETWEEN is exclusive so requires the value to be greater than the lower bound.
+		op, path, constant = NodeGt, n.value, n.left
+	case in:
+		s, ok := n.right.(Literal)
+		var values []any
+		if ok {
+			values, ok = s.Value().([]any)
+		} else if arr, isArray := n.right.(array); isArray {
+			values, ok = literalValues(arr.vec)
+		}
+		p, isPath := n.left.(selectorPath)
+		if !ok || !isPath || p.exact || !indexable(values...) {
+			return predicate{}, false
+		}
+		return predicate{path: p.s, op: NodeEquals, values: values}, true
+	default:
+		return predicate{}, false
+	}
+
+	if _, ok := path.(selectorPath); !ok {
+		if _, ok := e.(between); ok {
+			return predicate{}, false
+		}
+		// `5 < .path` is the same as `.path > 5`.
+		path, constant = constant, path
+		switch op {
+		case NodeGt:
+			op = NodeLt
+		case NodeGte:
+			op = NodeLte
+		case NodeLt:
+			op = NodeGt
+		case NodeLte:
+			op = NodeGte
+		}
+	}
+	p, isPath := path.(selectorPath)
+	c, isConstant := constant.(Literal)
+	if !isPath || !isConstant || p.exact || !indexable(c.Value()) {
+		return predicate{}, false
+	}
+	if op != NodeEquals {
+		// only numbers and strings are ordered, a range of either type excluding NULL.
+		if t := argTypeOf(c.Value()); t != ArgNumber && t != ArgString {
+			return predicate{}, false
+		}
+	}
+	return predicate{path: p.s, op: op, values: []any{c.Value()}}, true
+}
+
+// literalValues returns the values of the expressions if all are literals.
+func literalValues(exps []Expression) ([]any, bool) {
+	values := make([]any, len(exps))
+	for i, e := range exps {
+		l, ok := e.(Literal)
+		if !ok {
+			return nil, false
+		}
+		values[i] = l.Value()
+	}
+	return values, true
+}
+
+// indexable returns if the values are those of a selector path compared using Go equality, which excludes
+// exact numbers as they are compared by value.
+func indexable(values ...any) bool {
+	for _, v := range values {
+		switch v.(type) {
+		case nil, bool, float64, string:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// pathIndex indexes the rules by the predicates of a single selector path.
+type pathIndex struct {
+	path string
+
+	// equals are the rules by the value the path must equal.
+	equals map[any][]int
+
+	// ranges are the rules by the bounds of the path's value, by the type of the bounds.
+	ranges map[ArgType]*rangeIndex
+}
+
+func (pi *pathIndex) add(p predicate, rule int) {
+	if p.op == NodeEquals {
+		seen := make(map[any]bool, len(p.values))
+		for _, v := range p.values {
+			if !seen[v] {
+				seen[v] = true
+				pi.equals[v] = append(pi.equals[v], rule)
+			}
+		}
+		return
+	}
+
+	t := argTypeOf(p.values[0])
+	if pi.ranges == nil {
+		pi.ranges = make(map[ArgType]*rangeIndex)
+	}
+	r, found := pi.ranges[t]
+	if !found {
+		r = &rangeIndex{}
+		pi.ranges[t] = r
+	}
+	b := bound{value: p.values[0], rule: rule}
+	switch p.op {
+	case NodeGt:
+		r.gt = append(r.gt, b)
+	case NodeGte:
+		r.gte = append(r.gte, b)
+	case NodeLt:
+		r.lt = append(r.lt, b)
+	default:
+		r.lte = append(r.lte, b)
+	}
+}
+
+// candidates appends the rules whose predicate is satisfied by the value of the path.
+func (pi *pathIndex) candidates(value any, rules []int) []int {
+	rules = append(rules, pi.equals[value]...)
+	if r, found := pi.ranges[argTypeOf(value)]; found {
+		rules = r.candidates(value, rules)
+	}
+	return rules
+}
+
+// bound is the constant a rule's range predicate compares the path with.
+type bound struct {
+	value any
+	rule  int
+}
+
+// rangeIndex holds the bounds of the range predicates of a single type, each sorted in ascending order.
+type rangeIndex struct {
+	gt, gte, lt, lte []bound
+}
+
+func (r *rangeIndex) sort() {
+	for _, bounds := range [][]bound{r.gt, r.gte, r.lt, r.lte} {
+		bounds := bounds
+		sort.SliceStable(bounds, func(i, j int) bool {
+			cmp, _ := compareValues(bounds[i].value, bounds[j].value)
+			return cmp < 0
+		})
+	}
+}
+
+// candidates appends the rules whose range includes the value.
+func (r *rangeIndex) candidates(value any, rules []int) []int {
+	// search returns the index of the first bound for which the comparison of it with the value is true.
+	search := func(bounds []bound, fn func(cmp int) bool) int {
+		return sort.Search(len(bounds), func(i int) bool {
+			cmp, _ := compareValues(bounds[i].value, value)
+			return fn(cmp)
+		})
+	}
+	appendRules := func(bounds []bound) {
+		for _, b := range bounds {
+			rules = append(rules, b.rule)
+		}
+	}
+
+	// `.path > bound` includes the bounds less than the value.
+	appendRules(r.gt[:search(r.gt, func(cmp int) bool { return cmp >= 0 })])
+	appendRules(r.gte[:search(r.gte, func(cmp int) bool { return cmp > 0 })])
+	// `.path < bound` includes the bounds greater than the value.
+	appendRules(r.lt[search(r.lt, func(cmp int) bool { return cmp > 0 }):])
+	appendRules(r.lte[search(r.lte, func(cmp int) bool { return cmp >= 0 }):])
+	return rules
+}
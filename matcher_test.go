@@ -0,0 +1,116 @@
+package ksql
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatcher(t *testing.T) {
+	assert := require.New(t)
+
+	expressions := []string{
+		`.type == "login"`,
+		`.type == "login" && .attempts > 5`,
+		`.attempts > 5 && .type == "login"`,
+		`.attempts >= 5`,
+		`.attempts < 3`,
+		`.attempts <= 3`,
+		`5 < .attempts`,
+		`"login" == .type`,
+		`.attempts BETWEEN 1 10`,
+		`.type IN ["login", "logout"]`,
+		`.type IN ["login", "login"]`,
+		`.user.name >= "m"`,
+		`.user.name < "m"`,
+		`.user.admin == true`,
+		`.user.admin == NULL`,
+		`.missing == NULL && .type != "logout"`,
+		`.type == "login" || .attempts > 100`,
+		`!(.type == "login")`,
+		`.tags.0 == "a"`,
+		`.tags.# == 2`,
+		`.user.na* == "amy"`,
+		`.attempts + 1 > 6`,
+		`.type == .user.name`,
+		`.type`,
+		`.attempts / "x" == 1 && .type == "login"`,
+		`.user == NULL`,
+		`.attempts > "5"`,
+		`.type > 5`,
+	}
+	docs := []string{
+		`{"type":"login","attempts":6,"user":{"name":"zed","admin":true},"tags":["a","b"]}`,
+		`{"type":"logout","attempts":2,"user":{"name":"amy","admin":null},"tags":["b"]}`,
+		`{"type":"login","attempts":5,"user":{"name":"m"}}`,
+		`{"type":true,"attempts":"6","user":[],"tags":{}}`,
+		`{"type":"login","attempts":-1.5}`,
+		`[]`,
+		`{}`,
+		``,
+	}
+
+	rules := make([]Rule, len(expressions))
+	for i, exp := range expressions {
+		ex, err := Parse([]byte(exp))
+		assert.NoError(err, exp)
+		rules[i] = Rule{ID: RuleID(fmt.Sprint(i)), Expression: ex}
+	}
+	m := NewMatcher(rules...)
+
+	for _, doc := range docs {
+		var expected []RuleID
+		for _, rule := range rules {
+			result, err := rule.Expression.Calculate([]byte(doc))
+			if b, ok := result.(bool); ok && b && err == nil {
+				expected = append(expected, rule.ID)
+			}
+		}
+		assert.Equal(expected, m.Match([]byte(doc)), doc)
+	}
+}
+
+func TestMatcherIndexesPredicates(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		exp       string
+		predicate predicate
+		indexed   bool
+	}{
+		{exp: `.a == 1`, predicate: predicate{path: "a", op: NodeEquals, values: []any{1.0}}, indexed: true},
+		{exp: `"x" == .a`, predicate: predicate{path: "a", op: NodeEquals, values: []any{"x"}}, indexed: true},
+		{exp: `.a > 1 && .b == true`, predicate: predicate{path: "b", op: NodeEquals, values: []any{true}}, indexed: true},
+		{exp: `.a > 1 && .b > 2`, predicate: predicate{path: "a", op: NodeGt, values: []any{1.0}}, indexed: true},
+		{exp: `1 >= .a`, predicate: predicate{path: "a", op: NodeLte, values: []any{1.0}}, indexed: true},
+		{exp: `.a BETWEEN "a" "c"`, predicate: predicate{path: "a", op: NodeGt, values: []any{"a"}}, indexed: true},
+		{exp: `.a IN [1, NULL]`, predicate: predicate{path: "a", op: NodeEquals, values: []any{1.0, nil}}, indexed: true},
+		{exp: `.a IN [[1]]`},
+		{exp: `.a > NULL`},
+		{exp: `.a > true`},
+		{exp: `.a == 1 || .b == 2`},
+		{exp: `.a == .b`},
+		{exp: `len(.a) == 1`},
+		{exp: `1 BETWEEN .a .b`},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.exp, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			p, indexed := accessPredicate(ex)
+			assert.Equal(tc.indexed, indexed)
+			assert.Equal(tc.predicate, p)
+		})
+	}
+
+	ex, err := ParseWithOptions([]byte(`.a == 1`), ParseOptions{ExactNumbers: true})
+	assert.NoError(err)
+	_, indexed := accessPredicate(ex)
+	assert.False(indexed)
+}
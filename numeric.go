@@ -0,0 +1,265 @@
+package ksql
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Exact numbers are represented as int64, falling back to *big.Int for integers that do not fit, and
+// *big.Rat for all other values. Results are always normalized to the smallest of these representations
+// so that equal numbers have the same type.
+//
+// When an operation mixes an exact number with a float64 the float64 is converted to an exact number
+// using its shortest decimal representation, so that `0.1` is exactly one tenth, and the result is exact.
+
+// isExactNumber returns if the value is an int64, *big.Int or *big.Rat.
+func isExactNumber(value any) bool {
+	switch value.(type) {
+	case int64, *big.Int, *big.Rat:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseExactNumber parses the text of a number into its exact representation.
+func parseExactNumber(s string) (any, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, false
+	}
+	return normalizeRat(r), true
+}
+
+// normalizeInt returns the integer as an int64 if it fits.
+func normalizeInt(i *big.Int) any {
+	if i.IsInt64() {
+		return i.Int64()
+	}
+	return i
+}
+
+// normalizeRat returns the number as an int64 or *big.Int if it is an integer.
+func normalizeRat(r *big.Rat) any {
+	if r.IsInt() {
+		return normalizeInt(new(big.Int).Set(r.Num()))
+	}
+	return r
+}
+
+// toRat converts an exact number or finite float64 into a *big.Rat.
+func toRat(value any) (*big.Rat, bool) {
+	switch v := value.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case *big.Int:
+		return new(big.Rat).SetInt(v), true
+	case *big.Rat:
+		return v, true
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, false
+		}
+		return new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		return nil, false
+	}
+}
+
+// toFloat converts an exact number into the nearest float64.
+func toFloat(value any) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f
+	default:
+		return value.(float64)
+	}
+}
+
+// truncateExact truncates an exact number towards zero.
+func truncateExact(value any) any {
+	r, ok := value.(*big.Rat)
+	if !ok {
+		return value
+	}
+	return normalizeInt(new(big.Int).Quo(r.Num(), r.Denom()))
+}
+
+// exactOperands converts both values into *big.Rat if both are numbers and at least one is exact.
+func exactOperands(left, right any) (l, r *big.Rat, ok bool) {
+	if !isExactNumber(left) && !isExactNumber(right) {
+		return nil, nil, false
+	}
+	if l, ok = toRat(left); !ok {
+		return nil, nil, false
+	}
+	if r, ok = toRat(right); !ok {
+		return nil, nil, false
+	}
+	return l, r, true
+}
+
+// exactArithmetic applies the arithmetic operator to the values if both are numbers and at least one is
+// exact, returning false if not.
+func exactArithmetic(op byte, left, right any) (any, bool, error) {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			if result, ok := int64Arithmetic(op, l, r); ok {
+				return result, true, nil
+			}
+		}
+	}
+
+	l, r, ok := exactOperands(left, right)
+	if !ok {
+		return nil, false, nil
+	}
+	result := new(big.Rat)
+	switch op {
+	case '+':
+		result.Add(l, r)
+	case '-':
+		result.Sub(l, r)
+	case '*':
+		result.Mul(l, r)
+	default:
+		if r.Sign() == 0 {
+			return nil, true, ErrDivisionByZero{}
+		}
+		result.Quo(l, r)
+	}
+	return normalizeRat(result), true, nil
+}
+
+// int64Arithmetic is the fast path for arithmetic between int64, returning false if the result would
+// overflow or is not an integer.
+func int64Arithmetic(op byte, l, r int64) (int64, bool) {
+	switch op {
+	case '+':
+		result := l + r
+		return result, (result > l) == (r > 0)
+	case '-':
+		result := l - r
+		return result, (result < l) == (r > 0)
+	case '*':
+		if l == 0 || r == 0 {
+			return 0, true
+		}
+		result := l * r
+		return result, result/r == l && !(l == -1 && r == math.MinInt64) && !(r == -1 && l == math.MinInt64)
+	default:
+		if r == 0 || l%r != 0 || (l == math.MinInt64 && r == -1) {
+			return 0, false
+		}
+		return l / r, true
+	}
+}
+
+// compareNumbers compares the values if both are numbers and at least one is exact, returning -1, 0 or +1.
+func compareNumbers(left, right any) (int, bool) {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			switch {
+			case l < r:
+				return -1, true
+			case l > r:
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	}
+	l, r, ok := exactOperands(left, right)
+	if !ok {
+		return 0, false
+	}
+	return l.Cmp(r), true
+}
+
+// valuesEqual returns if the values are equal, comparing exact numbers by value.
+func valuesEqual(left, right any) bool {
+	if cmp, ok := compareNumbers(left, right); ok {
+		return cmp == 0
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// formatExactNumber returns the decimal text of an exact number. Numbers without a finite decimal
+// representation eg. one third are rounded to 20 decimal places.
+func formatExactNumber(value any) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case *big.Int:
+		return v.String()
+	default:
+		r := value.(*big.Rat)
+		// a fraction has a finite decimal representation when its denominator has no prime factors
+		// other than 2 and 5, requiring as many decimal places as the larger of their powers.
+		d := new(big.Int).Set(r.Denom())
+		var twos, fives int
+		for d.Bit(0) == 0 {
+			d.Rsh(d, 1)
+			twos++
+		}
+		five := big.NewInt(5)
+		m := new(big.Int)
+		for {
+			q, rem := new(big.Int).QuoRem(d, five, m)
+			if rem.Sign() != 0 {
+				break
+			}
+			d = q
+			fives++
+		}
+		if d.Cmp(big.NewInt(1)) != 0 {
+			return strings.TrimRight(r.FloatString(20), "0")
+		}
+		if fives > twos {
+			twos = fives
+		}
+		return r.FloatString(twos)
+	}
+}
+
+// exactJSONValue returns the value of the gjson result with all numbers, including those within arrays
+// and objects, as exact numbers.
+func exactJSONValue(result gjson.Result) any {
+	switch {
+	case result.Type == gjson.Number:
+		if n, ok := parseExactNumber(result.Raw); ok {
+			return n
+		}
+		return result.Num
+	case result.IsArray():
+		arr := make([]any, 0)
+		result.ForEach(func(_, value gjson.Result) bool {
+			arr = append(arr, exactJSONValue(value))
+			return true
+		})
+		return arr
+	case result.IsObject():
+		obj := make(map[string]any)
+		result.ForEach(func(key, value gjson.Result) bool {
+			obj[key.String()] = exactJSONValue(value)
+			return true
+		})
+		return obj
+	default:
+		return result.Value()
+	}
+}
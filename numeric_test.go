@@ -0,0 +1,237 @@
+package ksql
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExactNumbers(t *testing.T) {
+	assert := require.New(t)
+
+	bigInt, _ := new(big.Int).SetString("9223372036854775808", 10)
+
+	tests := []struct {
+		name     string
+		exp      string
+		src      string
+		expected any
+		err      error
+	}{
+		{
+			name:     "large integer equality",
+			exp:      `.id == 9007199254740993`,
+			src:      `{"id":9007199254740992}`,
+			expected: false,
+		},
+		{
+			name:     "integer",
+			exp:      `.id`,
+			src:      `{"id":9007199254740993}`,
+			expected: int64(9007199254740993),
+		},
+		{
+			name:     "decimal sum",
+			exp:      `0.1 + 0.2 == 0.3`,
+			expected: true,
+		},
+		{
+			name:     "decimal product",
+			exp:      `.price * .qty`,
+			src:      `{"price":19.99,"qty":3}`,
+			expected: big.NewRat(5997, 100),
+		},
+		{
+			name:     "integer overflow",
+			exp:      `9223372036854775807 + 1`,
+			expected: bigInt,
+		},
+		{
+			name:     "big integer normalized",
+			exp:      `9223372036854775808 - 1`,
+			expected: int64(9223372036854775807),
+		},
+		{
+			name:     "exact division",
+			exp:      `6 / 3`,
+			expected: int64(2),
+		},
+		{
+			name:     "fractional division",
+			exp:      `1 / 4`,
+			expected: big.NewRat(1, 4),
+		},
+		{
+			name: "division by zero",
+			exp:  `1 / .zero`,
+			src:  `{"zero":0}`,
+			err:  ErrDivisionByZero{},
+		},
+		{
+			name:     "comparison",
+			exp:      `.a > 1.5 && .a <= 2 && .a >= 2.0 && .a < 3`,
+			src:      `{"a":2}`,
+			expected: true,
+		},
+		{
+			name:     "between",
+			exp:      `.a BETWEEN 0.1 0.3`,
+			src:      `{"a":0.2}`,
+			expected: true,
+		},
+		{
+			name:     "in",
+			exp:      `.a IN [1, 2.0]`,
+			src:      `{"a":2}`,
+			expected: true,
+		},
+		{
+			name:     "array values",
+			exp:      `.a`,
+			src:      `{"a":[1,2.5]}`,
+			expected: []any{int64(1), big.NewRat(5, 2)},
+		},
+		{
+			name:     "mixed with float function result",
+			exp:      `len(.s) + 0.1`,
+			src:      `{"s":"abc"}`,
+			expected: big.NewRat(31, 10),
+		},
+		{
+			name:     "coerce number",
+			exp:      `COERCE .a _number_`,
+			src:      `{"a":2.5}`,
+			expected: 2.5,
+		},
+		{
+			name:     "coerce string",
+			exp:      `COERCE (.a / 8) _string_`,
+			src:      `{"a":1}`,
+			expected: "0.125",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := ParseWithOptions([]byte(tc.exp), ParseOptions{ExactNumbers: true})
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(tc.src))
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestIntDecimalCoercions(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		src      string
+		expected any
+		err      bool
+	}{
+		{
+			name:     "int from string",
+			exp:      `COERCE .a _int_`,
+			src:      `{"a":"-12.7"}`,
+			expected: int64(-12),
+		},
+		{
+			name:     "int from float",
+			exp:      `COERCE .a _int_`,
+			src:      `{"a":12.7}`,
+			expected: int64(12),
+		},
+		{
+			name:     "int from bool",
+			exp:      `COERCE true _int_`,
+			expected: int64(1),
+		},
+		{
+			name:     "int from null",
+			exp:      `COERCE .missing _int_`,
+			expected: nil,
+		},
+		{
+			name: "int from invalid string",
+			exp:  `COERCE .a _int_`,
+			src:  `{"a":"abc"}`,
+			err:  true,
+		},
+		{
+			name:     "decimal from string",
+			exp:      `COERCE .a _decimal_`,
+			src:      `{"a":"19.99"}`,
+			expected: big.NewRat(1999, 100),
+		},
+		{
+			name:     "decimal arithmetic with float",
+			exp:      `COERCE .price _decimal_ * .qty == COERCE "59.97" _decimal_`,
+			src:      `{"price":19.99,"qty":3}`,
+			expected: true,
+		},
+		{
+			name:     "decimal integer",
+			exp:      `COERCE "42.0" _decimal_`,
+			expected: int64(42),
+		},
+		{
+			name:     "int compared with float",
+			exp:      `COERCE .a _int_ == 5`,
+			src:      `{"a":"5"}`,
+			expected: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(tc.src))
+			if tc.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestExactNumbersFormatAndParams(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := ParseWithOptions([]byte(`.a + 0.10 * 9223372036854775808`), ParseOptions{ExactNumbers: true})
+	assert.NoError(err)
+	assert.Equal(`.a + 0.1 * 9223372036854775808`, Format(ex))
+
+	env := NewEnvironment()
+	env.Options.ExactNumbers = true
+
+	ex, err = env.ParseWithParams([]byte(`.id == $id`), map[string]any{"id": uint64(9007199254740993)})
+	assert.NoError(err)
+	result, err := ex.Calculate([]byte(`{"id":9007199254740993}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+
+	ex, err = env.Parse([]byte(`.id IN $ids`))
+	assert.NoError(err)
+	result, err = CalculateWithParams(ex, []byte(`{"id":9007199254740993}`), map[string]any{"ids": []int64{9007199254740992, 9007199254740993}})
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
@@ -0,0 +1,151 @@
+package ksql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectLiterals(t *testing.T) {
+	assert := require.New(t)
+
+	const src = `{"id":"a1","price":2.5,"qty":4,"a":"x","b":"y","user":{"name":"joey","age":30}}`
+
+	tests := []struct {
+		name     string
+		exp      string
+		expected any
+	}{
+		{
+			name: "projection",
+			exp:  `{ "id": .id, "total": .price * .qty, "tags": [.a, .b] }`,
+			expected: map[string]any{
+				"id":    "a1",
+				"total": 10.0,
+				"tags":  []any{"x", "y"},
+			},
+		},
+		{
+			name: "without whitespace",
+			exp:  `{"id":.id,"tags":[.a,.b],"name":.user.name}`,
+			expected: map[string]any{
+				"id":   "a1",
+				"tags": []any{"x", "y"},
+				"name": "joey",
+			},
+		},
+		{
+			name:     "empty",
+			exp:      `{}`,
+			expected: map[string]any{},
+		},
+		{
+			name: "nested",
+			exp:  `{"user": {"name": upper(.user.name), "adult": .user.age >= 18}}`,
+			expected: map[string]any{
+				"user": map[string]any{"name": "JOEY", "adult": true},
+			},
+		},
+		{
+			name:     "selector before closing brace",
+			exp:      `{"id": .id}`,
+			expected: map[string]any{"id": "a1"},
+		},
+		{
+			name:     "missing value is null",
+			exp:      `{"missing": .missing}`,
+			expected: map[string]any{"missing": nil},
+		},
+		{
+			name:     "single quoted key",
+			exp:      `{'id': .id}`,
+			expected: map[string]any{"id": "a1"},
+		},
+		{
+			name:     "conditional value",
+			exp:      `{"tier": IF .qty > 3 THEN "bulk" ELSE "single"}`,
+			expected: map[string]any{"tier": "bulk"},
+		},
+		{
+			name:     "within array",
+			exp:      `[{"a": 1}, {"b": 2}]`,
+			expected: []any{map[string]any{"a": 1.0}, map[string]any{"b": 2.0}},
+		},
+		{
+			name:     "compared",
+			exp:      `{"a": .a} == {"a": "x"}`,
+			expected: true,
+		},
+		{
+			name:     "gjson multipath within selector",
+			exp:      `{"user": .user.{name,age}}`,
+			expected: map[string]any{"user": map[string]any{"name": "joey", "age": 30.0}},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(src))
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestObjectLiteralsParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name string
+		exp  string
+		err  string
+	}{
+		{
+			name: "non string key",
+			exp:  `{1: .id}`,
+			err:  "1:2: unexpected token `1`, expected one of string, }",
+		},
+		{
+			name: "missing colon",
+			exp:  `{"id" .id}`,
+			err:  "1:7: unexpected token `.id`, expected :",
+		},
+		{
+			name: "missing value",
+			exp:  `{"id": }`,
+			err:  "1:8: token is not a valid value `}`, expected one of selector path, string, number, true, false, NULL, parameter, function, IF, CASE, EXISTS, ANY, ALL, NONE, [, {, (, !, COERCE",
+		},
+		{
+			name: "trailing comma",
+			exp:  `{"id": 1,}`,
+			err:  "1:10: unexpected token `}`, expected string",
+		},
+		{
+			name: "unclosed",
+			exp:  `{"id": 1`,
+			err:  "1:9: expression ends unexpectedly, expected one of ,, }",
+		},
+		{
+			name: "duplicate key",
+			exp:  `{"id": 1, "id": 2}`,
+			err:  "1:11: duplicate object key `id`",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.exp))
+			assert.Error(err)
+			assert.Equal(tc.err, err.Error())
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package ksql
+
+import (
+	"math/big"
+	"reflect"
+	"time"
+)
+
+// Bind returns a copy of the expression with the supplied values bound to its named parameters, leaving
+// the original expression unchanged so that it can be bound again with different values. Parameters
+// already bound are replaced when a new value is supplied and any COERCE whose value becomes a constant
+// is calculated once, as it would have been if the values were supplied to ParseWithParams.
+//
+// Parameters without a supplied value remain unbound and return ErrUnboundParameter when calculated. Custom
+// coercions are calculated as parsed, so only ParseWithParams binds parameters within their value.
+func Bind(e Expression, params map[string]any) (Expression, error) {
+	return Rewrite(e, func(e Expression) (Expression, error) {
+		switch n := e.(type) {
+		case parameter:
+			value, found := params[n.name]
+			if !found {
+				return e, nil
+			}
+			return bindParameter(n.name, value, n.exact)
+		case boundParameter:
+			value, found := params[n.name]
+			if !found {
+				return e, nil
+			}
+			return bindParameter(n.name, value, n.exact)
+		case Coercion:
+			return foldCoercion(n)
+		case call:
+			return foldCall(n)
+		default:
+			return e, nil
+		}
+	})
+}
+
+// CalculateWithParams binds the supplied values to the named parameters of the expression and applies it
+// to the supplied data. When calculating many times with the same values use Bind once instead.
+func CalculateWithParams(e Expression, src []byte, params map[string]any) (any, error) {
+	bound, err := Bind(e, params)
+	if err != nil {
+		return nil, err
+	}
+	return bound.Calculate(src)
+}
+
+// Parameters returns the unique names of all named parameters within the expression, bound or not, in
+// the order they appear.
+func Parameters(e Expression) []string {
+	var names []string
+	seen := make(map[string]struct{})
+	Inspect(e, func(e Expression) bool {
+		if p, ok := e.(NamedParameter); ok {
+			if _, found := seen[p.ParameterName()]; !found {
+				seen[p.ParameterName()] = struct{}{}
+				names = append(names, p.ParameterName())
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// bindParameter returns a bound parameter node holding the value converted to the types produced when
+// calculating an expression eg. numbers are float64, or exact numbers when parsed with
+// ParseOptions.ExactNumbers, and slices are []any.
+func bindParameter(name string, value any, exact bool) (Expression, error) {
+	v, ok := parameterValue(value, exact)
+	if !ok {
+		return nil, ErrUnsupportedParameter{Name: name, Value: value}
+	}
+	return boundParameter{name: name, value: v, exact: exact}, nil
+}
+
+func parameterValue(value any, exact bool) (any, bool) {
+	switch v := value.(type) {
+	case nil, bool, string, float64, time.Time, time.Duration, map[string]any, *big.Int, *big.Rat:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		if exact {
+			return v, true
+		}
+		return float64(v), true
+	case uint64:
+		if exact {
+			return normalizeInt(new(big.Int).SetUint64(v)), true
+		}
+		return float64(v), true
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return parameterValue(rv.Int(), exact)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return parameterValue(rv.Uint(), exact)
+	case reflect.Slice, reflect.Array:
+		arr := make([]any, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			v, ok := parameterValue(rv.Index(i).Interface(), exact)
+			if !ok {
+				return nil, false
+			}
+			arr = append(arr, v)
+		}
+		return arr, true
+	default:
+		return nil, false
+	}
+}
+
+// foldCoercion calculates a coercion whose value has become a constant, the same as is done at parse time.
+func foldCoercion(c Coercion) (Expression, error) {
+	if _, ok := c.(Literal); ok {
+		return c, nil
+	}
+	if _, ok := c.(coerceCustom); ok {
+		// custom coercions are calculated as parsed.
+		return c, nil
+	}
+	value := c.Children()[0]
+	if _, ok := value.(Literal); !ok {
+		return c, nil
+	}
+
+	result, err := c.Calculate([]byte{})
+	if err != nil {
+		return nil, err
+	}
+	return coercedConstant{value: result, expression: c}, nil
+}
@@ -0,0 +1,199 @@
+package ksql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWithParams(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		params   map[string]any
+		src      string
+		expected any
+		err      error
+	}{
+		{
+			name:     "number",
+			exp:      `.age >= $min_age`,
+			params:   map[string]any{"min_age": 18},
+			src:      `{"age":21}`,
+			expected: true,
+		},
+		{
+			name:     "string",
+			exp:      `.name == $name`,
+			params:   map[string]any{"name": "Joeybloggs"},
+			src:      `{"name":"Joeybloggs"}`,
+			expected: true,
+		},
+		{
+			name:     "null",
+			exp:      `.name == $name`,
+			params:   map[string]any{"name": nil},
+			src:      `{}`,
+			expected: true,
+		},
+		{
+			name:     "IN string slice",
+			exp:      `.id IN $ids`,
+			params:   map[string]any{"ids": []string{"a", "b"}},
+			src:      `{"id":"b"}`,
+			expected: true,
+		},
+		{
+			name:     "IN int slice",
+			exp:      `.id IN $ids`,
+			params:   map[string]any{"ids": []int{1, 2}},
+			src:      `{"id":3}`,
+			expected: false,
+		},
+		{
+			name:     "CONTAINS_ANY",
+			exp:      `.tags CONTAINS_ANY $tags`,
+			params:   map[string]any{"tags": []any{"x", "y"}},
+			src:      `{"tags":["a","y"]}`,
+			expected: true,
+		},
+		{
+			name:     "arithmetic",
+			exp:      `.a + $b * 2`,
+			params:   map[string]any{"b": float32(1.5)},
+			src:      `{"a":1}`,
+			expected: 4.0,
+		},
+		{
+			name:     "coerce",
+			exp:      `COERCE .name _lowercase_ == COERCE $name _lowercase_`,
+			params:   map[string]any{"name": "JOEY"},
+			src:      `{"name":"Joey"}`,
+			expected: true,
+		},
+		{
+			name:     "datetime",
+			exp:      `COERCE .dt _datetime_ > $after`,
+			params:   map[string]any{"after": time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			src:      `{"dt":"2022-01-02"}`,
+			expected: true,
+		},
+		{
+			name:   "unbound",
+			exp:    `.age >= $min_age`,
+			params: map[string]any{"other": 1},
+			src:    `{"age":21}`,
+			err:    ErrUnboundParameter{Name: "min_age"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := ParseWithParams([]byte(tc.exp), tc.params)
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(tc.src))
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestParseWithParamsErrors(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := ParseWithParams([]byte(`.a == $a`), map[string]any{"a": struct{}{}})
+	assert.Error(err)
+
+	var syntaxErr ErrSyntax
+	assert.ErrorAs(err, &syntaxErr)
+	assert.Equal(6, syntaxErr.Offset)
+	assert.Equal("$a", syntaxErr.Token)
+	assert.ErrorAs(err, &ErrUnsupportedParameter{})
+}
+
+func TestParamsConstantFolding(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := ParseWithParams([]byte(`COERCE $name _lowercase_`), map[string]any{"name": "ABC"})
+	assert.NoError(err)
+	folded, ok := ex.(Literal)
+	assert.True(ok)
+	assert.Equal("abc", folded.Value())
+
+	ex, err = Parse([]byte(`COERCE $name _lowercase_`))
+	assert.NoError(err)
+	_, ok = ex.(Literal)
+	assert.False(ok)
+
+	bound, err := Bind(ex, map[string]any{"name": "DEF"})
+	assert.NoError(err)
+	folded, ok = bound.(Literal)
+	assert.True(ok)
+	assert.Equal("def", folded.Value())
+}
+
+func TestParamsConstantFoldingCustomCoercion(t *testing.T) {
+	assert := require.New(t)
+
+	env := repEnvironment()
+	ex, err := env.ParseWithParams([]byte(`COERCE $name _rep_[3]`), map[string]any{"name": "ab"})
+	assert.NoError(err)
+	folded, ok := ex.(Literal)
+	assert.True(ok)
+	assert.Equal("ababab", folded.Value())
+
+	// custom coercions are calculated as parsed so Bind doesn't bind parameters within their value.
+	ex, err = ParseWith(env, []byte(`COERCE $name _rep_[3]`))
+	assert.NoError(err)
+	bound, err := Bind(ex, map[string]any{"name": "ab"})
+	assert.NoError(err)
+	_, err = bound.Calculate(nil)
+	assert.Equal(ErrUnboundParameter{Name: "name"}, err)
+}
+
+func TestBind(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`.age >= $min_age && .country IN $countries`))
+	assert.NoError(err)
+	assert.Equal([]string{"min_age", "countries"}, Parameters(ex))
+	assert.Equal(`.age >= $min_age && .country IN $countries`, Format(ex))
+
+	_, err = ex.Calculate([]byte(`{"age":21,"country":"CA"}`))
+	assert.Equal(ErrUnboundParameter{Name: "min_age"}, err)
+
+	adults, err := Bind(ex, map[string]any{"min_age": 18, "countries": []string{"CA", "US"}})
+	assert.NoError(err)
+	result, err := adults.Calculate([]byte(`{"age":21,"country":"CA"}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+
+	seniors, err := Bind(adults, map[string]any{"min_age": 65})
+	assert.NoError(err)
+	result, err = seniors.Calculate([]byte(`{"age":21,"country":"CA"}`))
+	assert.NoError(err)
+	assert.Equal(false, result)
+
+	partial, err := Bind(ex, map[string]any{"min_age": 18})
+	assert.NoError(err)
+	_, err = partial.Calculate([]byte(`{"age":21,"country":"CA"}`))
+	assert.Equal(ErrUnboundParameter{Name: "countries"}, err)
+
+	_, err = Bind(ex, map[string]any{"min_age": make(chan int)})
+	assert.ErrorAs(err, &ErrUnsupportedParameter{})
+
+	result, err = CalculateWithParams(ex, []byte(`{"age":70,"country":"US"}`), map[string]any{"min_age": 65, "countries": []string{"US"}})
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
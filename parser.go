@@ -1,14 +1,17 @@
 package ksql
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-playground/itertools"
 	syncext "github.com/go-playground/pkg/v5/sync"
 	optionext "github.com/go-playground/pkg/v5/values/option"
 	resultext "github.com/go-playground/pkg/v5/values/result"
-	"io"
+	"math"
+	"math/big"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -21,16 +24,19 @@ import (
 
 var (
 	// Coercions is a `map` of all coercions guarded by a Mutex for use allowing registration,
-	// removal or even replacing of existing coercions.
-	Coercions = syncext.NewRWMutex2(map[string]func(p *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error){
-		"_datetime_": func(_ *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
-			expression = coerceDateTime{value: expression}
+	// removal or even replacing of existing coercions. These are the coercions used by Parse and copied by
+	// NewEnvironment.
+	Coercions = syncext.NewRWMutex2(map[string]coercionFunc{
+		"_datetime_":        dateTimeCoercion(false),
+		"_datetime_strict_": dateTimeCoercion(true),
+		"_duration_": func(_ *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
+			expression = coerceDuration{value: expression}
 			if constEligible {
 				value, err := expression.Calculate([]byte{})
 				if err != nil {
 					return false, nil, err
 				}
-				return constEligible, coercedConstant{value: value}, nil
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
 			} else {
 				return false, expression, nil
 			}
@@ -42,7 +48,7 @@ var (
 				if err != nil {
 					return false, nil, err
 				}
-				return constEligible, coercedConstant{value: value}, nil
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
 			} else {
 				return false, expression, nil
 			}
@@ -54,7 +60,7 @@ var (
 				if err != nil {
 					return false, nil, err
 				}
-				return constEligible, coercedConstant{value: value}, nil
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
 			} else {
 				return false, expression, nil
 			}
@@ -66,7 +72,31 @@ var (
 				if err != nil {
 					return false, nil, err
 				}
-				return constEligible, coercedConstant{value: value}, nil
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
+			} else {
+				return false, expression, nil
+			}
+		},
+		"_int_": func(_ *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
+			expression = coerceInt{value: expression}
+			if constEligible {
+				value, err := expression.Calculate([]byte{})
+				if err != nil {
+					return false, nil, err
+				}
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
+			} else {
+				return false, expression, nil
+			}
+		},
+		"_decimal_": func(_ *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
+			expression = coerceDecimal{value: expression}
+			if constEligible {
+				value, err := expression.Calculate([]byte{})
+				if err != nil {
+					return false, nil, err
+				}
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
 			} else {
 				return false, expression, nil
 			}
@@ -78,7 +108,7 @@ var (
 				if err != nil {
 					return false, nil, err
 				}
-				return constEligible, coercedConstant{value: value}, nil
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
 			} else {
 				return false, expression, nil
 			}
@@ -90,98 +120,60 @@ var (
 				if err != nil {
 					return false, nil, err
 				}
-				return constEligible, coercedConstant{value: value}, nil
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
 			} else {
 				return false, expression, nil
 			}
 		},
 		"_substr_": func(p *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
 			// get substring info, expect the format to be _substr_[Start:end]
-
-			leftBracket := p.Tokenizer.Next()
-			if leftBracket.IsNone() {
-				return false, nil, ErrCustom{S: "Expected [ after _substr_"}
-			} else if leftBracket.Unwrap().IsErr() {
-				return false, nil, ErrInvalidCoerce{Err: leftBracket.Unwrap().Err()}
-			} else if leftBracket.Unwrap().Unwrap().Kind != OpenBracket {
-				return false, nil, ErrCustom{S: "Expected [ after _substr_"}
+			if _, err := p.expectToken(OpenBracket); err != nil {
+				return false, nil, err
 			}
 
 			// number or colon
 			var startIndex optionext.Option[int]
-			token := p.Tokenizer.Next()
-			if token.IsNone() {
-				return false, nil, ErrCustom{S: "Expected number or colon after _substr_["}
-			} else if token.Unwrap().IsErr() {
-				return false, nil, ErrInvalidCoerce{Err: token.Unwrap().Err()}
-			} else {
-				token := token.Unwrap().Unwrap()
-				start := int(token.Start)
-				switch token.Kind {
-				case Colon:
-				case Number:
-					i64, err := strconv.ParseInt(string(p.Exp[start:start+int(token.Len)]), 10, 64)
-					if err != nil {
-						return false, nil, err
-					}
-					startIndex = optionext.Some(int(i64))
-				default:
-					return false, nil, ErrCustom{S: fmt.Sprintf("Expected number after _substr_[ but got %s", string(p.Exp[start:start+int(token.Len)]))}
-				}
+			token, err := p.expectToken(Number, Colon)
+			if err != nil {
+				return false, nil, err
 			}
+			if token.Kind == Number {
+				i64, err := strconv.ParseInt(p.tokenText(token), 10, 64)
+				if err != nil {
+					return false, nil, p.errorAt(token, nil, err)
+				}
+				startIndex = optionext.Some(int(i64))
 
-			// parse colon if not already
-			if startIndex.IsSome() {
-				colon := p.Tokenizer.Next()
-				if colon.IsNone() {
-					return false, nil, ErrCustom{S: "Expected : after _substr_[n"}
-				} else if colon.Unwrap().IsErr() {
-					return false, nil, ErrInvalidCoerce{Err: colon.Unwrap().Err()}
-				} else if colon.Unwrap().Unwrap().Kind != Colon {
-					return false, nil, ErrCustom{S: "Expected : after _substr_[n"}
+				// parse colon if not already
+				if _, err := p.expectToken(Colon); err != nil {
+					return false, nil, err
 				}
 			}
 
 			// number or end bracket
 			var endIndex optionext.Option[int]
-			token = p.Tokenizer.Next()
-			if token.IsNone() {
-				return false, nil, ErrCustom{S: "Expected number or ] after _substr_["}
-			} else if token.Unwrap().IsErr() {
-				return false, nil, ErrInvalidCoerce{Err: token.Unwrap().Err()}
-			} else {
-				token := token.Unwrap().Unwrap()
-				start := int(token.Start)
-				switch token.Kind {
-				case CloseBracket:
-				case Number:
-					i64, err := strconv.ParseInt(string(p.Exp[start:start+int(token.Len)]), 10, 64)
-					if err != nil {
-						return false, nil, err
-					}
-					endIndex = optionext.Some(int(i64))
-				default:
-					return false, nil, ErrCustom{S: fmt.Sprintf("Expected number after _substr_[n: but got %s", string(p.Exp[start:start+int(token.Len)]))}
-				}
+			token, err = p.expectToken(Number, CloseBracket)
+			if err != nil {
+				return false, nil, err
 			}
+			if token.Kind == Number {
+				i64, err := strconv.ParseInt(p.tokenText(token), 10, 64)
+				if err != nil {
+					return false, nil, p.errorAt(token, nil, err)
+				}
+				endIndex = optionext.Some(int(i64))
 
-			// parse close bracket if not already
-			if endIndex.IsSome() {
-				rightBracket := p.Tokenizer.Next()
-				if rightBracket.IsNone() {
-					return false, nil, ErrCustom{S: "Expected ] after _substr_[n:n"}
-				} else if rightBracket.Unwrap().IsErr() {
-					return false, nil, ErrInvalidCoerce{Err: rightBracket.Unwrap().Err()}
-				} else if rightBracket.Unwrap().Unwrap().Kind != CloseBracket {
-					return false, nil, ErrCustom{S: "Expected ] after _substr_[n:n"}
+				// parse close bracket if not already
+				if token, err = p.expectToken(CloseBracket); err != nil {
+					return false, nil, err
 				}
 			}
 
 			switch {
 			case startIndex.IsSome() && endIndex.IsSome() && startIndex.Unwrap() > endIndex.Unwrap():
-				return false, nil, ErrCustom{S: fmt.Sprintf("Start index %d cannot be greater than end index %d", startIndex.Unwrap(), endIndex.Unwrap())}
+				return false, nil, p.errorAt(token, nil, ErrCustom{S: fmt.Sprintf("Start index %d cannot be greater than end index %d", startIndex.Unwrap(), endIndex.Unwrap())})
 			case startIndex.IsNone() && endIndex.IsNone():
-				return false, nil, ErrCustom{S: "Start and end index for substr cannot both be None"}
+				return false, nil, p.errorAt(token, nil, ErrCustom{S: "Start and end index for substr cannot both be None"})
 			}
 
 			expression = coerceSubstr{
@@ -194,7 +186,73 @@ var (
 				if err != nil {
 					return false, nil, err
 				}
-				return constEligible, coercedConstant{value: value}, nil
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
+			} else {
+				return false, expression, nil
+			}
+		},
+		"_regex_": func(p *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
+			// expect the format to be _regex_["pattern"] or _regex_["pattern", group]
+			if _, err := p.expectToken(OpenBracket); err != nil {
+				return false, nil, err
+			}
+			token, err := p.expectToken(QuotedString)
+			if err != nil {
+				return false, nil, err
+			}
+			pattern := p.tokenText(token)
+			pattern = pattern[1 : len(pattern)-1]
+			re, err := compileRegex(pattern, false)
+			if err != nil {
+				return false, nil, p.errorAt(token, nil, err)
+			}
+
+			c := coerceRegex{value: expression, pattern: pattern, re: re}
+			if re.NumSubexp() > 0 {
+				c.index = 1
+			}
+
+			token, err = p.expectToken(Comma, CloseBracket)
+			if err != nil {
+				return false, nil, err
+			}
+			if token.Kind == Comma {
+				token, err = p.expectToken(Number, QuotedString)
+				if err != nil {
+					return false, nil, err
+				}
+				if token.Kind == Number {
+					i64, err := strconv.ParseInt(p.tokenText(token), 10, 64)
+					if err != nil {
+						return false, nil, p.errorAt(token, nil, err)
+					}
+					if i64 < 0 || i64 > int64(re.NumSubexp()) {
+						return false, nil, p.errorAt(token, nil, ErrCustom{S: fmt.Sprintf("group %d does not exist in regular expression `%s`", i64, pattern)})
+					}
+					c.group = int(i64)
+					c.index = int(i64)
+				} else {
+					name := p.tokenText(token)
+					name = name[1 : len(name)-1]
+					index := re.SubexpIndex(name)
+					if index < 0 {
+						return false, nil, p.errorAt(token, nil, ErrCustom{S: fmt.Sprintf("group `%s` does not exist in regular expression `%s`", name, pattern)})
+					}
+					c.group = name
+					c.index = index
+				}
+				if _, err := p.expectToken(CloseBracket); err != nil {
+					return false, nil, err
+				}
+			}
+
+			expression = c
+			if constEligible {
+				value, err := expression.Calculate([]byte{})
+				if err != nil {
+					return false, nil, err
+				}
+				return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
 			} else {
 				return false, expression, nil
 			}
@@ -202,6 +260,60 @@ var (
 	})
 )
 
+// dateTimeCoercion returns the coercion for `_datetime_`, or when strict `_datetime_strict_`, which accepts an
+// optional layout and location eg. `_datetime_["02/01/2006", "Europe/Berlin"]`.
+func dateTimeCoercion(strict bool) coercionFunc {
+	return func(p *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
+		c := coerceDateTime{value: expression, strict: strict}
+		if p.env != nil {
+			c.location = p.env.Options.Location
+			c.dayFirst = p.env.Options.PreferDayFirst
+		}
+
+		if peeked, found, err := p.peekToken(); err == nil && found && peeked.Kind == OpenBracket {
+			_, _, _ = p.nextToken() // consume peeked bracket
+
+			token, err := p.expectToken(QuotedString)
+			if err != nil {
+				return false, nil, err
+			}
+			c.layout = p.tokenText(token)
+			c.layout = c.layout[1 : len(c.layout)-1]
+
+			token, err = p.expectToken(Comma, CloseBracket)
+			if err != nil {
+				return false, nil, err
+			}
+			if token.Kind == Comma {
+				if token, err = p.expectToken(QuotedString); err != nil {
+					return false, nil, err
+				}
+				c.zone = p.tokenText(token)
+				c.zone = c.zone[1 : len(c.zone)-1]
+				if c.location, err = time.LoadLocation(c.zone); err != nil {
+					return false, nil, p.errorAt(token, nil, ErrCustom{S: fmt.Sprintf("invalid location `%s`", c.zone)})
+				}
+				if _, err := p.expectToken(CloseBracket); err != nil {
+					return false, nil, err
+				}
+			}
+		}
+
+		expression = c
+		if constEligible {
+			value, err := expression.Calculate([]byte{})
+			if err != nil {
+				return false, nil, err
+			}
+			return constEligible, coercedConstant{value: value, expression: expression.(Coercion)}, nil
+		}
+		return false, expression, nil
+	}
+}
+
+// coercionFunc creates the Expression for a COERCE identifier, see Coercions.
+type coercionFunc = func(p *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error)
+
 // Expression Represents a stateless parsed expression that can be applied to JSON data.
 type Expression interface {
 
@@ -215,78 +327,273 @@ type Expression interface {
 }
 
 // Parse lex's' the provided expression and returns an Expression to be used/applied to data.
+//
+// The coercions and functions registered within Coercions and Functions are available to the expression,
+// see ParseWith to parse using a different set.
 func Parse(expression []byte) (Expression, error) {
-	p := Parser{
-		Exp:       expression,
-		Tokenizer: itertools.Iter[resultext.Result[Token, error]](NewTokenizer(expression)).Peekable(),
+	return parseDefault(expression, nil, ParseOptions{})
+}
+
+// ParseOptions configures how an expression is parsed.
+type ParseOptions struct {
+	// ExactNumbers represents all numbers, both within the expression and the data it is applied to, exactly
+	// instead of as float64. Integers are represented as int64, falling back to *big.Int when they don't
+	// fit, and all other numbers as *big.Rat. Arithmetic and comparisons between exact numbers are exact,
+	// including mixed with float64 values such as those returned by `_number_`.
+	ExactNumbers bool
+
+	// Location is the location of DateTimes parsed by `_datetime_` without a time zone or offset, defaulting to
+	// UTC. A location supplied to the coercion eg. `_datetime_["", "Europe/Berlin"]` takes precedence.
+	Location *time.Location
+
+	// PreferDayFirst parses ambiguous dates eg. `01/02/2022` as day first, the 1st of February, rather than
+	// month first when parsed by `_datetime_` without a layout.
+	PreferDayFirst bool
+
+	// MaxDepth is the maximum depth values may be nested within the expression eg. within parenthesis, arrays,
+	// objects, function calls or following `!` or COERCE, defaulting to DefaultMaxDepth when zero. Parsing is
+	// recursive so a limit is always applied.
+	MaxDepth int
+
+	// MaxLength is the maximum length of the expression in bytes, unlimited when zero. Expressions longer than
+	// 4GiB are always rejected as the offsets of tokens are 32-bit.
+	MaxLength int
+
+	// MaxTokens is the maximum number of tokens within the expression, unlimited when zero.
+	MaxTokens int
+}
+
+// DefaultMaxDepth is the maximum depth values may be nested within an expression when ParseOptions.MaxDepth
+// is zero.
+const DefaultMaxDepth = 1000
+
+// ParseWithOptions lex's' the provided expression using the supplied options, see Parse.
+func ParseWithOptions(expression []byte, opts ParseOptions) (Expression, error) {
+	return parseDefault(expression, nil, opts)
+}
+
+// parseDefault parses using the global Coercions and Functions, which are read locked for the duration of
+// the parse rather than per lookup.
+func parseDefault(expression []byte, params map[string]any, opts ParseOptions) (Expression, error) {
+	coercions := Coercions.RLock()
+	defer coercions.RUnlock()
+	functions := Functions.RLock()
+	defer functions.RUnlock()
+
+	p := newParser(expression)
+	p.env = &Environment{coercions: coercions.T, functions: functions.T, Options: opts}
+	p.params = params
+	return p.parse()
+}
+
+func (p *Parser) parse() (Expression, error) {
+	opts := p.env.Options
+	if opts.MaxLength > 0 && len(p.Exp) > opts.MaxLength {
+		return nil, newErrSyntax(p.Exp, opts.MaxLength, "", nil, ErrLimitExceeded{Limit: LimitExpressionLength, Max: opts.MaxLength})
+	}
+	p.maxDepth, p.maxTokens = opts.MaxDepth, opts.MaxTokens
+	if p.maxDepth <= 0 {
+		p.maxDepth = DefaultMaxDepth
 	}
 
-	result, err := p.parseExpression()
+	token, found, err := p.nextToken()
 	if err != nil {
 		return nil, err
 	}
+	if !found {
+		return nil, p.errorAtEnd(valueTokens, errors.New("no expression results found"))
+	}
 
-	if result == nil {
-		return nil, errors.New("no expression results found")
+	result, err := p.parseExpression(token, precedenceLowest)
+	if err != nil {
+		return nil, err
+	}
+
+	// anything left over could not be applied to the parsed expression
+	token, found, err = p.nextToken()
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return nil, p.errorAt(token, operationTokens, fmt.Errorf("invalid operation `%s`", p.tokenText(token)))
 	}
 	return result, nil
 }
 
+// ParseWithParams lex's' the provided expression, binding the supplied values to the named parameters
+// within it eg. `.age > $min_age`. Bound parameters are constants, so any COERCE applied to them is
+// calculated at parse time, while parameters without a value remain unbound and may be bound later using
+// Bind.
+//
+// Parameter values may be nil, bool, string, any integer or floating point number, time.Time, time.Duration,
+// map[string]any or a slice or array of these for use with operations such as IN and CONTAINS_ANY.
+func ParseWithParams(expression []byte, params map[string]any) (Expression, error) {
+	return parseDefault(expression, params, ParseOptions{})
+}
+
 // Parser parses and returns a supplied expression
 type Parser struct {
 	Exp       []byte
 	Tokenizer itertools.PeekableIterator[resultext.Result[Token, error]]
+
+	// env holds the coercions and functions available to the expression.
+	env *Environment
+
+	// params holds the values bound to named parameters at parse time, see ParseWithParams.
+	params map[string]any
+
+	// pushback holds a `!` token that was read ahead to determine the precedence of the
+	// operation it negates, but which belongs to an outer expression.
+	pushback optionext.Option[Token]
+
+	// depth is the number of values currently being parsed within one another and tokens the number of
+	// tokens consumed, limited by the ParseOptions.
+	depth, maxDepth   int
+	tokens, maxTokens int
+
+	// predicates is the number of quantifier and filter predicates currently being parsed, within which a `.`
+	// on its own is the current element.
+	predicates int
+}
+
+func newParser(expression []byte) *Parser {
+	tokenizer := NewTokenizer(expression)
+	tokenizer.root = true
+	return &Parser{
+		Exp:       expression,
+		Tokenizer: itertools.Iter[resultext.Result[Token, error]](tokenizer).Peekable(),
+	}
 }
 
-func (p *Parser) parseExpression() (current Expression, err error) {
+var (
+	// valueTokens are the tokens that can start a value.
+	valueTokens = []TokenKind{SelectorPath, QuotedString, Number, BooleanTrue, BooleanFalse, Null, Parameter, FunctionName, If, Case, Exists, Any, All, None, OpenBracket, OpenBrace, OpenParen, Not, Coerce}
+
+	// operationTokens are the tokens that can follow a value.
+	operationTokens = []TokenKind{Equals, Add, Subtract, Multiply, Divide, Gt, Gte, Lt, Lte, And, Or, Not, Contains, ContainsAny, ContainsAll, In, Between, StartsWith, EndsWith, Matches, IMatches, Like, ILike, Glob, Is, IsNot}
+)
+
+// Operator precedence, from loosest to tightest binding. All binary operators are
+// left-associative, so operators within the same tier are applied from left to right.
+//
+//  1. `||`
+//  2. `&&`
+//  3. `==` `>` `>=` `<` `<=` and their `!` negated forms eg. `!=`, postfix `IS [NOT] NULL` and `IS [NOT] MISSING`
+//  4. `CONTAINS` `CONTAINS_ANY` `CONTAINS_ALL` `IN` `STARTSWITH` `ENDSWITH` `MATCHES` `IMATCHES`
+//     `LIKE` `ILIKE` `GLOB` `BETWEEN`
+//  5. `+` `-`
+//  6. `*` `/`
+//  7. prefix `!` and `COERCE`, which only apply to the single value that follows them
+const (
+	precedenceNone uint8 = iota
+	precedenceOr
+	precedenceAnd
+	precedenceComparison
+	precedenceStringArray
+	precedenceAdditive
+	precedenceMultiplicative
+
+	precedenceLowest = precedenceOr
+)
+
+// binaryPrecedence returns the precedence of a binary operation or precedenceNone if the token
+// does not represent one.
+func binaryPrecedence(kind TokenKind) uint8 {
+	switch kind {
+	case Or:
+		return precedenceOr
+	case And:
+		return precedenceAnd
+	case Equals, Gt, Gte, Lt, Lte, Is, IsNot:
+		return precedenceComparison
+	case Contains, ContainsAny, ContainsAll, In, StartsWith, EndsWith, Matches, IMatches, Like, ILike, Glob, Between:
+		return precedenceStringArray
+	case Add, Subtract:
+		return precedenceAdditive
+	case Multiply, Divide:
+		return precedenceMultiplicative
+	default:
+		return precedenceNone
+	}
+}
+
+// parseExpression parses the value starting at the supplied token followed by all operations
+// that bind at least as tightly as `minPrecedence`.
+func (p *Parser) parseExpression(token Token, minPrecedence uint8) (current Expression, err error) {
+	current, err = p.parseValue(token)
+	if err != nil {
+		return nil, err
+	}
 
 	for {
-		next := p.Tokenizer.Next()
-		if next.IsNone() {
-			return current, nil
+		token, found, err := p.peekToken()
+		if err != nil {
+			return nil, err
 		}
-		result := next.Unwrap()
-		if result.IsErr() {
-			return nil, result.Err()
+		if !found {
+			return current, nil
 		}
-		token := result.Unwrap()
 
-		if current == nil {
-			// look for nextToken value
-			current, err = p.parseValue(token)
+		operation := token
+		negated := token.Kind == Not
+		if negated {
+			_, _, _ = p.nextToken() // consume peeked `!`
+
+			operation, found, err = p.peekToken()
 			if err != nil {
 				return nil, err
 			}
+			if !found {
+				return nil, p.errorAtEnd(operationTokens, errors.New("no operation found after: !"))
+			}
+		}
 
-		} else {
-			if token.Kind == CloseParen {
-				return current, nil
+		precedence := binaryPrecedence(operation.Kind)
+		if precedence == precedenceNone {
+			if negated {
+				return nil, p.errorAt(operation, operationTokens, fmt.Errorf("invalid operation after '!' `%s`", p.tokenText(operation)))
 			}
-			// look for nextToken operation
-			current, err = p.parseOperation(token, current)
-			if err != nil {
-				return nil, err
+			// not an operation, let the caller decide if it's a valid terminator eg. `)` or `]`
+			return current, nil
+		}
+		if precedence < minPrecedence {
+			if negated {
+				p.pushback = optionext.Some(token)
 			}
+			return current, nil
+		}
+		_, _, _ = p.nextToken() // consume peeked operation
+
+		current, err = p.parseOperation(operation, current, precedence)
+		if err != nil {
+			return nil, err
+		}
+		if negated {
+			current = not{value: current}
 		}
 	}
 }
 
 func (p *Parser) parseValue(token Token) (Expression, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > p.maxDepth {
+		return nil, p.errorAt(token, nil, ErrLimitExceeded{Limit: LimitDepth, Max: p.maxDepth})
+	}
+
 	switch token.Kind {
 	case OpenBracket:
 		arr := make([]Expression, 0, 2)
 
 	FOR:
 		for {
-			next := p.Tokenizer.Next()
-			if next.IsNone() {
-				return nil, errors.New("unclosed Array '['")
+			token, found, err := p.nextToken()
+			if err != nil {
+				return nil, err
 			}
-			result := next.Unwrap()
-			if result.IsErr() {
-				return nil, result.Err()
+			if !found {
+				return nil, p.errorAtEnd([]TokenKind{CloseBracket}, errors.New("unclosed Array '['"))
 			}
-			token := result.Unwrap()
 
 			switch token.Kind {
 			case CloseBracket:
@@ -294,33 +601,49 @@ func (p *Parser) parseValue(token Token) (Expression, error) {
 			case Comma:
 				continue
 			default:
-				value, err := p.parseValue(token)
+				value, err := p.parseExpression(token, precedenceLowest)
 				if err != nil {
 					return nil, err
 				}
 				arr = append(arr, value)
 			}
-			if token.Kind == CloseBracket {
-				break
-			}
 		}
 
 		return array{vec: arr}, nil
 
+	case OpenBrace:
+		return p.parseObject()
+
 	case OpenParen:
-		expression, err := p.parseExpression()
+		nextToken, err := p.nextOperatorToken(token)
+		if err != nil {
+			return nil, err
+		}
+		expression, err := p.parseExpression(nextToken, precedenceLowest)
+		if err != nil {
+			return nil, err
+		}
+
+		closeParen, found, err := p.nextToken()
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil, errors.New("expression after open parenthesis '(' ends unexpectedly")
-			}
 			return nil, err
 		}
+		if !found {
+			return nil, p.errorAtEnd([]TokenKind{CloseParen}, errors.New("expression after open parenthesis '(' ends unexpectedly"))
+		}
+		if closeParen.Kind != CloseParen {
+			return nil, p.errorAt(closeParen, append([]TokenKind{CloseParen}, operationTokens...), fmt.Errorf("invalid operation `%s`", p.tokenText(closeParen)))
+		}
 		return expression, nil
 
 	case SelectorPath:
-		start := int(token.Start)
+		path, err := p.selectorText(token)
+		if err != nil {
+			return nil, err
+		}
 		return selectorPath{
-			s: string(p.Exp[start+1 : start+int(token.Len)]),
+			s:     path,
+			exact: p.env.Options.ExactNumbers,
 		}, nil
 
 	case QuotedString:
@@ -330,15 +653,58 @@ func (p *Parser) parseValue(token Token) (Expression, error) {
 		}, nil
 
 	case Number:
-		start := int(token.Start)
-		f64, err := strconv.ParseFloat(string(p.Exp[start:start+int(token.Len)]), 64)
+		if p.env.Options.ExactNumbers {
+			n, ok := parseExactNumber(p.tokenText(token))
+			if !ok {
+				return nil, p.errorAt(token, nil, ErrInvalidNumber{s: p.tokenText(token)})
+			}
+			return exactNum{n: n}, nil
+		}
+		f64, err := strconv.ParseFloat(p.tokenText(token), 64)
 		if err != nil {
-			return nil, err
+			return nil, p.errorAt(token, nil, ErrInvalidNumber{s: p.tokenText(token)})
 		}
 		return num{
 			n: f64,
 		}, nil
 
+	case Parameter:
+		return p.parseParameter(token)
+
+	case FunctionName:
+		return p.parseCall(token)
+
+	case If:
+		return p.parseIf(token)
+
+	case Case:
+		return p.parseCase(token)
+
+	case Any, All, None:
+		return p.parseQuantifier(token)
+
+	case Exists:
+		// EXISTS <selector path>, which may be within parenthesis eg. `EXISTS(.a)`
+		var parenthesised bool
+		if peeked, found, err := p.peekToken(); err == nil && found && peeked.Kind == OpenParen {
+			_, _, _ = p.nextToken() // consume peeked parenthesis
+			parenthesised = true
+		}
+		path, err := p.expectToken(SelectorPath)
+		if err != nil {
+			return nil, err
+		}
+		if parenthesised {
+			if _, err = p.expectToken(CloseParen); err != nil {
+				return nil, err
+			}
+		}
+		s, err := p.selectorText(path)
+		if err != nil {
+			return nil, err
+		}
+		return exists{path: s}, nil
+
 	case BooleanTrue:
 		return boolean{b: true}, nil
 
@@ -354,50 +720,52 @@ func (p *Parser) parseValue(token Token) (Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		var constEligible bool
-		switch nextToken.Kind {
-		case QuotedString, Number, BooleanTrue, BooleanFalse, Null:
-			constEligible = true
-		}
-
 		expression, err := p.parseValue(nextToken)
 		if err != nil {
 			return nil, err
 		}
+		// literals, bound parameters and function calls calculated at parse time are all constant
+		_, constEligible := expression.(Literal)
 
 		for {
-			next := p.Tokenizer.Next()
-			if next.IsNone() {
-				return nil, errors.New("no identifier after value for: COERCE")
+			identifierToken, found, err := p.nextToken()
+			if err != nil {
+				return nil, err
 			}
-			result := next.Unwrap()
-			if result.IsErr() {
-				return nil, result.Err()
+			if !found {
+				return nil, p.errorAtEnd([]TokenKind{Identifier}, errors.New("no identifier after value for: COERCE"))
 			}
-			identifierToken := result.Unwrap()
-			start := int(identifierToken.Start)
-			identifier := string(p.Exp[start : start+int(identifierToken.Len)])
+			identifier := p.tokenText(identifierToken)
 
 			if identifierToken.Kind != Identifier {
-				return nil, fmt.Errorf("COERCE missing data type identifier, found instead: %s", identifier)
+				return nil, p.errorAt(identifierToken, []TokenKind{Identifier}, fmt.Errorf("COERCE missing data type identifier, found instead `%s`", identifier))
 			}
 
-			guard := Coercions.RLock()
-			fn, found := guard.T[identifier]
-			guard.RUnlock()
-
-			if found {
-				constEligible, expression, err = fn(p, constEligible, expression)
+			if fn, found := p.env.coercions[identifier]; found {
+				value := expression
+				constEligible, expression, err = fn(p, constEligible, value)
 				if err != nil {
-					return nil, err
+					if _, ok := err.(ErrSyntax); ok {
+						return nil, err
+					}
+					return nil, p.errorAt(identifierToken, nil, err)
+				}
+				if _, ok := expression.(Node); !ok {
+					// keep custom coercions within the AST, along with the arguments they read to be formatted
+					expression = coerceCustom{
+						name:   identifier,
+						args:   p.textSince(identifierToken.Start + identifierToken.Len),
+						value:  value,
+						result: expression,
+					}
 				}
 			} else {
-				return nil, fmt.Errorf("invalid COERCE data type '%s'", identifier)
+				return nil, p.errorAt(identifierToken, nil, fmt.Errorf("invalid COERCE data type `%s`", identifier))
 			}
 
-			nextPeeked := p.Tokenizer.Peek()
-			if nextPeeked.IsSome() && nextPeeked.Unwrap().IsOk() && nextPeeked.Unwrap().Unwrap().Kind == Comma {
-				_ = p.Tokenizer.Next() // consume peeked comma
+			nextPeeked, found, err := p.peekToken()
+			if err == nil && found && nextPeeked.Kind == Comma {
+				_, _, _ = p.nextToken() // consume peeked comma
 				continue
 			}
 			break
@@ -416,254 +784,291 @@ func (p *Parser) parseValue(token Token) (Expression, error) {
 		return not{value: value}, nil
 
 	default:
-		return nil, fmt.Errorf("token is not a valid value: %v", token)
+		return nil, p.errorAt(token, valueTokens, fmt.Errorf("token is not a valid value `%s`", p.tokenText(token)))
 	}
 }
 
-func (p *Parser) parseOperation(token Token, current Expression) (Expression, error) {
-	switch token.Kind {
-	case Add:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
-		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
-		}
-		return add{
-			left:  current,
-			right: right,
-		}, nil
+// parseIf parses `IF <condition> THEN <value> ELSE <value>`. The ELSE value extends as far as possible, so
+// an IF must be within parenthesis to be followed by an operation eg. `(IF .a THEN 1 ELSE 2) + 1`.
+func (p *Parser) parseIf(token Token) (Expression, error) {
+	condition, err := p.parseBranch(token)
+	if err != nil {
+		return nil, err
+	}
+	thenToken, err := p.expectToken(Then)
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.parseBranch(thenToken)
+	if err != nil {
+		return nil, err
+	}
+	elseToken, err := p.expectToken(Else)
+	if err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseBranch(elseToken)
+	if err != nil {
+		return nil, err
+	}
+	return conditional{kind: NodeIf, whens: []Expression{condition, value}, otherwise: otherwise}, nil
+}
 
-	case Subtract:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
-		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
-		}
-		return sub{
-			left:  current,
-			right: right,
-		}, nil
+// parseCase parses `CASE WHEN <condition> THEN <value> ... [ELSE <value>] END` with one or more WHEN branches.
+func (p *Parser) parseCase(token Token) (Expression, error) {
+	c := conditional{kind: NodeCase}
 
-	case Multiply:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
-		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
-		}
-		return multi{
-			left:  current,
-			right: right,
-		}, nil
+	token, err := p.expectToken(When)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch token.Kind {
+		case When:
+			condition, err := p.parseBranch(token)
+			if err != nil {
+				return nil, err
+			}
+			thenToken, err := p.expectToken(Then)
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.parseBranch(thenToken)
+			if err != nil {
+				return nil, err
+			}
+			c.whens = append(c.whens, condition, value)
 
-	case Divide:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
-		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
-		}
-		return div{
-			left:  current,
-			right: right,
-		}, nil
+			if token, err = p.expectToken(When, Else, End); err != nil {
+				return nil, err
+			}
 
-	case Equals:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
-		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
-		}
-		return eq{
-			left:  current,
-			right: right,
-		}, nil
+		case Else:
+			if c.otherwise, err = p.parseBranch(token); err != nil {
+				return nil, err
+			}
+			if _, err = p.expectToken(End); err != nil {
+				return nil, err
+			}
+			return c, nil
 
-	case Gt:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
-		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
+		default:
+			return c, nil
 		}
-		return gt{
-			left:  current,
-			right: right,
-		}, nil
+	}
+}
 
-	case Gte:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
+// parseBranch parses the expression following an IF, THEN, ELSE or WHEN keyword.
+func (p *Parser) parseBranch(keyword Token) (Expression, error) {
+	token, err := p.nextOperatorToken(keyword)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseExpression(token, precedenceLowest)
+}
+
+// parseQuantifier parses `ANY|ALL|NONE <array> (<predicate>)` where the predicate is applied to each element
+// of the array, with the element as the root of its selector paths so `.` or `.@this` is the element itself.
+func (p *Parser) parseQuantifier(token Token) (Expression, error) {
+	arrayToken, err := p.nextOperatorToken(token)
+	if err != nil {
+		return nil, err
+	}
+	array, err := p.parseValue(arrayToken)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.expectToken(OpenParen); err != nil {
+		return nil, err
+	}
+	predicateToken, err := p.nextOperatorToken(token)
+	if err != nil {
+		return nil, err
+	}
+	p.predicates++
+	predicate, err := p.parseExpression(predicateToken, precedenceLowest)
+	p.predicates--
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.expectToken(CloseParen); err != nil {
+		return nil, err
+	}
+
+	q := quantifier{array: array, predicate: predicate, kind: NodeAny}
+	switch token.Kind {
+	case All:
+		q.kind = NodeAll
+	case None:
+		q.kind = NodeNone
+	}
+	return q, nil
+}
+
+// parseParameter returns the named parameter, bound to its value if one was supplied at parse time.
+func (p *Parser) parseParameter(token Token) (Expression, error) {
+	name := p.tokenText(token)[1:]
+	value, found := p.params[name]
+	if !found {
+		return parameter{name: name, exact: p.env.Options.ExactNumbers}, nil
+	}
+	e, err := bindParameter(name, value, p.env.Options.ExactNumbers)
+	if err != nil {
+		return nil, p.errorAt(token, nil, err)
+	}
+	return e, nil
+}
+
+// parseObject parses the keys and values of an object literal eg. `{"id": .id, "total": .price * .qty}`.
+func (p *Parser) parseObject() (Expression, error) {
+	obj := object{}
+	seen := make(map[string]struct{})
+
+	keyToken, err := p.expectToken(QuotedString, CloseBrace)
+	if err != nil {
+		return nil, err
+	}
+	for keyToken.Kind != CloseBrace {
+		start := int(keyToken.Start)
+		key := string(p.Exp[start+1 : start+int(keyToken.Len)-1])
+		if _, found := seen[key]; found {
+			return nil, p.errorAt(keyToken, nil, fmt.Errorf("duplicate object key `%s`", key))
 		}
-		right, err := p.parseValue(nextToken)
+		seen[key] = struct{}{}
+
+		colon, err := p.expectToken(Colon)
 		if err != nil {
 			return nil, err
 		}
-		return gte{
-			left:  current,
-			right: right,
-		}, nil
-
-	case Lt:
-		nextToken, err := p.nextOperatorToken(token)
+		valueToken, err := p.nextOperatorToken(colon)
 		if err != nil {
 			return nil, err
 		}
-		right, err := p.parseValue(nextToken)
+		value, err := p.parseExpression(valueToken, precedenceLowest)
 		if err != nil {
 			return nil, err
 		}
-		return lt{
-			left:  current,
-			right: right,
-		}, nil
+		obj.keys = append(obj.keys, key)
+		obj.values = append(obj.values, value)
 
-	case Lte:
-		nextToken, err := p.nextOperatorToken(token)
+		separator, err := p.expectToken(Comma, CloseBrace)
 		if err != nil {
 			return nil, err
 		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
+		if separator.Kind == CloseBrace {
+			break
 		}
-		return lte{
-			left:  current,
-			right: right,
-		}, nil
-
-	case Or:
-		right, err := p.parseExpression()
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil, errors.New("expression after or '||' ends unexpectedly")
-			}
+		if keyToken, err = p.expectToken(QuotedString); err != nil {
 			return nil, err
 		}
-		return or{
-			left:  current,
-			right: right,
-		}, nil
+	}
+	return obj, nil
+}
 
-	case And:
-		right, err := p.parseExpression()
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil, errors.New("expression after or '&&' ends unexpectedly")
-			}
-			return nil, err
-		}
-		return and{
-			left:  current,
-			right: right,
-		}, nil
+// parseCall parses the arguments of a function call eg. `len(.name)`, calculating the call at parse time
+// if the function is pure and all arguments are constant.
+func (p *Parser) parseCall(token Token) (Expression, error) {
+	name := strings.ToLower(p.tokenText(token))
 
-	case StartsWith:
-		nextToken, err := p.nextOperatorToken(token)
+	fn, found := p.env.functions[name]
+	if !found && name != filterFunction {
+		return nil, p.errorAt(token, nil, fmt.Errorf("unknown function `%s`", p.tokenText(token)))
+	}
+	if _, err := p.expectToken(OpenParen); err != nil {
+		return nil, err
+	}
+
+	// filter is built in, unless replaced.
+	filter := !found
+
+	var args []Expression
+	for {
+		argToken, found, err := p.nextToken()
 		if err != nil {
 			return nil, err
 		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
+		if !found {
+			return nil, p.errorAtEnd([]TokenKind{CloseParen}, fmt.Errorf("unclosed function call `%s(`", name))
 		}
-		return startsWith{
-			left:  current,
-			right: right,
-		}, nil
-
-	case EndsWith:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
+		if argToken.Kind == CloseParen && len(args) == 0 {
+			break
 		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
+		// the second argument of filter is its predicate.
+		predicate := filter && len(args) == 1
+		if predicate {
+			p.predicates++
 		}
-		return endsWith{
-			left:  current,
-			right: right,
-		}, nil
-
-	case In:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
+		arg, err := p.parseExpression(argToken, precedenceLowest)
+		if predicate {
+			p.predicates--
 		}
-		right, err := p.parseValue(nextToken)
 		if err != nil {
 			return nil, err
 		}
-		return in{
-			left:  current,
-			right: right,
-		}, nil
+		args = append(args, arg)
 
-	case Contains:
-		nextToken, err := p.nextOperatorToken(token)
+		separator, err := p.expectToken(Comma, CloseParen)
 		if err != nil {
 			return nil, err
 		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
+		if separator.Kind == CloseParen {
+			break
 		}
-		return contains{
-			left:  current,
-			right: right,
-		}, nil
+	}
 
-	case ContainsAny:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
+	if filter {
+		// filter's predicate can't be calculated before the call.
+		if err := (Function{MinArgs: 2, MaxArgs: 2}).checkArity(name, len(args)); err != nil {
+			return nil, p.errorAt(token, nil, err)
 		}
-		right, err := p.parseValue(nextToken)
-		if err != nil {
-			return nil, err
-		}
-		return containsAny{
-			left:  current,
-			right: right,
-		}, nil
+		return filterCall{array: args[0], predicate: args[1]}, nil
+	}
 
-	case ContainsAll:
-		nextToken, err := p.nextOperatorToken(token)
-		if err != nil {
-			return nil, err
+	if err := fn.checkArity(name, len(args)); err != nil {
+		return nil, p.errorAt(token, nil, err)
+	}
+
+	c := call{name: name, fn: fn, args: args}
+	folded, err := foldCall(c)
+	if err != nil {
+		return nil, p.errorAt(token, nil, err)
+	}
+	return folded, nil
+}
+
+// parseOperation parses the right hand side of the supplied binary operation, which binds at
+// the supplied precedence, and applies it to the current expression.
+func (p *Parser) parseOperation(token Token, current Expression, precedence uint8) (Expression, error) {
+	if token.Kind == Is || token.Kind == IsNot {
+		// <value> IS [NOT] NULL|MISSING has no right hand side value
+		if _, found, err := p.peekToken(); err == nil && !found && token.Kind == Is {
+			return nil, p.errorAtEnd(nil, errors.New("expression ends unexpectedly, expected NULL, MISSING or NOT"))
 		}
-		right, err := p.parseValue(nextToken)
+		operand, err := p.expectToken(Null, Missing)
 		if err != nil {
 			return nil, err
 		}
-		return containsAll{
-			left:  current,
-			right: right,
-		}, nil
+		check := isCheck{value: current}
+		switch {
+		case operand.Kind == Null && token.Kind == Is:
+			check.kind = NodeIsNull
+		case operand.Kind == Null:
+			check.kind = NodeIsNotNull
+		case token.Kind == Is:
+			check.kind = NodeIsMissing
+		default:
+			check.kind = NodeIsNotMissing
+		}
+		return check, nil
+	}
 
-	case Between:
+	if token.Kind == Between {
+		// <value> BETWEEN <lower> <upper>, each bound may only contain arithmetic operations
 		lhsToken, err := p.nextOperatorToken(token)
 		if err != nil {
 			return nil, err
 		}
-		left, err := p.parseValue(lhsToken)
+		left, err := p.parseExpression(lhsToken, precedenceAdditive)
 		if err != nil {
 			return nil, err
 		}
@@ -672,7 +1077,7 @@ func (p *Parser) parseOperation(token Token, current Expression) (Expression, er
 		if err != nil {
 			return nil, err
 		}
-		right, err := p.parseValue(rhsToken)
+		right, err := p.parseExpression(rhsToken, precedenceAdditive)
 		if err != nil {
 			return nil, err
 		}
@@ -682,41 +1087,209 @@ func (p *Parser) parseOperation(token Token, current Expression) (Expression, er
 			right: right,
 			value: current,
 		}, nil
+	}
 
-	case Not:
-		nextToken, err := p.nextOperatorToken(token)
+	nextToken, err := p.nextOperatorToken(token)
+	if err != nil {
+		return nil, err
+	}
+	// binding one tier tighter makes operations within the same tier left-associative
+	right, err := p.parseExpression(nextToken, precedence+1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch token.Kind {
+	case Add:
+		return add{left: current, right: right}, nil
+	case Subtract:
+		return sub{left: current, right: right}, nil
+	case Multiply:
+		return multi{left: current, right: right}, nil
+	case Divide:
+		return div{left: current, right: right}, nil
+	case Equals:
+		return eq{left: current, right: right}, nil
+	case Gt:
+		return gt{left: current, right: right}, nil
+	case Gte:
+		return gte{left: current, right: right}, nil
+	case Lt:
+		return lt{left: current, right: right}, nil
+	case Lte:
+		return lte{left: current, right: right}, nil
+	case Or:
+		return or{left: current, right: right}, nil
+	case And:
+		return and{left: current, right: right}, nil
+	case StartsWith:
+		return startsWith{left: current, right: right}, nil
+	case EndsWith:
+		return endsWith{left: current, right: right}, nil
+	case Matches, IMatches:
+		m, err := newMatches(current, right, token.Kind == IMatches)
 		if err != nil {
-			return nil, err
+			return nil, p.errorAt(nextToken, nil, err)
+		}
+		return m, nil
+	case Like, ILike, Glob:
+		kind := NodeLike
+		switch token.Kind {
+		case ILike:
+			kind = NodeILike
+		case Glob:
+			kind = NodeGlob
+		}
+		escape := '\\'
+		if kind != NodeGlob {
+			if escape, err = p.parseEscape(); err != nil {
+				return nil, err
+			}
 		}
-		value, err := p.parseOperation(nextToken, current)
+		l, err := newLike(current, right, kind, escape)
 		if err != nil {
-			return nil, err
+			return nil, p.errorAt(nextToken, nil, err)
 		}
-		return not{
-			value: value,
-		}, nil
-
-	case CloseBracket:
-		return current, nil
-
+		return l, nil
+	case In:
+		return in{left: current, right: right}, nil
+	case Contains:
+		return contains{left: current, right: right}, nil
+	case ContainsAny:
+		return containsAny{left: current, right: right}, nil
+	case ContainsAll:
+		return containsAll{left: current, right: right}, nil
 	default:
-		return nil, fmt.Errorf("invalid operation: %v", token)
+		return nil, p.errorAt(token, operationTokens, fmt.Errorf("invalid operation `%s`", p.tokenText(token)))
+	}
+}
+
+// parseEscape parses the optional `ESCAPE "<character>"` following the pattern of a LIKE or ILIKE, returning the
+// character escaping the pattern which is `\` when there is none.
+func (p *Parser) parseEscape() (rune, error) {
+	peeked, found, err := p.peekToken()
+	if err != nil || !found || peeked.Kind != Escape {
+		return '\\', nil
 	}
+	_, _, _ = p.nextToken() // consume peeked ESCAPE
+	token, err := p.expectToken(QuotedString)
+	if err != nil {
+		return 0, err
+	}
+	start := int(token.Start)
+	escape := string(p.Exp[start+1 : start+int(token.Len)-1])
+	if utf8.RuneCountInString(escape) != 1 {
+		return 0, p.errorAt(token, nil, fmt.Errorf("ESCAPE must be a single character, found `%s`", escape))
+	}
+	r, _ := utf8.DecodeRuneInString(escape)
+	return r, nil
 }
 
 func (p *Parser) nextOperatorToken(operationToken Token) (token Token, err error) {
+	token, found, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	if !found {
+		err = p.errorAtEnd(valueTokens, fmt.Errorf("no value found after operation: %s", p.tokenText(operationToken)))
+	}
+	return
+}
+
+// expectToken consumes the next token, returning an ErrSyntax if it is not one of the expected kinds.
+func (p *Parser) expectToken(expected ...TokenKind) (token Token, err error) {
+	token, found, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	if !found {
+		return token, p.errorAtEnd(expected, errors.New("expression ends unexpectedly"))
+	}
+	for _, kind := range expected {
+		if token.Kind == kind {
+			return token, nil
+		}
+	}
+	return token, p.errorAt(token, expected, fmt.Errorf("unexpected token `%s`", p.tokenText(token)))
+}
+
+// errorAt returns an ErrSyntax describing an error with the supplied token.
+func (p *Parser) errorAt(token Token, expected []TokenKind, err error) error {
+	return newErrSyntax(p.Exp, int(token.Start), p.tokenText(token), expected, err)
+}
+
+// errorAtEnd returns an ErrSyntax describing an expression that ended unexpectedly.
+func (p *Parser) errorAtEnd(expected []TokenKind, err error) error {
+	return newErrSyntax(p.Exp, len(p.Exp), "", expected, err)
+}
+
+// nextToken consumes and returns the next token, found is false once all tokens have been consumed.
+func (p *Parser) nextToken() (token Token, found bool, err error) {
+	if p.pushback.IsSome() {
+		token = p.pushback.Unwrap()
+		p.pushback = optionext.None[Token]()
+		return token, true, nil
+	}
 	next := p.Tokenizer.Next()
 	if next.IsNone() {
-		start := int(operationToken.Start)
-		err = fmt.Errorf("no value found after operation: %s", string(p.Exp[start:start+int(operationToken.Len)]))
 		return
 	}
 	result := next.Unwrap()
 	if result.IsErr() {
-		err = result.Err()
+		return token, false, result.Err()
+	}
+	token = result.Unwrap()
+	if p.tokens++; p.maxTokens > 0 && p.tokens > p.maxTokens {
+		return token, false, p.errorAt(token, nil, ErrLimitExceeded{Limit: LimitTokens, Max: p.maxTokens})
+	}
+	return token, true, nil
+}
+
+// peekToken returns the next token without consuming it, found is false once all tokens have been consumed.
+func (p *Parser) peekToken() (token Token, found bool, err error) {
+	if p.pushback.IsSome() {
+		return p.pushback.Unwrap(), true, nil
+	}
+	next := p.Tokenizer.Peek()
+	if next.IsNone() {
 		return
 	}
-	return result.Unwrap(), nil
+	result := next.Unwrap()
+	if result.IsErr() {
+		return token, false, result.Err()
+	}
+	return result.Unwrap(), true, nil
+}
+
+// textSince returns the raw text of the expression from the offset up to the next token, or to the end of the
+// expression, without surrounding whitespace.
+func (p *Parser) textSince(offset uint32) string {
+	end := len(p.Exp)
+	if token, found, err := p.peekToken(); err == nil && found {
+		end = int(token.Start)
+	}
+	if int(offset) >= end {
+		return ""
+	}
+	return strings.TrimSpace(string(p.Exp[offset:end]))
+}
+
+// selectorText returns the gjson path of a selector path token, `@this` for a `.` on its own which is only valid
+// within the predicates of quantifiers and filter.
+func (p *Parser) selectorText(token Token) (string, error) {
+	if token.Len == 1 {
+		if p.predicates == 0 {
+			return "", p.errorAt(token, []TokenKind{SelectorPath}, ErrInvalidSelectorPath{s: "."})
+		}
+		return "@this", nil
+	}
+	return p.tokenText(token)[1:], nil
+}
+
+// tokenText returns the raw text of the supplied token within the expression.
+func (p *Parser) tokenText(token Token) string {
+	start := int(token.Start)
+	return string(p.Exp[start : start+int(token.Len)])
 }
 
 var _ Expression = (*between)(nil)
@@ -746,6 +1319,15 @@ func (b between) Calculate(src []byte) (any, error) {
 		return false, nil
 	}
 
+	if isExactNumber(value) || isExactNumber(left) || isExactNumber(right) {
+		v, vok := toRat(value)
+		l, lok := toRat(left)
+		r, rok := toRat(right)
+		if vok && lok && rok {
+			return v.Cmp(l) > 0 && v.Cmp(r) < 0, nil
+		}
+	}
+
 	leftType := reflect.TypeOf(left)
 	if !(leftType == reflect.TypeOf(right) && reflect.TypeOf(value) == leftType) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s < %s", left, right)}
@@ -756,6 +1338,8 @@ func (b between) Calculate(src []byte) (any, error) {
 		return v > left.(string) && v < right.(string), nil
 	case float64:
 		return v > left.(float64) && v < right.(float64), nil
+	case time.Duration:
+		return v > left.(time.Duration) && v < right.(time.Duration), nil
 	case time.Time:
 		return v.After(left.(time.Time)) && v.Before(right.(time.Time)), nil
 	default:
@@ -796,11 +1380,108 @@ func (c coerceNumber) Calculate(src []byte) (any, error) {
 	case time.Time:
 		return float64(v.UnixNano()), nil
 
+	case int64, *big.Int, *big.Rat:
+		return toFloat(v), nil
+
 	default:
 		return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to a number", value)}
 	}
 }
 
+var _ Expression = (*coerceInt)(nil)
+
+type coerceInt struct {
+	value Expression
+}
+
+func (c coerceInt) Calculate(src []byte) (any, error) {
+	value, err := c.value.Calculate(src)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+
+	case string:
+		n, ok := parseExactNumber(v)
+		if !ok {
+			return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to an int", value)}
+		}
+		return truncateExact(n), nil
+
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to an int", value)}
+		}
+		i, _ := new(big.Float).SetFloat64(v).Int(nil)
+		return normalizeInt(i), nil
+
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+
+	case time.Time:
+		return v.UnixNano(), nil
+
+	case int64, *big.Int, *big.Rat:
+		return truncateExact(v), nil
+
+	default:
+		return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to an int", value)}
+	}
+}
+
+var _ Expression = (*coerceDecimal)(nil)
+
+type coerceDecimal struct {
+	value Expression
+}
+
+func (c coerceDecimal) Calculate(src []byte) (any, error) {
+	value, err := c.value.Calculate(src)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+
+	case string:
+		n, ok := parseExactNumber(v)
+		if !ok {
+			return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to a decimal", value)}
+		}
+		return n, nil
+
+	case float64:
+		r, ok := toRat(v)
+		if !ok {
+			return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to a decimal", value)}
+		}
+		return normalizeRat(r), nil
+
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+
+	case time.Time:
+		return v.UnixNano(), nil
+
+	case int64, *big.Int, *big.Rat:
+		return v, nil
+
+	default:
+		return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to a decimal", value)}
+	}
+}
+
 var _ Expression = (*coerceString)(nil)
 
 type coerceString struct {
@@ -824,6 +1505,8 @@ func (c coerceString) Calculate(src []byte) (any, error) {
 		return strconv.FormatBool(v), nil
 	case time.Time:
 		return v.Format(time.RFC3339Nano), nil
+	case int64, *big.Int, *big.Rat:
+		return formatExactNumber(v), nil
 	default:
 		return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to a string", value)}
 	}
@@ -895,8 +1578,15 @@ func (c coerceTitle) Calculate(src []byte) (any, error) {
 
 var _ Expression = (*coerceDateTime)(nil)
 
+// coerceDateTime is `_datetime_` or `_datetime_strict_`, parsing using the layout if supplied otherwise
+// detecting the format.
 type coerceDateTime struct {
-	value Expression
+	value    Expression
+	layout   string
+	zone     string
+	location *time.Location
+	dayFirst bool
+	strict   bool
 }
 
 func (c coerceDateTime) Calculate(src []byte) (any, error) {
@@ -907,8 +1597,11 @@ func (c coerceDateTime) Calculate(src []byte) (any, error) {
 
 	switch v := value.(type) {
 	case string:
-		t, err := dateparse.ParseAny(v)
+		t, err := c.parse(v)
 		if err != nil {
+			if c.strict {
+				return nil, ErrInvalidDateTime{Value: v, Layout: c.layout, Err: err}
+			}
 			// don't return error at runtime but null same as not found
 			// which will fail equality checks and alike which is the desired behaviour.
 			return nil, nil
@@ -919,16 +1612,81 @@ func (c coerceDateTime) Calculate(src []byte) (any, error) {
 	}
 }
 
+func (c coerceDateTime) parse(s string) (time.Time, error) {
+	if c.layout != "" {
+		location := c.location
+		if location == nil {
+			location = time.UTC
+		}
+		return time.ParseInLocation(c.layout, s, location)
+	}
+	if c.dayFirst {
+		return dateparse.ParseIn(s, c.location, dateparse.PreferMonthFirst(false))
+	}
+	return dateparse.ParseIn(s, c.location)
+}
+
+var _ Expression = (*coerceDuration)(nil)
+
+type coerceDuration struct {
+	value Expression
+}
+
+func (c coerceDuration) Calculate(src []byte) (any, error) {
+	value, err := c.value.Calculate(src)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		d, err := parseDuration(v)
+		if err != nil {
+			return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to a Duration", value)}
+		}
+		return d, nil
+	case time.Duration:
+		return v, nil
+	case float64, int64, *big.Int, *big.Rat:
+		// numbers are a number of seconds
+		return time.Duration(math.Round(toFloat(v) * float64(time.Second))), nil
+	default:
+		return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v to a Duration", value)}
+	}
+}
+
 var _ Expression = (*coercedConstant)(nil)
 
 type coercedConstant struct {
-	value any
+	value      any
+	expression Coercion
 }
 
 func (c coercedConstant) Calculate(_ []byte) (any, error) {
 	return c.value, nil
 }
 
+var _ Expression = (*coerceCustom)(nil)
+
+// coerceCustom wraps the Expression returned by a registered coercion that is not implemented by this package.
+// That Expression can't be rebuilt with another value so the coercion is a leaf, its value kept only to be
+// formatted, checked and for SelectorPaths.
+type coerceCustom struct {
+	name string
+
+	// args is the text of the arguments the coercion read following its identifier eg. `[2]`.
+	args string
+
+	value  Expression
+	result Expression
+}
+
+func (c coerceCustom) Calculate(src []byte) (any, error) {
+	return c.result.Calculate(src)
+}
+
 var _ Expression = (*null)(nil)
 
 type null struct {
@@ -938,44 +1696,192 @@ func (bn null) Calculate(_ []byte) (any, error) {
 	return nil, nil
 }
 
-var _ Expression = (*boolean)(nil)
+var _ Expression = (*boolean)(nil)
+
+type boolean struct {
+	b bool
+}
+
+func (b boolean) Calculate(_ []byte) (any, error) {
+	return b.b, nil
+}
+
+var _ Expression = (*num)(nil)
+
+type num struct {
+	n float64
+}
+
+func (n num) Calculate(_ []byte) (any, error) {
+	return n.n, nil
+}
+
+var _ Expression = (*exactNum)(nil)
+
+// exactNum is a number parsed with ParseOptions.ExactNumbers, holding an int64, *big.Int or *big.Rat.
+type exactNum struct {
+	n any
+}
+
+func (n exactNum) Calculate(_ []byte) (any, error) {
+	return n.n, nil
+}
+
+var _ Expression = (*str)(nil)
+
+type str struct {
+	s string
+}
+
+func (s str) Calculate(_ []byte) (any, error) {
+	return s.s, nil
+}
+
+var _ Expression = (*selectorPath)(nil)
+
+type selectorPath struct {
+	s     string
+	exact bool
+}
+
+func (i selectorPath) Calculate(src []byte) (any, error) {
+	return i.value(i.result(src)), nil
+}
+
+func (i selectorPath) result(src []byte) gjson.Result {
+	return gjson.GetBytes(src, i.s)
+}
+
+func (i selectorPath) value(result gjson.Result) any {
+	if i.exact {
+		return exactJSONValue(result)
+	}
+	return result.Value()
+}
+
+func (i selectorPath) lookup(src []byte) (any, bool, error) {
+	result := i.result(src)
+	return i.value(result), result.Exists(), nil
+}
+
+// pathLookup is implemented by selector paths, returning the value of the path and if it is present within
+// the data to distinguish a missing value from null.
+type pathLookup interface {
+	lookup(src []byte) (value any, found bool, err error)
+}
+
+// pathResult is implemented by selector paths, allowing operations to use the gjson result of the path
+// directly eg. to distinguish a missing value from null or to iterate over the raw elements of an array.
+type pathResult interface {
+	Expression
+
+	// result returns the gjson result of the path within the data.
+	result(src []byte) gjson.Result
+
+	// value returns the value of a result of the path as calculated by the path.
+	value(result gjson.Result) any
+}
+
+var _ Expression = (*exists)(nil)
+
+// exists is `EXISTS .path`, which is true when the path is present in the data even if its value is null.
+type exists struct {
+	path string
+}
+
+func (e exists) Calculate(src []byte) (any, error) {
+	return gjson.GetBytes(src, e.path).Exists(), nil
+}
+
+var _ Expression = (*isCheck)(nil)
+
+// isCheck is `IS [NOT] NULL` or `IS [NOT] MISSING`, distinguished by its kind.
+type isCheck struct {
+	value Expression
+	kind  NodeKind
+}
+
+func (c isCheck) Calculate(src []byte) (any, error) {
+	// only a selector path can be missing, any other value is present and null when nil.
+	var present, null bool
+	if s, ok := c.value.(pathLookup); ok {
+		value, found, err := s.lookup(src)
+		if err != nil {
+			return nil, err
+		}
+		present, null = found, value == nil
+	} else {
+		value, err := c.value.Calculate(src)
+		if err != nil {
+			return nil, err
+		}
+		present, null = true, value == nil
+	}
+
+	switch c.kind {
+	case NodeIsNull:
+		return present && null, nil
+	case NodeIsNotNull:
+		return present && !null, nil
+	case NodeIsMissing:
+		return !present, nil
+	default:
+		return present, nil
+	}
+}
+
+var _ Expression = (*parameter)(nil)
 
-type boolean struct {
-	b bool
+type parameter struct {
+	name  string
+	exact bool
 }
 
-func (b boolean) Calculate(_ []byte) (any, error) {
-	return b.b, nil
+func (p parameter) Calculate(_ []byte) (any, error) {
+	return nil, ErrUnboundParameter{Name: p.name}
 }
 
-var _ Expression = (*num)(nil)
+var _ Expression = (*boundParameter)(nil)
 
-type num struct {
-	n float64
+type boundParameter struct {
+	name  string
+	value any
+	exact bool
 }
 
-func (n num) Calculate(_ []byte) (any, error) {
-	return n.n, nil
+func (p boundParameter) Calculate(_ []byte) (any, error) {
+	return p.value, nil
 }
 
-var _ Expression = (*str)(nil)
+var _ Expression = (*call)(nil)
 
-type str struct {
-	s string
+type call struct {
+	name string
+	fn   Function
+	args []Expression
 }
 
-func (s str) Calculate(_ []byte) (any, error) {
-	return s.s, nil
+func (c call) Calculate(src []byte) (any, error) {
+	args := make([]any, len(c.args))
+	for i, arg := range c.args {
+		value, err := arg.Calculate(src)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return c.fn.call(c.name, args)
 }
 
-var _ Expression = (*selectorPath)(nil)
+var _ Expression = (*calledConstant)(nil)
 
-type selectorPath struct {
-	s string
+type calledConstant struct {
+	value any
+	call  call
 }
 
-func (i selectorPath) Calculate(src []byte) (any, error) {
-	return gjson.GetBytes(src, i.s).Value(), nil
+func (c calledConstant) Calculate(_ []byte) (any, error) {
+	return c.value, nil
 }
 
 var _ Expression = (*add)(nil)
@@ -995,15 +1901,28 @@ func (a add) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return addValues(left, right)
+}
+
+// addValues adds the calculated values, concatenating strings.
+func addValues(left, right any) (any, error) {
+	if result, ok, err := exactArithmetic('+', left, right); ok {
+		return result, err
+	}
+
+	if result, ok, err := timeArithmetic('+', left, right); ok {
+		return result, err
+	}
+
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		if left != nil && right == nil {
 			switch left.(type) {
-			case string, float64:
+			case string, float64, int64, *big.Int, *big.Rat:
 				return left, nil
 			}
 		} else if right != nil && left == nil {
 			switch right.(type) {
-			case string, float64:
+			case string, float64, int64, *big.Int, *big.Rat:
 				return right, nil
 			}
 		}
@@ -1037,6 +1956,19 @@ func (s sub) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return subValues(left, right)
+}
+
+// subValues subtracts the calculated right value from the left.
+func subValues(left, right any) (any, error) {
+	if result, ok, err := exactArithmetic('-', left, right); ok {
+		return result, err
+	}
+
+	if result, ok, err := timeArithmetic('-', left, right); ok {
+		return result, err
+	}
+
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s - %s", left, right)}
 	}
@@ -1066,6 +1998,19 @@ func (m multi) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return multiplyValues(left, right)
+}
+
+// multiplyValues multiplies the calculated values.
+func multiplyValues(left, right any) (any, error) {
+	if result, ok, err := exactArithmetic('*', left, right); ok {
+		return result, err
+	}
+
+	if result, ok, err := timeArithmetic('*', left, right); ok {
+		return result, err
+	}
+
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s * %s", left, right)}
 	}
@@ -1095,6 +2040,19 @@ func (d div) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return divideValues(left, right)
+}
+
+// divideValues divides the calculated left value by the right.
+func divideValues(left, right any) (any, error) {
+	if result, ok, err := exactArithmetic('/', left, right); ok {
+		return result, err
+	}
+
+	if result, ok, err := timeArithmetic('/', left, right); ok {
+		return result, err
+	}
+
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s / %s", left, right)}
 	}
@@ -1124,7 +2082,7 @@ func (e eq) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
-	return reflect.DeepEqual(left, right), nil
+	return valuesEqual(left, right), nil
 }
 
 var _ Expression = (*gt)(nil)
@@ -1144,6 +2102,15 @@ func (g gt) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return gtValues(left, right)
+}
+
+// gtValues returns if the calculated left value is greater than the right.
+func gtValues(left, right any) (any, error) {
+	if cmp, ok := compareNumbers(left, right); ok {
+		return cmp > 0, nil
+	}
+
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s > %s", left, right)}
 	}
@@ -1153,6 +2120,8 @@ func (g gt) Calculate(src []byte) (any, error) {
 		return l > right.(string), nil
 	case float64:
 		return l > right.(float64), nil
+	case time.Duration:
+		return l > right.(time.Duration), nil
 	case time.Time:
 		return l.After(right.(time.Time)), nil
 	default:
@@ -1177,6 +2146,15 @@ func (g gte) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return gteValues(left, right)
+}
+
+// gteValues returns if the calculated left value is greater than or equal to the right.
+func gteValues(left, right any) (any, error) {
+	if cmp, ok := compareNumbers(left, right); ok {
+		return cmp >= 0, nil
+	}
+
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s >= %s", left, right)}
 	}
@@ -1186,6 +2164,8 @@ func (g gte) Calculate(src []byte) (any, error) {
 		return l >= right.(string), nil
 	case float64:
 		return l >= right.(float64), nil
+	case time.Duration:
+		return l >= right.(time.Duration), nil
 	case time.Time:
 		r := right.(time.Time)
 		return l.After(r) || l.Equal(r), nil
@@ -1211,6 +2191,15 @@ func (l lt) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return ltValues(left, right)
+}
+
+// ltValues returns if the calculated left value is less than the right.
+func ltValues(left, right any) (any, error) {
+	if cmp, ok := compareNumbers(left, right); ok {
+		return cmp < 0, nil
+	}
+
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s < %s", left, right)}
 	}
@@ -1220,6 +2209,8 @@ func (l lt) Calculate(src []byte) (any, error) {
 		return l < right.(string), nil
 	case float64:
 		return l < right.(float64), nil
+	case time.Duration:
+		return l < right.(time.Duration), nil
 	case time.Time:
 		return l.Before(right.(time.Time)), nil
 	default:
@@ -1244,6 +2235,15 @@ func (l lte) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return lteValues(left, right)
+}
+
+// lteValues returns if the calculated left value is less than or equal to the right.
+func lteValues(left, right any) (any, error) {
+	if cmp, ok := compareNumbers(left, right); ok {
+		return cmp <= 0, nil
+	}
+
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s <= %s", left, right)}
 	}
@@ -1253,6 +2253,8 @@ func (l lte) Calculate(src []byte) (any, error) {
 		return l <= right.(string), nil
 	case float64:
 		return l <= right.(float64), nil
+	case time.Duration:
+		return l <= right.(time.Duration), nil
 	case time.Time:
 		r := right.(time.Time)
 		return l.Before(r) || l.Equal(r), nil
@@ -1261,6 +2263,37 @@ func (l lte) Calculate(src []byte) (any, error) {
 	}
 }
 
+var _ Expression = (*conditional)(nil)
+
+// conditional is an IF or CASE expression, distinguished by its kind.
+type conditional struct {
+	kind NodeKind
+
+	// whens are pairs of conditions and the value returned when the condition is true.
+	whens []Expression
+
+	// otherwise is the value returned when no condition is true, which is nil for a CASE without an ELSE
+	// resulting in NULL.
+	otherwise Expression
+}
+
+func (c conditional) Calculate(src []byte) (any, error) {
+	// like `&&` only the branches required are calculated and a condition that isn't a boolean is false.
+	for i := 0; i < len(c.whens); i += 2 {
+		condition, err := c.whens[i].Calculate(src)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := condition.(bool); ok && b {
+			return c.whens[i+1].Calculate(src)
+		}
+	}
+	if c.otherwise == nil {
+		return nil, nil
+	}
+	return c.otherwise.Calculate(src)
+}
+
 var _ Expression = (*not)(nil)
 
 type not struct {
@@ -1273,6 +2306,11 @@ func (n not) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return notValue(value)
+}
+
+// notValue negates the calculated value.
+func notValue(value any) (any, error) {
 	switch t := value.(type) {
 	case bool:
 		return !t, nil
@@ -1306,6 +2344,11 @@ func (o or) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return orValues(left, right)
+}
+
+// orValues applies `||` to the calculated values when the left value has not short circuited.
+func orValues(left, right any) (any, error) {
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s || %s", left, right)}
 	}
@@ -1345,6 +2388,11 @@ func (a and) Calculate(src []byte) (any, error) {
 		return nil, err
 	}
 
+	return andValues(left, right)
+}
+
+// andValues applies `&&` to the calculated values when the left value has not short circuited.
+func andValues(left, right any) (any, error) {
 	if reflect.TypeOf(left) != reflect.TypeOf(right) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s && %s", left, right)}
 	}
@@ -1357,6 +2405,187 @@ func (a and) Calculate(src []byte) (any, error) {
 	}
 }
 
+var _ Expression = (*quantifier)(nil)
+
+// quantifier is an ANY, ALL or NONE predicate over the elements of an array, distinguished by its kind.
+type quantifier struct {
+	kind      NodeKind
+	array     Expression
+	predicate Expression
+}
+
+func (q quantifier) Calculate(src []byte) (any, error) {
+	// ANY stops at the first element the predicate is true for, ALL and NONE at the first it isn't or is.
+	stopOn := q.kind != NodeAll
+
+	var stopped bool
+	var predicateErr error
+	test := func(element []byte) bool {
+		var result any
+		if result, predicateErr = q.predicate.Calculate(element); predicateErr != nil {
+			return false
+		}
+		b, ok := result.(bool)
+		if !ok {
+			predicateErr = ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s (%v) !", q.operator(), result)}
+			return false
+		}
+		stopped = b == stopOn
+		return !stopped
+	}
+
+	if s, ok := q.array.(pathResult); ok {
+		// the raw JSON of each element is used as is, avoiding re-encoding it.
+		result := s.result(src)
+		switch {
+		case result.IsArray():
+			result.ForEach(func(_, value gjson.Result) bool {
+				return test([]byte(value.Raw))
+			})
+		case result.Type != gjson.Null:
+			return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s %s !", q.operator(), result.Value())}
+		}
+	} else {
+		value, err := q.array.Calculate(src)
+		if err != nil {
+			return nil, err
+		}
+		switch v := value.(type) {
+		case nil:
+		case []any:
+			for _, element := range v {
+				b, err := marshalElement(element)
+				if err != nil {
+					return nil, err
+				}
+				if !test(b) {
+					break
+				}
+			}
+		default:
+			return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s %v !", q.operator(), value)}
+		}
+	}
+	if predicateErr != nil {
+		return nil, predicateErr
+	}
+
+	// an empty, NULL or missing array has no elements, so ANY is false and ALL and NONE are vacuously true.
+	if stopped {
+		return q.kind == NodeAny, nil
+	}
+	return q.kind != NodeAny, nil
+}
+
+func (q quantifier) operator() string {
+	switch q.kind {
+	case NodeAll:
+		return "ALL"
+	case NodeNone:
+		return "NONE"
+	default:
+		return "ANY"
+	}
+}
+
+// marshalElement returns the JSON of an array element calculated by an expression, so that it can be used as
+// the root of a predicate, encoding exact numbers as JSON numbers.
+func marshalElement(value any) ([]byte, error) {
+	return json.Marshal(jsonCompatible(value))
+}
+
+// jsonCompatible returns the value with any *big.Rat, including those within arrays and objects, replaced by
+// its decimal representation.
+func jsonCompatible(value any) any {
+	switch v := value.(type) {
+	case *big.Rat:
+		return json.Number(formatExactNumber(v))
+	case []any:
+		arr := make([]any, len(v))
+		for i, e := range v {
+			arr[i] = jsonCompatible(e)
+		}
+		return arr
+	case map[string]any:
+		obj := make(map[string]any, len(v))
+		for k, e := range v {
+			obj[k] = jsonCompatible(e)
+		}
+		return obj
+	default:
+		return value
+	}
+}
+
+var _ Expression = (*filterCall)(nil)
+
+// filterCall is `filter(array, predicate)`, whose predicate is calculated for each element of the array with
+// the element as its root, so `.` or `.@this` is the element itself, rather than once beforehand like the
+// arguments of other functions.
+type filterCall struct {
+	array     Expression
+	predicate Expression
+}
+
+func (f filterCall) Calculate(src []byte) (any, error) {
+	var err error
+	result := make([]any, 0)
+	keep := func(value any, element []byte) bool {
+		var matched any
+		if matched, err = f.predicate.Calculate(element); err != nil {
+			return false
+		}
+		if b, ok := matched.(bool); ok && b {
+			result = append(result, value)
+		}
+		return true
+	}
+
+	if s, ok := f.array.(pathResult); ok {
+		// the raw JSON of each element is used as is, avoiding re-encoding it.
+		arr := s.result(src)
+		switch {
+		case arr.IsArray():
+			arr.ForEach(func(_, value gjson.Result) bool {
+				return keep(s.value(value), []byte(value.Raw))
+			})
+		case arr.Type == gjson.Null:
+			return nil, nil
+		default:
+			return nil, ErrFunctionArgument{Function: filterFunction, Index: 0, Expected: ArgArray, Value: arr.Value()}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	value, err := f.array.Calculate(src)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		for _, element := range v {
+			b, err := marshalElement(element)
+			if err != nil {
+				return nil, err
+			}
+			if !keep(element, b) {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	default:
+		return nil, ErrFunctionArgument{Function: filterFunction, Index: 0, Expected: ArgArray, Value: value}
+	}
+}
+
 var _ Expression = (*contains)(nil)
 
 type contains struct {
@@ -1385,7 +2614,7 @@ func (c contains) Calculate(src []byte) (any, error) {
 		return strings.Contains(l, right.(string)), nil
 	case []any:
 		for _, v := range l {
-			if reflect.DeepEqual(v, right) {
+			if valuesEqual(v, right) {
 				return true, nil
 			}
 		}
@@ -1449,7 +2678,7 @@ func (c containsAny) Calculate(src []byte) (any, error) {
 			// betting that lists are short and so less expensive than iterating one to create a hash set
 			for _, rv := range r {
 				for _, lv := range l {
-					if reflect.DeepEqual(rv, lv) {
+					if valuesEqual(rv, lv) {
 						return true, nil
 					}
 				}
@@ -1459,7 +2688,7 @@ func (c containsAny) Calculate(src []byte) (any, error) {
 			// betting that lists are short and so less expensive than iterating one to create a hash set
 			for _, c := range r {
 				for _, v := range l {
-					if reflect.DeepEqual(string(c), v) {
+					if valuesEqual(string(c), v) {
 						return true, nil
 					}
 				}
@@ -1527,7 +2756,7 @@ func (c containsAll) Calculate(src []byte) (any, error) {
 		OUTER3:
 			for _, rv := range r {
 				for _, lv := range l {
-					if reflect.DeepEqual(rv, lv) {
+					if valuesEqual(rv, lv) {
 						continue OUTER3
 					}
 				}
@@ -1539,7 +2768,7 @@ func (c containsAll) Calculate(src []byte) (any, error) {
 		OUTER4:
 			for _, c := range r {
 				for _, v := range l {
-					if reflect.DeepEqual(string(c), v) {
+					if valuesEqual(string(c), v) {
 						continue OUTER4
 					}
 				}
@@ -1613,6 +2842,140 @@ func (e endsWith) Calculate(src []byte) (any, error) {
 	}
 }
 
+var _ Expression = (*matches)(nil)
+
+type matches struct {
+	left        Expression
+	right       Expression
+	insensitive bool
+
+	// re is the pattern compiled at parse time when it is constant, otherwise it is compiled when
+	// calculated using the regex cache.
+	re *regexp.Regexp
+}
+
+// newMatches returns a MATCHES or IMATCHES operation, compiling the pattern if it is constant.
+func newMatches(left, right Expression, insensitive bool) (matches, error) {
+	m := matches{left: left, right: right, insensitive: insensitive}
+	if l, ok := right.(Literal); ok {
+		if pattern, ok := l.Value().(string); ok {
+			re, err := compileRegex(pattern, insensitive)
+			if err != nil {
+				return m, err
+			}
+			m.re = re
+		}
+	}
+	return m, nil
+}
+
+func (m matches) Calculate(src []byte) (any, error) {
+	left, err := m.left.Calculate(src)
+	if err != nil {
+		return nil, err
+	}
+
+	re := m.re
+	if re == nil {
+		right, err := m.right.Calculate(src)
+		if err != nil {
+			return nil, err
+		}
+		pattern, ok := right.(string)
+		if !ok {
+			return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s %s %s", left, m.operator(), right)}
+		}
+		if re, err = regexes.compile(pattern, m.insensitive); err != nil {
+			return nil, err
+		}
+	}
+
+	switch l := left.(type) {
+	case string:
+		return re.MatchString(l), nil
+	default:
+		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s %s %s !", left, m.operator(), re)}
+	}
+}
+
+func (m matches) operator() string {
+	if m.insensitive {
+		return "IMATCHES"
+	}
+	return "MATCHES"
+}
+
+var _ Expression = (*like)(nil)
+
+// like is a LIKE, ILIKE or GLOB operation, distinguished by its kind.
+type like struct {
+	left  Expression
+	right Expression
+	kind  NodeKind
+
+	// escape escapes the character following it within a LIKE or ILIKE pattern.
+	escape rune
+
+	// pattern is translated at parse time when it is constant, otherwise it is translated when calculated.
+	pattern *wildcardPattern
+}
+
+// newLike returns a LIKE, ILIKE or GLOB operation, translating the pattern if it is constant.
+func newLike(left, right Expression, kind NodeKind, escape rune) (like, error) {
+	l := like{left: left, right: right, kind: kind, escape: escape}
+	if lit, ok := right.(Literal); ok {
+		if pattern, ok := lit.Value().(string); ok {
+			wp, err := l.translate(pattern)
+			if err != nil {
+				return l, err
+			}
+			l.pattern = wp
+		}
+	}
+	return l, nil
+}
+
+func (l like) translate(pattern string) (wp *wildcardPattern, err error) {
+	if l.kind == NodeGlob {
+		wp, err = parseGlob(pattern)
+	} else {
+		wp, err = parseLike(pattern, l.kind == NodeILike, l.escape)
+	}
+	if err != nil {
+		return nil, ErrInvalidPattern{Pattern: pattern, Err: err}
+	}
+	return wp, nil
+}
+
+func (l like) Calculate(src []byte) (any, error) {
+	left, err := l.left.Calculate(src)
+	if err != nil {
+		return nil, err
+	}
+
+	wp := l.pattern
+	if wp == nil {
+		right, err := l.right.Calculate(src)
+		if err != nil {
+			return nil, err
+		}
+		pattern, ok := right.(string)
+		if !ok {
+			return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s %s %s", left, operatorText(l.kind), right)}
+		}
+		if wp, err = l.translate(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	switch s := left.(type) {
+	case string:
+		return wp.match(s), nil
+	default:
+		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s %s pattern !", left, operatorText(l.kind))}
+	}
+}
+
 var _ Expression = (*in)(nil)
 
 type in struct {
@@ -1635,7 +2998,7 @@ func (i in) Calculate(src []byte) (any, error) {
 		return nil, ErrUnsupportedTypeComparison{s: fmt.Sprintf("%s IN %s !", left, right)}
 	}
 	for _, v := range arr {
-		if left == v {
+		if valuesEqual(left, v) {
 			return true, nil
 		}
 	}
@@ -1660,6 +3023,26 @@ func (a array) Calculate(src []byte) (any, error) {
 	return arr, nil
 }
 
+var _ Expression = (*object)(nil)
+
+// object is an object literal whose values are calculated in the order of its keys.
+type object struct {
+	keys   []string
+	values []Expression
+}
+
+func (o object) Calculate(src []byte) (any, error) {
+	obj := make(map[string]any, len(o.keys))
+	for i, v := range o.values {
+		res, err := v.Calculate(src)
+		if err != nil {
+			return nil, err
+		}
+		obj[o.keys[i]] = res
+	}
+	return obj, nil
+}
+
 type coerceSubstr struct {
 	value Expression
 	start optionext.Option[int]
@@ -1704,3 +3087,37 @@ func (c coerceSubstr) Calculate(src []byte) (any, error) {
 		return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v for substr", value)}
 	}
 }
+
+// coerceRegex extracts a capture group of the first match of a regular expression.
+type coerceRegex struct {
+	value   Expression
+	pattern string
+	re      *regexp.Regexp
+
+	// group is the group as written, either an int, string or nil when defaulted.
+	group any
+
+	// index is the index of the group to extract, defaulting to the first capture group or the entire match
+	// when the pattern has none.
+	index int
+}
+
+func (c coerceRegex) Calculate(src []byte) (any, error) {
+	value, err := c.value.Calculate(src)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		loc := c.re.FindStringSubmatchIndex(v)
+		if loc == nil || loc[2*c.index] < 0 {
+			return nil, nil
+		}
+		return v[loc[2*c.index]:loc[2*c.index+1]], nil
+	default:
+		return nil, ErrUnsupportedCoerce{s: fmt.Sprintf("unsupported type COERCE for value: %v for regex", value)}
+	}
+}
@@ -3,6 +3,7 @@ package ksql
 import (
 	"fmt"
 	"github.com/stretchr/testify/require"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -760,6 +761,447 @@ func TestParser(t *testing.T) {
 	}
 }
 
+func TestParserPrecedence(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		src      string
+		expected any
+		parseErr bool
+	}{
+		{
+			name:     "multiply before add",
+			exp:      `1 + 2 * 3`,
+			expected: 7.0,
+		},
+		{
+			name:     "multiply before add reversed",
+			exp:      `2 * 3 + 1`,
+			expected: 7.0,
+		},
+		{
+			name:     "divide before subtract",
+			exp:      `10 - 6 / 2`,
+			expected: 7.0,
+		},
+		{
+			name:     "subtract left associative",
+			exp:      `10 - 4 - 3`,
+			expected: 3.0,
+		},
+		{
+			name:     "divide left associative",
+			exp:      `8 / 4 / 2`,
+			expected: 1.0,
+		},
+		{
+			name:     "parenthesis override",
+			exp:      `(1 + 2) * 3`,
+			expected: 9.0,
+		},
+		{
+			name:     "arithmetic before comparison",
+			exp:      `1 + 2 == 3`,
+			expected: true,
+		},
+		{
+			name:     "arithmetic both sides of comparison",
+			exp:      `.a * 2 > .b + 1`,
+			src:      `{"a":3,"b":4}`,
+			expected: true,
+		},
+		{
+			name:     "arithmetic before IN",
+			exp:      `.a + 1 IN [2, 3]`,
+			src:      `{"a":1}`,
+			expected: true,
+		},
+		{
+			name:     "arithmetic before STARTSWITH",
+			exp:      `"te" + "am" STARTSWITH "tea"`,
+			expected: true,
+		},
+		{
+			name:     "arithmetic before BETWEEN",
+			exp:      `1 + 1 BETWEEN 1 3`,
+			expected: true,
+		},
+		{
+			name:     "arithmetic within BETWEEN bounds",
+			exp:      `5 BETWEEN 1 + 1 2 * 3`,
+			expected: true,
+		},
+		{
+			name:     "STARTSWITH before comparison",
+			exp:      `.name STARTSWITH "a" == true`,
+			src:      `{"name":"abc"}`,
+			expected: true,
+		},
+		{
+			name:     "CONTAINS before comparison",
+			exp:      `false == "team" CONTAINS "x"`,
+			expected: true,
+		},
+		{
+			name:     "BETWEEN before comparison",
+			exp:      `.a BETWEEN 0 10 == true`,
+			src:      `{"a":5}`,
+			expected: true,
+		},
+		{
+			name:     "comparison before and",
+			exp:      `.a == 1 && .b == 2`,
+			src:      `{"a":1,"b":2}`,
+			expected: true,
+		},
+		{
+			name:     "and before or",
+			exp:      `true || false && false`,
+			expected: true,
+		},
+		{
+			name:     "and before or reversed",
+			exp:      `false && false || true`,
+			expected: true,
+		},
+		{
+			name:     "and before or with comparisons",
+			exp:      `.a == 1 && .b == 2 || .c == 3`,
+			src:      `{"a":1,"b":0,"c":3}`,
+			expected: true,
+		},
+		{
+			name:     "or with trailing and",
+			exp:      `.c == 3 || .a == 1 && .b == 2`,
+			src:      `{"a":0,"b":2,"c":0}`,
+			expected: false,
+		},
+		{
+			name:     "prefix not binds tightest",
+			exp:      `!true || true`,
+			expected: true,
+		},
+		{
+			name:     "prefix not on parenthesis",
+			exp:      `!(true || true)`,
+			expected: false,
+		},
+		{
+			name:     "prefix not before comparison",
+			exp:      `!.f1 == true`,
+			src:      `{"f1":false}`,
+			expected: true,
+		},
+		{
+			name:     "negated comparison after arithmetic",
+			exp:      `2 * 3 !> 5`,
+			expected: false,
+		},
+		{
+			name:     "negated comparison before and",
+			exp:      `.a != 1 && .b !> 2`,
+			src:      `{"a":2,"b":2}`,
+			expected: true,
+		},
+		{
+			name:     "negated string operation",
+			exp:      `"a" + "b" !IN ["ab"] || true`,
+			expected: true,
+		},
+		{
+			name:     "COERCE before comparison",
+			exp:      `COERCE .name _lowercase_ == "joey" && true`,
+			src:      `{"name":"JOEY"}`,
+			expected: true,
+		},
+		{
+			name:     "array elements are expressions",
+			exp:      `[1 + 1, 2 * 3] == [2, 6]`,
+			expected: true,
+		},
+		{
+			name:     "unmatched close paren",
+			exp:      `1 + 1)`,
+			parseErr: true,
+		},
+		{
+			name:     "unclosed paren",
+			exp:      `(1 + 1`,
+			parseErr: true,
+		},
+		{
+			name:     "dangling operator",
+			exp:      `1 +`,
+			parseErr: true,
+		},
+		{
+			name:     "not followed by value in operation position",
+			exp:      `1 ! 2`,
+			parseErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			if tc.parseErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+
+			got, err := ex.Calculate([]byte(tc.src))
+			assert.NoError(err)
+			assert.Equal(tc.expected, got)
+		})
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		offset   int
+		token    string
+		expected []TokenKind
+		snippet  string
+	}{
+		{
+			name:     "empty",
+			exp:      ``,
+			offset:   0,
+			expected: valueTokens,
+			snippet:  "\n^",
+		},
+		{
+			name:     "unmatched close paren",
+			exp:      `.a == 1 && )`,
+			offset:   11,
+			token:    ")",
+			expected: valueTokens,
+			snippet:  ".a == 1 && )\n           ^",
+		},
+		{
+			name:     "trailing value",
+			exp:      `.a == 1 "x"`,
+			offset:   8,
+			token:    `"x"`,
+			expected: operationTokens,
+			snippet:  ".a == 1 \"x\"\n        ^^^",
+		},
+		{
+			name:     "missing value after operation",
+			exp:      `.a ==`,
+			offset:   5,
+			expected: valueTokens,
+			snippet:  ".a ==\n     ^",
+		},
+		{
+			name:     "unclosed paren",
+			exp:      `(.a == 1`,
+			offset:   8,
+			expected: []TokenKind{CloseParen},
+		},
+		{
+			name:     "unclosed array",
+			exp:      `.a IN [1, 2`,
+			offset:   11,
+			expected: []TokenKind{CloseBracket},
+		},
+		{
+			name:     "missing COERCE identifier",
+			exp:      `COERCE .a == 1`,
+			offset:   10,
+			token:    "==",
+			expected: []TokenKind{Identifier},
+		},
+		{
+			name:    "unknown COERCE identifier",
+			exp:     "true &&\n\tCOERCE .a _unknown_",
+			offset:  19,
+			token:   "_unknown_",
+			snippet: "\tCOERCE .a _unknown_\n\t          ^^^^^^^^^",
+		},
+		{
+			name:     "invalid substr",
+			exp:      `COERCE .a _substr_["a":2]`,
+			offset:   19,
+			token:    `"a"`,
+			expected: []TokenKind{Number, Colon},
+		},
+		{
+			name:     "substr missing colon",
+			exp:      `COERCE .a _substr_[1]`,
+			offset:   20,
+			token:    "]",
+			expected: []TokenKind{Colon},
+		},
+		{
+			name:   "substr bad indexes",
+			exp:    `COERCE .a _substr_[3:1]`,
+			offset: 22,
+			token:  "]",
+		},
+		{
+			name:   "const COERCE fails",
+			exp:    `COERCE true _lowercase_`,
+			offset: 12,
+			token:  "_lowercase_",
+		},
+		{
+			name:     "lexer error",
+			exp:      `.a = 1 & .b`,
+			offset:   7,
+			token:    "&",
+			expected: []TokenKind{And},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.exp))
+			assert.Error(err)
+
+			var syntaxErr ErrSyntax
+			assert.ErrorAs(err, &syntaxErr)
+			assert.Equal(tc.offset, syntaxErr.Offset)
+			assert.Equal(tc.token, syntaxErr.Token)
+			assert.Equal(tc.expected, syntaxErr.Expected)
+			if tc.snippet != "" {
+				assert.Equal(tc.snippet, syntaxErr.Snippet())
+			}
+		})
+	}
+}
+
+func TestParserErrorMessage(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := Parse([]byte(`.a == 1 && )`))
+	assert.EqualError(err, "1:12: token is not a valid value `)`, expected one of selector path, string, number, true, false, NULL, parameter, function, IF, CASE, EXISTS, ANY, ALL, NONE, [, {, (, !, COERCE")
+
+	_, err = Parse([]byte(`(.a == 1`))
+	assert.EqualError(err, "1:9: expression after open parenthesis '(' ends unexpectedly, expected )")
+}
+
+func TestParserLimits(t *testing.T) {
+	longString := `"` + strings.Repeat("a", 70000) + `"`
+
+	tests := []struct {
+		name   string
+		exp    string
+		opts   ParseOptions
+		offset int
+		err    error
+	}{
+		{
+			name: "within depth",
+			exp:  strings.Repeat("(", 999) + "1" + strings.Repeat(")", 999),
+		},
+		{
+			name:   "default depth",
+			exp:    strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000),
+			offset: 1000,
+			err:    ErrLimitExceeded{Limit: LimitDepth, Max: DefaultMaxDepth},
+		},
+		{
+			name:   "depth",
+			exp:    `.a == 1 && !(.b IN [[1]])`,
+			opts:   ParseOptions{MaxDepth: 4},
+			offset: 21,
+			err:    ErrLimitExceeded{Limit: LimitDepth, Max: 4},
+		},
+		{
+			name:   "nested not",
+			exp:    strings.Repeat("!", 100000) + "true",
+			opts:   ParseOptions{MaxDepth: 100},
+			offset: 100,
+			err:    ErrLimitExceeded{Limit: LimitDepth, Max: 100},
+		},
+		{
+			name: "operands are not nested",
+			exp:  `.a || .b && .c == 1 + 2 * COERCE .d _number_`,
+			opts: ParseOptions{MaxDepth: 2},
+		},
+		{
+			name: "within length",
+			exp:  `.a == 1`,
+			opts: ParseOptions{MaxLength: 7},
+		},
+		{
+			name:   "length",
+			exp:    `.a == 10`,
+			opts:   ParseOptions{MaxLength: 7},
+			offset: 7,
+			err:    ErrLimitExceeded{Limit: LimitExpressionLength, Max: 7},
+		},
+		{
+			name: "within tokens",
+			exp:  `.a IN [1, 2]`,
+			opts: ParseOptions{MaxTokens: 7},
+		},
+		{
+			name:   "tokens",
+			exp:    `.a IN [1, 2, 3]`,
+			opts:   ParseOptions{MaxTokens: 7},
+			offset: 13,
+			err:    ErrLimitExceeded{Limit: LimitTokens, Max: 7},
+		},
+		{
+			name: "long string",
+			exp:  longString + ` == .a`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert := require.New(t)
+
+			_, err := ParseWithOptions([]byte(tc.exp), tc.opts)
+			if tc.err == nil {
+				assert.NoError(err)
+				return
+			}
+
+			var syntaxErr ErrSyntax
+			assert.ErrorAs(err, &syntaxErr)
+			assert.Equal(tc.offset, syntaxErr.Offset)
+			assert.Equal(tc.err, syntaxErr.Err)
+		})
+	}
+}
+
+func TestParserLongTokens(t *testing.T) {
+	assert := require.New(t)
+
+	// lengths beyond 65535 bytes are not truncated.
+	s := strings.Repeat("a", 70000)
+	ex, err := Parse([]byte(`"` + s + `" + .` + s))
+	assert.NoError(err)
+
+	result, err := ex.Calculate([]byte(`{"` + s + `":"!"}`))
+	assert.NoError(err)
+	assert.Equal(s+"!", result)
+
+	ex, err = Parse([]byte(strings.Repeat(" ", 70000) + `1 + 1`))
+	assert.NoError(err)
+	result, err = ex.Calculate(nil)
+	assert.NoError(err)
+	assert.Equal(2.0, result)
+}
+
 type Star struct {
 	expression Expression
 }
@@ -778,6 +1220,58 @@ func (s *Star) Calculate(json []byte) (interface{}, error) {
 	}
 }
 
+// Rep repeats a string the number of times read as the argument of its coercion eg. `_rep_[2]`.
+type Rep struct {
+	expression Expression
+	n          int
+}
+
+func (r *Rep) Calculate(json []byte) (interface{}, error) {
+	inner, err := r.expression.Calculate(json)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := inner.(type) {
+	case string:
+		return strings.Repeat(t, r.n), nil
+	default:
+		return nil, fmt.Errorf("cannot repeat value %v", inner)
+	}
+}
+
+// repEnvironment returns an Environment with the coercion `_rep_[n]`, which reads its argument from the parser.
+func repEnvironment() *Environment {
+	env := NewEnvironment()
+	env.SetCoercion("_rep_", func(p *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
+		if _, err := p.expectToken(OpenBracket); err != nil {
+			return false, nil, err
+		}
+		token, err := p.expectToken(Number)
+		if err != nil {
+			return false, nil, err
+		}
+		n, err := strconv.Atoi(p.tokenText(token))
+		if err != nil {
+			return false, nil, p.errorAt(token, nil, err)
+		}
+		if _, err := p.expectToken(CloseBracket); err != nil {
+			return false, nil, err
+		}
+		e = &Rep{expression: expression, n: n}
+		if constEligible {
+			value, err := e.Calculate(nil)
+			if err != nil {
+				return false, nil, err
+			}
+			literal, err := NewLiteral(value)
+			return err == nil, literal, err
+		}
+		return false, e, nil
+	})
+	return env
+}
+
 func TestParserCustomCoercion(t *testing.T) {
 	assert := require.New(t)
 
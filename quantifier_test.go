@@ -0,0 +1,144 @@
+package ksql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantifiers(t *testing.T) {
+	assert := require.New(t)
+
+	const src = `{"items":[{"sku":"a","qty":5},{"sku":"b","qty":20}],"tags":["x","y"],"empty":[],"null":null,"name":"joey"}`
+
+	tests := []struct {
+		name     string
+		exp      string
+		expected any
+		err      bool
+	}{
+		{name: "any true", exp: `ANY .items (.qty > 10)`, expected: true},
+		{name: "any false", exp: `ANY .items (.qty > 100)`, expected: false},
+		{name: "all true", exp: `ALL .items (.qty > 1)`, expected: true},
+		{name: "all false", exp: `ALL .items (.qty > 10)`, expected: false},
+		{name: "any parenthesised", exp: `ANY(.items) (.qty > 10)`, expected: true},
+		{name: "all parenthesised", exp: `ALL(.items)(.qty > 10)`, expected: false},
+		{name: "none parenthesised", exp: `NONE(.tags) (. == "z")`, expected: true},
+		{name: "none true", exp: `NONE .items (.sku == "c")`, expected: true},
+		{name: "none false", exp: `NONE .items (.sku == "b")`, expected: false},
+		{name: "empty any", exp: `ANY .empty (.qty > 1)`, expected: false},
+		{name: "empty all", exp: `ALL .empty (.qty > 1)`, expected: true},
+		{name: "empty none", exp: `NONE .empty (.qty > 1)`, expected: true},
+		{name: "missing any", exp: `ANY .missing (.qty > 1)`, expected: false},
+		{name: "missing all", exp: `ALL .missing (.qty > 1)`, expected: true},
+		{name: "missing none", exp: `NONE .missing (.qty > 1)`, expected: true},
+		{name: "null any", exp: `ANY .null (.qty > 1)`, expected: false},
+		{name: "null all", exp: `ALL .null (.qty > 1)`, expected: true},
+		{name: "scalar elements", exp: `ANY .tags (.@this == "y")`, expected: true},
+		{name: "scalar elements root", exp: `ANY .tags (. == "y")`, expected: true},
+		{name: "literal elements root", exp: `ANY [1,2] (. > 1)`, expected: true},
+		{name: "compound predicate", exp: `ANY .items (.sku IN ["a","c"] && .qty BETWEEN 1 10)`, expected: true},
+		{name: "non boolean predicate", exp: `ALL .items (.qty)`, err: true},
+		{name: "non boolean predicate of empty array", exp: `ALL .empty (.qty)`, expected: true},
+		{name: "short circuit", exp: `ANY .items (.qty > 1 || .sku / 2)`, expected: true},
+		{name: "combined", exp: `ANY .items (.qty > 10) && !ALL .tags (.@this == "x")`, expected: true},
+		{name: "nested", exp: `ANY [.items] (ANY .@this (.qty == 20))`, expected: true},
+		{name: "array expression", exp: `ALL split("1,2,3", ",") (COERCE .@this _number_ < 4)`, expected: true},
+		{name: "array literal of objects", exp: `ANY [.items.0, .items.1] (.sku == "b")`, expected: true},
+		{name: "predicate error", exp: `ANY .items (.sku > 1)`, err: true},
+		{name: "not an array", exp: `ANY .name (.a)`, err: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(src))
+			if tc.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestQuantifiersNonBooleanPredicate(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`ANY .items (.qty)`))
+	assert.NoError(err)
+
+	_, err = ex.Calculate([]byte(`{"items":[{"qty":5}]}`))
+	var comparisonErr ErrUnsupportedTypeComparison
+	assert.ErrorAs(err, &comparisonErr)
+	assert.Equal("unsupported type comparison: `ANY (5) !`", err.Error())
+}
+
+func TestQuantifiersExactNumbers(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := ParseWithParams([]byte(`ANY $amounts (.@this == 0.1)`), map[string]any{"amounts": []any{0.3, 0.1}})
+	assert.NoError(err)
+	result, err := ex.Calculate(nil)
+	assert.NoError(err)
+	assert.Equal(true, result)
+
+	ex, err = ParseWithOptions([]byte(`ANY [.a / 4] (.@this == 0.25)`), ParseOptions{ExactNumbers: true})
+	assert.NoError(err)
+	result, err = ex.Calculate([]byte(`{"a":1}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
+
+func TestQuantifiersParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name string
+		exp  string
+		err  string
+	}{
+		{
+			name: "missing predicate",
+			exp:  `ANY .items`,
+			err:  "1:11: expression ends unexpectedly, expected (",
+		},
+		{
+			name: "unclosed predicate",
+			exp:  `ALL .items (.qty > 1`,
+			err:  "1:21: expression ends unexpectedly, expected )",
+		},
+		{
+			name: "root outside of predicate",
+			exp:  `. == 1`,
+			err:  "1:1: Invalid selector path `.`, expected selector path",
+		},
+		{
+			name: "root as array",
+			exp:  `ANY . (. > 1)`,
+			err:  "1:5: Invalid selector path `.`, expected selector path",
+		},
+		{
+			name: "root after predicate",
+			exp:  `ANY .a (. > 1) && EXISTS .`,
+			err:  "1:26: Invalid selector path `.`, expected selector path",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.exp))
+			assert.Error(err)
+			assert.Equal(tc.err, err.Error())
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package ksql
+
+import (
+	"container/list"
+	"regexp"
+	"sync"
+)
+
+// regexCacheSize is the maximum number of compiled patterns kept for MATCHES operations whose pattern is
+// only known when calculated eg. `.name MATCHES .pattern`. Constant patterns are compiled once at parse
+// time and never cached.
+const regexCacheSize = 256
+
+var regexes = newRegexCache(regexCacheSize)
+
+// regexCache is a least recently used cache of compiled patterns, including those that failed to compile.
+type regexCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type regexCacheEntry struct {
+	key string
+	re  *regexp.Regexp
+	err error
+}
+
+func newRegexCache(capacity int) *regexCache {
+	return &regexCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// compile returns the compiled pattern, compiling and caching it if not already cached.
+func (c *regexCache) compile(pattern string, insensitive bool) (*regexp.Regexp, error) {
+	key := pattern
+	if insensitive {
+		key = "(?i)" + pattern
+	}
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		entry := elem.Value.(*regexCacheEntry)
+		c.mu.Unlock()
+		return entry.re, entry.err
+	}
+	c.mu.Unlock()
+
+	// compiled outside of the lock, concurrent misses for the same pattern compiling it more than
+	// once is preferable to blocking every other lookup.
+	re, err := compileRegex(pattern, insensitive)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&regexCacheEntry{key: key, re: re, err: err})
+		if c.order.Len() > c.capacity {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*regexCacheEntry).key)
+		}
+	}
+	return re, err
+}
+
+// compileRegex compiles the pattern, returning an ErrInvalidRegex if it is not a valid regular expression.
+func compileRegex(pattern string, insensitive bool) (*regexp.Regexp, error) {
+	expr := pattern
+	if insensitive {
+		expr = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, ErrInvalidRegex{Pattern: pattern, Err: err}
+	}
+	return re, nil
+}
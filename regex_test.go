@@ -0,0 +1,289 @@
+package ksql
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatches(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		src      string
+		expected any
+		err      bool
+	}{
+		{
+			name:     "matches",
+			exp:      `.email MATCHES "^[a-z]+@example\.com$"`,
+			src:      `{"email":"joey@example.com"}`,
+			expected: true,
+		},
+		{
+			name:     "no match",
+			exp:      `.email MATCHES "^[a-z]+@example\.com$"`,
+			src:      `{"email":"Joey@example.com"}`,
+			expected: false,
+		},
+		{
+			name:     "case insensitive",
+			exp:      `.email IMATCHES "^[a-z]+@example\.com$"`,
+			src:      `{"email":"Joey@Example.com"}`,
+			expected: true,
+		},
+		{
+			name:     "negated",
+			exp:      `.sku !MATCHES "^\d+$"`,
+			src:      `{"sku":"12a"}`,
+			expected: true,
+		},
+		{
+			name:     "escaped quote",
+			exp:      `.s MATCHES "^\"q\"$"`,
+			src:      `{"s":"\"q\""}`,
+			expected: true,
+		},
+		{
+			name:     "dynamic pattern",
+			exp:      `.name MATCHES .pattern`,
+			src:      `{"name":"abc","pattern":"b+"}`,
+			expected: true,
+		},
+		{
+			name:     "dynamic case insensitive pattern",
+			exp:      `.name IMATCHES .pattern`,
+			src:      `{"name":"ABC","pattern":"^abc$"}`,
+			expected: true,
+		},
+		{
+			name:     "precedence",
+			exp:      `.a + "b" MATCHES "^ab$" == true`,
+			src:      `{"a":"a"}`,
+			expected: true,
+		},
+		{
+			name: "invalid dynamic pattern",
+			exp:  `.name MATCHES .pattern`,
+			src:  `{"name":"abc","pattern":"("}`,
+			err:  true,
+		},
+		{
+			name: "non string value",
+			exp:  `.n MATCHES "1"`,
+			src:  `{"n":1}`,
+			err:  true,
+		},
+		{
+			name: "non string pattern",
+			exp:  `.name MATCHES .n`,
+			src:  `{"name":"1","n":1}`,
+			err:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(tc.src))
+			if tc.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestMatchesParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name   string
+		exp    string
+		offset int
+	}{
+		{
+			name:   "invalid constant pattern",
+			exp:    `.name MATCHES "(a"`,
+			offset: 14,
+		},
+		{
+			name:   "invalid regex coercion pattern",
+			exp:    `COERCE .name _regex_["[a"]`,
+			offset: 21,
+		},
+		{
+			name:   "regex coercion group out of range",
+			exp:    `COERCE .name _regex_["(a)", 2]`,
+			offset: 28,
+		},
+		{
+			name:   "regex coercion unknown group name",
+			exp:    `COERCE .name _regex_["(?P<a>a)", "b"]`,
+			offset: 33,
+		},
+		{
+			name:   "regex coercion missing pattern",
+			exp:    `COERCE .name _regex_[1]`,
+			offset: 21,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.exp))
+			assert.Error(err)
+
+			var syntaxErr ErrSyntax
+			assert.ErrorAs(err, &syntaxErr)
+			assert.Equal(tc.offset, syntaxErr.Offset)
+		})
+	}
+
+	_, err := Parse([]byte(`.name MATCHES "(a"`))
+	var regexErr ErrInvalidRegex
+	assert.ErrorAs(err, &regexErr)
+	assert.Equal("(a", regexErr.Pattern)
+}
+
+func TestRegexCoercion(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		src      string
+		expected any
+	}{
+		{
+			name:     "first group by default",
+			exp:      `COERCE .version _regex_["^v(\d+)\.(\d+)"]`,
+			src:      `{"version":"v1.22.3"}`,
+			expected: "1",
+		},
+		{
+			name:     "numbered group",
+			exp:      `COERCE .version _regex_["^v(\d+)\.(\d+)", 2]`,
+			src:      `{"version":"v1.22.3"}`,
+			expected: "22",
+		},
+		{
+			name:     "named group",
+			exp:      `COERCE .date _regex_["(?P<year>\d{4})-(?P<month>\d{2})", "month"]`,
+			src:      `{"date":"2023-04-01"}`,
+			expected: "04",
+		},
+		{
+			name:     "entire match without groups",
+			exp:      `COERCE .s _regex_["\d+"]`,
+			src:      `{"s":"abc123def"}`,
+			expected: "123",
+		},
+		{
+			name:     "no match",
+			exp:      `COERCE .s _regex_["\d+"]`,
+			src:      `{"s":"abc"}`,
+			expected: nil,
+		},
+		{
+			name:     "optional group not matched",
+			exp:      `COERCE .s _regex_["a(b)?"]`,
+			src:      `{"s":"a"}`,
+			expected: nil,
+		},
+		{
+			name:     "null",
+			exp:      `COERCE .missing _regex_["\d+"]`,
+			src:      `{}`,
+			expected: nil,
+		},
+		{
+			name:     "chained",
+			exp:      `COERCE .version _regex_["^v(\d+)"],_number_ >= 1`,
+			src:      `{"version":"v1.22.3"}`,
+			expected: true,
+		},
+		{
+			name:     "constant",
+			exp:      `COERCE "id-42" _regex_["-(\d+)"]`,
+			expected: "42",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(tc.src))
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestMatchesCompiledOnce(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`.name MATCHES "^a"`))
+	assert.NoError(err)
+	assert.NotNil(ex.(matches).re)
+
+	ex, err = Parse([]byte(`.name MATCHES $pattern`))
+	assert.NoError(err)
+	assert.Nil(ex.(matches).re)
+
+	_, err = Bind(ex, map[string]any{"pattern": "("})
+	assert.Error(err)
+
+	bound, err := Bind(ex, map[string]any{"pattern": "^a"})
+	assert.NoError(err)
+	assert.NotNil(bound.(matches).re)
+	result, err := bound.Calculate([]byte(`{"name":"abc"}`))
+	assert.NoError(err)
+	assert.Equal(true, result)
+}
+
+func TestRegexCache(t *testing.T) {
+	assert := require.New(t)
+
+	cache := newRegexCache(2)
+	a, err := cache.compile("a", false)
+	assert.NoError(err)
+	again, err := cache.compile("a", false)
+	assert.NoError(err)
+	assert.Same(a, again)
+
+	insensitive, err := cache.compile("a", true)
+	assert.NoError(err)
+	assert.NotSame(a, insensitive)
+	assert.True(insensitive.MatchString("A"))
+
+	_, err = cache.compile("(", false)
+	assert.Error(err)
+	assert.Equal(2, cache.order.Len())
+	assert.NotContains(cache.entries, "a")
+
+	for i := 0; i < 10; i++ {
+		_, err = cache.compile(fmt.Sprintf("a%d", i), false)
+		assert.NoError(err)
+	}
+	assert.Equal(2, cache.order.Len())
+	assert.Len(cache.entries, 2)
+}
@@ -0,0 +1,753 @@
+package ksql
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// Resolver resolves the values of selector paths within data, allowing expressions to be calculated against
+// data that isn't JSON without first encoding it, see CalculateValue.
+type Resolver interface {
+	// Resolve returns the value of the gjson selector path within the data and if the path was found. The
+	// value may be any Go value that can be encoded as JSON, which is calculated as if it were.
+	Resolve(path string) (value any, found bool, err error)
+}
+
+// CalculateValue calculates the expression against the supplied data, which may be JSON bytes, a Resolver or
+// any Go value that can be encoded as JSON. Selector paths within Go values eg. a map[string]any, []any or
+// struct are resolved using reflection, honouring `json` struct tags in the same way as encoding/json, rather
+// than encoding the value as JSON. The results are the same as if the value had been encoded as JSON.
+//
+// Expressions containing expressions not implemented by this package, including custom coercions, can only be
+// calculated against JSON, so are calculated against the value encoded as JSON.
+func CalculateValue(e Expression, data any) (any, error) {
+	var r Resolver
+	switch d := data.(type) {
+	case []byte:
+		return e.Calculate(d)
+	case json.RawMessage:
+		return e.Calculate(d)
+	case Resolver:
+		r = d
+	default:
+		r = NewValueResolver(data)
+	}
+
+	bound, ok := bindResolver(e, r)
+	if !ok {
+		if _, isResolver := data.(Resolver); isResolver {
+			return nil, ErrCustom{S: "expression contains expressions which can't be calculated using a Resolver"}
+		}
+		src, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return e.Calculate(src)
+	}
+	return bound.Calculate(nil)
+}
+
+// NewJSONResolver returns a Resolver resolving selector paths within JSON.
+func NewJSONResolver(src []byte) Resolver {
+	return jsonResolver(src)
+}
+
+type jsonResolver []byte
+
+func (r jsonResolver) Resolve(path string) (any, bool, error) {
+	result := gjson.GetBytes(r, path)
+	if !result.Exists() {
+		return nil, false, nil
+	}
+	return json.RawMessage(result.Raw), true, nil
+}
+
+// NewValueResolver returns a Resolver resolving selector paths within any Go value that can be encoded as JSON
+// using reflection. Paths consisting of object keys, array indexes and `#` are resolved directly while any
+// using other gjson features eg. wildcards, queries or modifiers are resolved using the value encoded as JSON.
+func NewValueResolver(data any) Resolver {
+	return &valueResolver{data: data}
+}
+
+type valueResolver struct {
+	data any
+
+	// encoded is the data encoded as JSON, only when a path can't be resolved directly.
+	once    sync.Once
+	encoded []byte
+	err     error
+}
+
+func (r *valueResolver) Resolve(path string) (any, bool, error) {
+	if !isResolvablePath(path) {
+		r.once.Do(func() {
+			r.encoded, r.err = json.Marshal(r.data)
+		})
+		if r.err != nil {
+			return nil, false, r.err
+		}
+		return jsonResolver(r.encoded).Resolve(path)
+	}
+	return resolveValue(reflect.ValueOf(r.data), path)
+}
+
+// isResolvablePath returns if the path consists only of object keys, array indexes and `#`.
+func isResolvablePath(path string) bool {
+	if path == "" {
+		return false
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch {
+		case segment == "#":
+		case segment == "", segment[0] == '@', strings.ContainsAny(segment, `#*?\|!{}[]()`):
+			return false
+		case len(segment) > 1 && segment[0] == '0' && strings.Trim(segment, "0123456789") == "":
+			// a number with a leading zero is treated differently by gjson.
+			return false
+		}
+	}
+	return true
+}
+
+// reflected is a value found using reflection, which may not be able to be returned as an interface.
+type reflected struct {
+	v reflect.Value
+}
+
+// resolveValue returns the value of the path within v.
+func resolveValue(v reflect.Value, path string) (any, bool, error) {
+	v, ok := indirect(v)
+	if !ok {
+		return nil, false, nil
+	}
+	if m, ok := marshaler(v); ok {
+		// the encoded value may have any structure.
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return nil, false, err
+		}
+		return jsonResolver(raw).Resolve(path)
+	}
+	if _, ok := textMarshaler(v); ok {
+		// encoded as a string which has no children.
+		return nil, false, nil
+	}
+
+	segment, rest, more := strings.Cut(path, ".")
+	if segment == "#" {
+		if !isArray(v) || (v.Kind() == reflect.Slice && v.IsNil()) {
+			return nil, false, nil
+		}
+		if !more {
+			return v.Len(), true, nil
+		}
+		// like gjson `#.path` is the value of the path within each element having it.
+		arr := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			value, found, err := resolveValue(v.Index(i), rest)
+			if err != nil {
+				return nil, false, err
+			}
+			if found {
+				arr = append(arr, value)
+			}
+		}
+		return arr, true, nil
+	}
+
+	var child reflect.Value
+	switch {
+	case v.Kind() == reflect.Map:
+		key, ok := mapKey(v.Type().Key(), segment)
+		if !ok {
+			return nil, false, nil
+		}
+		child = v.MapIndex(key)
+
+	case v.Kind() == reflect.Struct:
+		f, found := cachedFields(v.Type())[segment]
+		if !found {
+			return nil, false, nil
+		}
+		if child, ok = fieldByIndex(v, f.index); !ok || (f.omitEmpty && isEmptyValue(child)) {
+			return nil, false, nil
+		}
+		if f.quoted {
+			// encoded as a string which has no children.
+			if more {
+				return nil, false, nil
+			}
+			s, err := quotedValue(child)
+			return s, err == nil, err
+		}
+
+	case isArray(v):
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= v.Len() {
+			return nil, false, nil
+		}
+		child = v.Index(i)
+	}
+
+	if !child.IsValid() {
+		return nil, false, nil
+	}
+	if more {
+		return resolveValue(child, rest)
+	}
+	return reflected{v: child}, true, nil
+}
+
+// indirect returns the value pointed to by any pointers or interfaces, which are not followed if the value
+// is a json.Marshaler or encoding.TextMarshaler, returning false if nil.
+func indirect(v reflect.Value) (reflect.Value, bool) {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return v, false
+		}
+		if _, ok := marshaler(v); ok {
+			return v, true
+		}
+		if _, ok := textMarshaler(v); ok {
+			return v, true
+		}
+		v = v.Elem()
+	}
+	return v, v.IsValid()
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// marshaler returns the value as a json.Marshaler if implemented by it or, if addressable, a pointer to it.
+func marshaler(v reflect.Value) (json.Marshaler, bool) {
+	m, ok := implements(v, marshalerType)
+	if !ok {
+		return nil, false
+	}
+	return m.(json.Marshaler), true
+}
+
+// textMarshaler returns the value as an encoding.TextMarshaler if implemented by it or, if addressable, a
+// pointer to it.
+func textMarshaler(v reflect.Value) (encoding.TextMarshaler, bool) {
+	m, ok := implements(v, textMarshalerType)
+	if !ok {
+		return nil, false
+	}
+	return m.(encoding.TextMarshaler), true
+}
+
+func implements(v reflect.Value, t reflect.Type) (any, bool) {
+	if !v.CanInterface() || v.Kind() == reflect.Interface {
+		return nil, false
+	}
+	if v.Type().Implements(t) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return nil, false
+		}
+		return v.Interface(), true
+	}
+	if v.Kind() != reflect.Pointer && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(t) {
+		return v.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// isArray returns if the value is a slice or array other than a []byte, which is encoded as a string.
+func isArray(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice:
+		return !isBytes(v.Type())
+	case reflect.Array:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 &&
+		!reflect.PtrTo(t.Elem()).Implements(marshalerType) && !reflect.PtrTo(t.Elem()).Implements(textMarshalerType)
+}
+
+// mapKey returns the map key of the type for the object key.
+func mapKey(t reflect.Type, key string) (reflect.Value, bool) {
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(key).Convert(t), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || reflect.Zero(t).OverflowInt(i) {
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(i).Convert(t), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(key, 10, 64)
+		if err != nil || reflect.Zero(t).OverflowUint(u) {
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(u).Convert(t), true
+	default:
+		return reflect.Value{}, false
+	}
+}
+
+// jsonValue returns the value as if it were encoded as JSON and calculated by a selector path, using exact
+// numbers if exact.
+func jsonValue(value any, exact bool) (any, error) {
+	v := reflect.ValueOf(value)
+	if r, ok := value.(reflected); ok {
+		v = r.v
+	}
+	return reflectedJSONValue(v, exact, 0)
+}
+
+// maxValueDepth is the maximum depth of a value, beyond which it is assumed to contain a cycle.
+const maxValueDepth = 1000
+
+var reflectedType = reflect.TypeOf(reflected{})
+
+func reflectedJSONValue(v reflect.Value, exact bool, depth int) (any, error) {
+	if v.Kind() == reflect.Interface && !v.IsNil() && v.Elem().Type() == reflectedType {
+		// the elements of `#.path` found using reflection.
+		v = v.Elem().Interface().(reflected).v
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if depth > maxValueDepth {
+		return nil, &json.UnsupportedValueError{Value: v, Str: "encountered a cycle via " + v.Type().String()}
+	}
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil, nil
+	}
+	if m, ok := marshaler(v); ok {
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		if exact {
+			return exactJSONValue(gjson.ParseBytes(raw)), nil
+		}
+		return gjson.ParseBytes(raw).Value(), nil
+	}
+	if m, ok := textMarshaler(v); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return nil, &json.MarshalerError{Type: v.Type(), Err: err}
+		}
+		return string(text), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return reflectedJSONValue(v.Elem(), exact, depth+1)
+
+	case reflect.Bool:
+		return v.Bool(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if exact {
+			return v.Int(), nil
+		}
+		return float64(v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !exact {
+			return float64(v.Uint()), nil
+		}
+		if u := v.Uint(); u > math.MaxInt64 {
+			return new(big.Int).SetUint64(u), nil
+		}
+		return int64(v.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, &json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, v.Type().Bits())}
+		}
+		// the shortest representation is used, as when encoded, so float32s aren't widened.
+		return jsonNumber(strconv.FormatFloat(f, 'g', -1, v.Type().Bits()), exact)
+
+	case reflect.String:
+		if v.Type() == reflect.TypeOf(json.Number("")) {
+			if v.String() == "" {
+				// encoded as zero.
+				return jsonNumber("0", exact)
+			}
+			return jsonNumber(v.String(), exact)
+		}
+		return v.String(), nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if isBytes(v.Type()) {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		fallthrough
+
+	case reflect.Array:
+		arr := make([]any, v.Len())
+		for i := range arr {
+			value, err := reflectedJSONValue(v.Index(i), exact, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = value
+		}
+		return arr, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		obj := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := mapKeyString(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			value, err := reflectedJSONValue(iter.Value(), exact, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = value
+		}
+		return obj, nil
+
+	case reflect.Struct:
+		fields := cachedFields(v.Type())
+		obj := make(map[string]any, len(fields))
+		for name, f := range fields {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			var value any
+			var err error
+			if f.quoted {
+				value, err = quotedValue(fv)
+			} else {
+				value, err = reflectedJSONValue(fv, exact, depth+1)
+			}
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = value
+		}
+		return obj, nil
+
+	default:
+		return nil, &json.UnsupportedTypeError{Type: v.Type()}
+	}
+}
+
+// jsonNumber returns the number as either an exact number or float64.
+func jsonNumber(s string, exact bool) (any, error) {
+	if exact {
+		if n, ok := parseExactNumber(s); ok {
+			return n, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, ErrCustom{S: "invalid number literal `" + s + "`"}
+	}
+	return f, nil
+}
+
+// mapKeyString returns the map key as the key of a JSON object.
+func mapKeyString(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if m, ok := textMarshaler(k); ok {
+		if k.Kind() == reflect.Pointer && k.IsNil() {
+			return "", nil
+		}
+		text, err := m.MarshalText()
+		if err != nil {
+			return "", &json.MarshalerError{Type: k.Type(), Err: err}
+		}
+		return string(text), nil
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	default:
+		return "", &json.UnsupportedTypeError{Type: k.Type()}
+	}
+}
+
+// quotedValue returns the value of a field with the `string` tag option, which is encoded within a string.
+func quotedValue(v reflect.Value) (string, error) {
+	var primitive any
+	switch v.Kind() {
+	case reflect.String:
+		primitive = v.String()
+	case reflect.Bool:
+		primitive = v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		primitive = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		primitive = v.Uint()
+	case reflect.Float32:
+		primitive = float32(v.Float())
+	default:
+		primitive = v.Float()
+	}
+	b, err := json.Marshal(primitive)
+	return string(b), err
+}
+
+// field is a struct field encoded as JSON.
+type field struct {
+	name      string
+	index     []int
+	tagged    bool
+	omitEmpty bool
+	quoted    bool
+}
+
+var fieldCache sync.Map // map[reflect.Type]map[string]field
+
+// cachedFields returns the fields of the struct encoded as JSON by name.
+func cachedFields(t reflect.Type) map[string]field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(map[string]field)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.(map[string]field)
+}
+
+// typeFields returns the fields of the struct encoded as JSON following the same rules as encoding/json, the
+// fields of embedded structs being promoted unless hidden by a field of the same name at a shallower depth.
+func typeFields(t reflect.Type) map[string]field {
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+
+	var fields []field
+	visited := make(map[reflect.Type]bool)
+	for next := []embedded{{t: t}}; len(next) > 0; {
+		current := next
+		next = nil
+		for _, e := range current {
+			if visited[e.t] {
+				continue
+			}
+			visited[e.t] = true
+
+			for i := 0; i < e.t.NumField(); i++ {
+				sf := e.t.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				index := append(append([]int(nil), e.index...), i)
+
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{t: ft, index: index})
+					continue
+				}
+				f := field{name: name, index: index, tagged: name != ""}
+				if name == "" {
+					f.name = sf.Name
+				}
+				for _, opt := range strings.Split(opts, ",") {
+					switch opt {
+					case "omitempty":
+						f.omitEmpty = true
+					case "string":
+						switch ft.Kind() {
+						case reflect.Bool, reflect.String,
+							reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+							reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+							reflect.Float32, reflect.Float64:
+							f.quoted = sf.Type.Kind() != reflect.Pointer
+						}
+					}
+				}
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	// of the fields with the same name the shallowest is used, preferring a tagged field, while those that
+	// remain ambiguous are omitted.
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+		if len(fields[i].index) != len(fields[j].index) {
+			return len(fields[i].index) < len(fields[j].index)
+		}
+		return fields[i].tagged && !fields[j].tagged
+	})
+	byName := make(map[string]field, len(fields))
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		dominant := fields[i]
+		if j-i == 1 || len(fields[i+1].index) > len(dominant.index) ||
+			(dominant.tagged && !fields[i+1].tagged) {
+			byName[dominant.name] = dominant
+		}
+		i = j
+	}
+	return byName
+}
+
+// fieldByIndex returns the field of the struct, returning false if it is within a nil embedded struct.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue returns if the value is omitted by the `omitempty` tag option.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// bindResolver returns a copy of the expression whose selector paths are resolved using the Resolver,
+// returning false if it contains expressions not implemented by this package, including custom coercions, or
+// nodes that can't be rebuilt with the resolved paths.
+func bindResolver(e Expression, r Resolver) (Expression, bool) {
+	switch n := e.(type) {
+	case coerceCustom:
+		// the coercion's result reads its value from the JSON it is calculated against.
+		return e, false
+	case selectorPath:
+		return resolverPath{path: n, resolver: r}, true
+	case exists:
+		return resolverExists{path: n.path, resolver: r}, true
+	case quantifier:
+		// the predicate is calculated against each element of the array.
+		var ok bool
+		n.array, ok = bindResolver(n.array, r)
+		return n, ok
+	case filterCall:
+		var ok bool
+		n.array, ok = bindResolver(n.array, r)
+		return n, ok
+	case *Compiled:
+		return bindResolver(n.source, r)
+	}
+
+	node, ok := e.(Node)
+	if !ok {
+		return e, false
+	}
+	children := node.Children()
+	if len(children) == 0 {
+		return e, true
+	}
+	bound := make([]Expression, len(children))
+	for i, child := range children {
+		if child == nil {
+			continue
+		}
+		if bound[i], ok = bindResolver(child, r); !ok {
+			return e, false
+		}
+	}
+	rebound, err := node.withChildren(bound)
+	if err != nil {
+		return e, false
+	}
+	return rebound, true
+}
+
+var _ pathLookup = (*resolverPath)(nil)
+
+// resolverPath is a selector path resolved using a Resolver.
+type resolverPath struct {
+	path     selectorPath
+	resolver Resolver
+}
+
+func (p resolverPath) Calculate(_ []byte) (any, error) {
+	value, _, err := p.lookup(nil)
+	return value, err
+}
+
+func (p resolverPath) lookup(_ []byte) (any, bool, error) {
+	value, found, err := p.resolver.Resolve(p.path.s)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	value, err = jsonValue(value, p.path.exact)
+	return value, true, err
+}
+
+var _ Expression = (*resolverExists)(nil)
+
+// resolverExists is `EXISTS .path` resolved using a Resolver.
+type resolverExists struct {
+	path     string
+	resolver Resolver
+}
+
+func (e resolverExists) Calculate(_ []byte) (any, error) {
+	_, found, err := e.resolver.Resolve(e.path)
+	return found, err
+}
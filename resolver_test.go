@@ -0,0 +1,261 @@
+package ksql
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type resolverAddress struct {
+	City    string   `json:"city"`
+	Zip     string   `json:"zip,omitempty"`
+	Geo     *float64 `json:"geo"`
+	private string
+}
+
+type resolverBase struct {
+	ID      uint64 `json:"id"`
+	Created time.Time
+	Shadow  string `json:"shadow"`
+}
+
+type resolverUser struct {
+	resolverBase
+	*resolverAddress `json:"address"`
+
+	Name    string            `json:"name"`
+	Age     int               `json:"age,string"`
+	Score   float32           `json:"score"`
+	Admin   bool              `json:"admin,omitempty"`
+	Tags    []string          `json:"tags"`
+	Nil     []int             `json:"nil"`
+	Raw     []byte            `json:"raw"`
+	Counts  map[int]float64   `json:"counts"`
+	Extra   map[string]any    `json:"extra"`
+	Number  json.Number       `json:"number"`
+	Ignored string            `json:"-"`
+	Items   []resolverItem    `json:"items"`
+	Shadow  string            `json:"-,"`
+	Labels  map[string]string `json:",omitempty"`
+}
+
+type resolverItem struct {
+	SKU   string  `json:"sku"`
+	Price float64 `json:"price"`
+	Qty   *int    `json:"qty,omitempty"`
+}
+
+func TestCalculateValueMatchesJSON(t *testing.T) {
+	assert := require.New(t)
+
+	geo := -36.8
+	qty := 3
+	values := []any{
+		resolverUser{
+			resolverBase:    resolverBase{ID: math.MaxUint64, Created: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC), Shadow: "base"},
+			resolverAddress: &resolverAddress{City: "Auckland", Geo: &geo, private: "x"},
+			Name:            "joey",
+			Age:             30,
+			Score:           0.1,
+			Tags:            []string{"a", "b"},
+			Raw:             []byte("hello"),
+			Counts:          map[int]float64{1: 0.5, 20: 2},
+			Extra:           map[string]any{"nested": []any{map[string]any{"k": 1.5}}, "nil": nil},
+			Number:          "9007199254740993",
+			Ignored:         "ignored",
+			Items:           []resolverItem{{SKU: "a", Price: 2.5, Qty: &qty}, {SKU: "b", Price: 0.1}},
+			Shadow:          "dash",
+		},
+		&resolverUser{Name: "empty"},
+		map[string]any{
+			"name":  "joey",
+			"age":   30,
+			"tags":  []any{"a", 1, true, nil},
+			"items": []map[string]any{{"sku": "a", "price": 2.5}, {"sku": "b"}},
+			"nil":   nil,
+			"id":    int64(math.MaxInt64),
+		},
+		[]any{map[string]any{"name": "first"}, 2, "three"},
+		"joey",
+		nil,
+	}
+
+	expressions := []string{
+		`.name`,
+		`.name + " " + .city`,
+		`.age`,
+		`.age == "30"`,
+		`.score`,
+		`.score == 0.1`,
+		`.admin`,
+		`.admin IS MISSING`,
+		`.tags`,
+		`.tags.1`,
+		`.tags.5`,
+		`.tags.#`,
+		`.tags.# > 1`,
+		`.nil IS NULL`,
+		`.nil IS MISSING`,
+		`.raw`,
+		`.counts`,
+		`.counts.20`,
+		`.extra.nested.0.k * 2`,
+		`.extra.nil IS NULL`,
+		`.number`,
+		`.number == 9007199254740993`,
+		`.Ignored`,
+		`.id`,
+		`.Created`,
+		`COERCE .Created _datetime_ < COERCE "2023-01-01" _datetime_`,
+		`.shadow`,
+		`.-`,
+		`.Labels`,
+		`.address`,
+		`.city`,
+		`.zip`,
+		`EXISTS .zip`,
+		`EXISTS .geo`,
+		`.geo`,
+		`.private`,
+		`.items.0.qty`,
+		`.items.1.qty IS MISSING`,
+		`.items.#.sku`,
+		`.items.#.qty`,
+		`sum(.items.#.price)`,
+		`ANY .items (.price > 1)`,
+		`filter(.items, .sku == "b")`,
+		`.items.*`,
+		`.tags.@reverse`,
+		`.0.name`,
+		`.1`,
+		`.@this`,
+		`len(.name) > 3 && .name STARTSWITH "j"`,
+	}
+
+	for _, exactNumbers := range []bool{false, true} {
+		for _, exp := range expressions {
+			ex, err := ParseWithOptions([]byte(exp), ParseOptions{ExactNumbers: exactNumbers})
+			assert.NoError(err, exp)
+
+			for _, value := range values {
+				src, err := json.Marshal(value)
+				assert.NoError(err)
+
+				expected, expectedErr := ex.Calculate(src)
+				result, err := CalculateValue(ex, value)
+				assert.Equal(expectedErr, err, "exp: %s value: %s exact: %t", exp, src, exactNumbers)
+				assert.Equal(expected, result, "exp: %s value: %s exact: %t", exp, src, exactNumbers)
+
+				result, err = CalculateValue(ex, NewJSONResolver(src))
+				assert.Equal(expectedErr, err, "exp: %s value: %s exact: %t", exp, src, exactNumbers)
+				assert.Equal(expected, result, "exp: %s value: %s exact: %t", exp, src, exactNumbers)
+			}
+		}
+	}
+}
+
+type resolverFunc func(path string) (any, bool, error)
+
+func (f resolverFunc) Resolve(path string) (any, bool, error) {
+	return f(path)
+}
+
+func TestCalculateValue(t *testing.T) {
+	assert := require.New(t)
+
+	paths := map[string]any{"a": 1, "b": "x", "c": nil, "t": []int{1, 2}}
+	resolver := resolverFunc(func(path string) (any, bool, error) {
+		if path == "err" {
+			return nil, false, ErrCustom{S: "resolver failed"}
+		}
+		value, found := paths[path]
+		return value, found, nil
+	})
+
+	tests := []struct {
+		name     string
+		exp      string
+		data     any
+		expected any
+		err      error
+	}{
+		{name: "raw json", exp: `.a + 1`, data: []byte(`{"a":1}`), expected: 2.0},
+		{name: "raw message", exp: `.a + 1`, data: json.RawMessage(`{"a":1}`), expected: 2.0},
+		{name: "resolver", exp: `.a + 1 == 2 && .b == "x"`, data: resolver, expected: true},
+		{name: "resolver null", exp: `.c IS NULL && .missing IS MISSING && EXISTS .c`, data: resolver, expected: true},
+		{name: "resolver array", exp: `.t CONTAINS 2`, data: resolver, expected: true},
+		{name: "resolver error", exp: `.a == 1 && .err == 1`, data: resolver, err: ErrCustom{S: "resolver failed"}},
+		{name: "compiled", exp: `.a * 2`, data: map[string]int{"a": 2}, expected: 4.0},
+		{
+			name: "unsupported type",
+			exp:  `.f`,
+			data: map[string]any{"f": func() {}},
+			err:  &json.UnsupportedTypeError{Type: reflect.TypeOf(func() {})},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+			if tc.name == "compiled" {
+				ex = Compile(ex)
+			}
+
+			result, err := CalculateValue(ex, tc.data)
+			if tc.err != nil {
+				assert.Equal(tc.err, err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+type opaqueExpression struct{}
+
+func (opaqueExpression) Calculate(src []byte) (any, error) {
+	return NewSelectorPath("a").Calculate(src)
+}
+
+func TestCalculateValueOpaqueExpression(t *testing.T) {
+	assert := require.New(t)
+
+	result, err := CalculateValue(opaqueExpression{}, map[string]any{"a": "x"})
+	assert.NoError(err)
+	assert.Equal("x", result)
+
+	_, err = CalculateValue(opaqueExpression{}, NewJSONResolver([]byte(`{"a":"x"}`)))
+	assert.Error(err)
+}
+
+func TestCalculateValueCustomCoercion(t *testing.T) {
+	assert := require.New(t)
+
+	env := customCoercionEnvironment()
+	data := map[string]any{"name": "joey"}
+
+	ex, err := ParseWith(env, []byte(`COERCE .name _rep_[2] == "joeyjoey"`))
+	assert.NoError(err)
+	result, err := CalculateValue(ex, data)
+	assert.NoError(err)
+	assert.Equal(true, result)
+
+	// custom coercions read their value from JSON so are calculated against the value encoded as JSON.
+	ex, err = ParseWith(env, []byte(`COERCE .name _pathstar_`))
+	assert.NoError(err)
+	result, err = CalculateValue(ex, data)
+	assert.NoError(err)
+	assert.Equal("****", result)
+
+	_, err = CalculateValue(ex, NewValueResolver(data))
+	assert.Error(err)
+}
@@ -0,0 +1,341 @@
+package ksql
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// RuleResult is the result of calculating a single rule of a RuleSet.
+type RuleResult struct {
+	Value any
+	Err   error
+}
+
+// RuleSet calculates many expressions against the same data, resolving the selector paths of every rule
+// together rather than each path searching the data independently. The paths are resolved in a single pass
+// over the data, only descending into the objects and arrays containing them, with any path using gjson
+// features such as wildcards, queries or modifiers resolved individually.
+//
+// A RuleSet is safe for concurrent use.
+type RuleSet struct {
+	rules []Expression
+	paths []string
+
+	// indexes are the index of each path within paths and the results of resolving them.
+	indexes map[string]int
+
+	// root is the root of the tree of simple paths resolved together, while complex are the indexes of
+	// the paths resolved individually.
+	root    *pathNode
+	complex []int
+
+	frames sync.Pool
+}
+
+// NewRuleSet returns a RuleSet calculating the supplied rules, whose results are returned in the same order.
+func NewRuleSet(rules ...Expression) *RuleSet {
+	rs := &RuleSet{
+		rules:   rules,
+		indexes: make(map[string]int),
+		root:    &pathNode{index: -1},
+	}
+	for _, rule := range rules {
+		rs.collect(rule)
+	}
+	for i, path := range rs.paths {
+		if !rs.root.add(path, i) {
+			rs.complex = append(rs.complex, i)
+		}
+	}
+	rs.frames.New = func() any {
+		return rs.newFrame()
+	}
+	return rs
+}
+
+// Paths returns the unique selector paths resolved when calculating the rules.
+func (rs *RuleSet) Paths() []string {
+	return rs.paths
+}
+
+// Calculate calculates every rule against the supplied data, returning the result of each rule in the order
+// they were supplied. An error calculating one rule does not prevent the others from being calculated.
+func (rs *RuleSet) Calculate(src []byte) []RuleResult {
+	f := rs.frames.Get().(*ruleFrame)
+	defer rs.release(f)
+
+	rs.resolve(src, f.results)
+
+	results := make([]RuleResult, len(f.rules))
+	for i, rule := range f.rules {
+		results[i].Value, results[i].Err = rule.Calculate(src)
+	}
+	return results
+}
+
+func (rs *RuleSet) release(f *ruleFrame) {
+	for i := range f.results {
+		f.results[i] = gjson.Result{}
+	}
+	rs.frames.Put(f)
+}
+
+// resolve sets the result of each path within the data.
+func (rs *RuleSet) resolve(src []byte, results []gjson.Result) {
+	rs.root.resolve(gjson.ParseBytes(src), results)
+	for _, i := range rs.complex {
+		results[i] = gjson.GetBytes(src, rs.paths[i])
+	}
+}
+
+// collect adds the selector paths of the expression evaluated against the data, which excludes those within
+// the predicates of quantifiers and filter as they are evaluated against each element of an array.
+func (rs *RuleSet) collect(e Expression) {
+	switch n := e.(type) {
+	case selectorPath:
+		rs.addPath(n.s)
+		return
+	case exists:
+		rs.addPath(n.path)
+		return
+	case quantifier:
+		rs.collect(n.array)
+		return
+	case filterCall:
+		rs.collect(n.array)
+		return
+	}
+	for _, child := range ChildrenOf(e) {
+		if child != nil {
+			rs.collect(child)
+		}
+	}
+}
+
+func (rs *RuleSet) addPath(path string) {
+	if _, found := rs.indexes[path]; !found {
+		rs.indexes[path] = len(rs.paths)
+		rs.paths = append(rs.paths, path)
+	}
+}
+
+// ruleFrame holds the results of resolving the paths for a single calculation along with a copy of the rules
+// whose selector paths return those results.
+type ruleFrame struct {
+	results []gjson.Result
+	rules   []Expression
+}
+
+func (rs *RuleSet) newFrame() *ruleFrame {
+	f := &ruleFrame{
+		results: make([]gjson.Result, len(rs.paths)),
+		rules:   make([]Expression, len(rs.rules)),
+	}
+	for i, rule := range rs.rules {
+		f.rules[i] = rs.bind(f, rule)
+	}
+	return f
+}
+
+// bind returns a copy of the expression whose selector paths return the results resolved into the frame.
+func (rs *RuleSet) bind(f *ruleFrame, e Expression) Expression {
+	switch n := e.(type) {
+	case selectorPath:
+		return resolvedPath{path: n, frame: f, index: rs.indexes[n.s]}
+	case exists:
+		return resolvedExists{frame: f, index: rs.indexes[n.path]}
+	case quantifier:
+		n.array = rs.bind(f, n.array)
+		return n
+	case filterCall:
+		n.array = rs.bind(f, n.array)
+		return n
+	}
+
+	node, ok := e.(Node)
+	if !ok {
+		return e
+	}
+	children := node.Children()
+	if len(children) == 0 {
+		return e
+	}
+	bound := make([]Expression, len(children))
+	for i, child := range children {
+		if child != nil {
+			bound[i] = rs.bind(f, child)
+		}
+	}
+	rebound, err := node.withChildren(bound)
+	if err != nil {
+		// a node that can't be rebuilt is calculated as it was parsed, its selector paths looked up within the
+		// data rather than the frame.
+		return e
+	}
+	return rebound
+}
+
+var _ pathResult = (*resolvedPath)(nil)
+
+// resolvedPath is a selector path of a RuleSet rule returning the result already resolved into a frame.
+type resolvedPath struct {
+	path  selectorPath
+	frame *ruleFrame
+	index int
+}
+
+func (p resolvedPath) Calculate(_ []byte) (any, error) {
+	return p.path.value(p.frame.results[p.index]), nil
+}
+
+func (p resolvedPath) result(_ []byte) gjson.Result {
+	return p.frame.results[p.index]
+}
+
+func (p resolvedPath) value(result gjson.Result) any {
+	return p.path.value(result)
+}
+
+func (p resolvedPath) lookup(_ []byte) (any, bool, error) {
+	result := p.frame.results[p.index]
+	return p.path.value(result), result.Exists(), nil
+}
+
+var _ Expression = (*resolvedExists)(nil)
+
+// resolvedExists is `EXISTS .path` of a RuleSet rule using the result already resolved into a frame.
+type resolvedExists struct {
+	frame *ruleFrame
+	index int
+}
+
+func (e resolvedExists) Calculate(_ []byte) (any, error) {
+	return e.frame.results[e.index].Exists(), nil
+}
+
+// pathNode is a node in the tree of simple paths, those consisting only of object keys and array indexes,
+// which are resolved together in a single pass over the data.
+type pathNode struct {
+	// index is the index of the path ending at this node, or -1 if none does.
+	index int
+
+	// children are the position of each child within nodes by key.
+	children map[string]int
+	nodes    []*pathNode
+}
+
+// add adds the path to the tree, returning false if it is not a simple path.
+func (n *pathNode) add(path string, index int) bool {
+	if !isSimplePath(path) {
+		return false
+	}
+	for start := 0; ; {
+		end := start
+		for end < len(path) && path[end] != '.' {
+			end++
+		}
+		key := path[start:end]
+		i, found := n.children[key]
+		if !found {
+			if n.children == nil {
+				n.children = make(map[string]int)
+			}
+			i = len(n.nodes)
+			n.children[key] = i
+			n.nodes = append(n.nodes, &pathNode{index: -1})
+		}
+		n = n.nodes[i]
+		if end == len(path) {
+			break
+		}
+		start = end + 1
+	}
+	n.index = index
+	return true
+}
+
+// resolve sets the results of the paths within the value, iterating over objects and arrays only until every
+// key of the node has been found.
+func (n *pathNode) resolve(value gjson.Result, results []gjson.Result) {
+	if n.index >= 0 {
+		results[n.index] = value
+	}
+	if len(n.children) == 0 || (!value.IsObject() && !value.IsArray()) {
+		return
+	}
+
+	isArray := value.IsArray()
+	remaining := len(n.nodes)
+	seen := newBitset(len(n.nodes))
+	value.ForEach(func(key, v gjson.Result) bool {
+		k := key.Str
+		if isArray {
+			k = strconv.Itoa(int(key.Num))
+		}
+		i, ok := n.children[k]
+		if !ok || seen.has(i) {
+			// like gjson only the first of any duplicate keys is used.
+			return true
+		}
+		seen.set(i)
+		n.nodes[i].resolve(v, results)
+		remaining--
+		return remaining > 0
+	})
+}
+
+// bitset is a set of small integers, only allocating when holding more than 64.
+type bitset struct {
+	small uint64
+	large []bool
+}
+
+func newBitset(n int) bitset {
+	if n > 64 {
+		return bitset{large: make([]bool, n)}
+	}
+	return bitset{}
+}
+
+func (b *bitset) has(i int) bool {
+	if b.large != nil {
+		return b.large[i]
+	}
+	return b.small&(1<<uint(i)) != 0
+}
+
+func (b *bitset) set(i int) {
+	if b.large != nil {
+		b.large[i] = true
+		return
+	}
+	b.small |= 1 << uint(i)
+}
+
+// isSimplePath returns if the path consists only of object keys and array indexes without any characters
+// having special meaning to gjson.
+func isSimplePath(path string) bool {
+	if path == "" {
+		return false
+	}
+	start := 0
+	for i := 0; i <= len(path); i++ {
+		if i == len(path) || path[i] == '.' {
+			segment := path[start:i]
+			// an empty segment or number with a leading zero is treated differently by gjson.
+			if segment == "" || (len(segment) > 1 && segment[0] == '0') {
+				return false
+			}
+			start = i + 1
+			continue
+		}
+		switch c := path[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
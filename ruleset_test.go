@@ -0,0 +1,155 @@
+package ksql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var ruleSetExpressions = []string{
+	`.name == "joey"`,
+	`.age >= 18 && .country IN ["NZ", "AU"]`,
+	`.address.city + ", " + .address.country`,
+	`.address.geo.lat > 0`,
+	`.items.0.sku`,
+	`.items.1.qty * .items.1.price`,
+	`.items.#`,
+	`.items.#.sku`,
+	`.address.g*.lat`,
+	`.tags.@reverse`,
+	`.name\.first`,
+	`.01`,
+	`.dup`,
+	`EXISTS .address.geo && !EXISTS .address.zip`,
+	`.nil IS NULL && .missing IS MISSING && .name IS NOT NULL`,
+	`ANY .items (.qty > 1)`,
+	`ALL .tags (.@this != .name)`,
+	`filter(.items, .price > 5)`,
+	`count(.tags) + len(.name)`,
+	`COERCE .joined _datetime_ > COERCE "2020-01-01" _datetime_`,
+	`IF .vip THEN .address.geo.lat ELSE .address.geo.lng`,
+	`{"who": .name, "where": .address.city}`,
+	`.name / 2`,
+	`.age + .address.geo.lat + .items.0.qty`,
+}
+
+var ruleSetDocs = []string{
+	`{"name":"joey","name.first":"j","age":30,"country":"NZ","vip":true,"nil":null,"dup":1,"dup":2,"joined":"2021-06-01",
+"address":{"city":"Auckland","country":"NZ","geo":{"lat":-36.8,"lng":174.7}},
+"items":[{"sku":"a","qty":1,"price":2.5},{"sku":"b","qty":3,"price":10}],"tags":["x","y"]}`,
+	`{"name":null,"age":"30","address":[],"items":{"0":{"sku":"o"}},"tags":"x","01":"zero one"}`,
+	`[{"name":"joey"}]`,
+	`"joey"`,
+	`{}`,
+	``,
+}
+
+func TestRuleSetMatchesRules(t *testing.T) {
+	assert := require.New(t)
+
+	for _, exactNumbers := range []bool{false, true} {
+		rules := make([]Expression, len(ruleSetExpressions))
+		for i, exp := range ruleSetExpressions {
+			ex, err := ParseWithOptions([]byte(exp), ParseOptions{ExactNumbers: exactNumbers})
+			assert.NoError(err, exp)
+			rules[i] = ex
+		}
+		rs := NewRuleSet(rules...)
+
+		for _, doc := range ruleSetDocs {
+			results := rs.Calculate([]byte(doc))
+			assert.Len(results, len(rules))
+
+			for i, rule := range rules {
+				expected, err := rule.Calculate([]byte(doc))
+				assert.Equal(err, results[i].Err, "exp: %s doc: %s", ruleSetExpressions[i], doc)
+				assert.Equal(expected, results[i].Value, "exp: %s doc: %s", ruleSetExpressions[i], doc)
+			}
+		}
+	}
+}
+
+func TestRuleSetPaths(t *testing.T) {
+	assert := require.New(t)
+
+	var rules []Expression
+	for _, exp := range []string{
+		`.a.b == 1 && .c > 2`,
+		`EXISTS .a.b || ANY .items (.qty > 1)`,
+		`filter(.items.#.tags, .@this == .c)`,
+	} {
+		ex, err := Parse([]byte(exp))
+		assert.NoError(err)
+		rules = append(rules, ex)
+	}
+
+	rs := NewRuleSet(rules...)
+	assert.Equal([]string{"a.b", "c", "items", "items.#.tags"}, rs.Paths())
+
+	results := rs.Calculate([]byte(`{"a":{"b":1},"c":3,"items":[{"qty":2,"tags":["x"]}]}`))
+	assert.Equal([]RuleResult{{Value: true}, {Value: true}, {Value: []any{}}}, results)
+}
+
+func TestRuleSetConcurrent(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`.a.b + .c`))
+	assert.NoError(err)
+	rs := NewRuleSet(ex)
+
+	tests := []struct {
+		src      string
+		expected any
+	}{
+		{src: `{"a":{"b":1},"c":2}`, expected: 3.0},
+		{src: `{"a":{"b":10},"c":20}`, expected: 30.0},
+		{src: `{"c":5}`, expected: 5.0},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.src, func(t *testing.T) {
+			t.Parallel()
+
+			for i := 0; i < 100; i++ {
+				results := rs.Calculate([]byte(tc.src))
+				assert.NoError(results[0].Err)
+				assert.Equal(tc.expected, results[0].Value)
+			}
+		})
+	}
+}
+
+// customCoercionEnvironment returns an Environment with `_rep_[n]`, which reads an argument, and `_pathstar_`,
+// which rejects any value other than a selector path so can't be rebuilt with a path bound to other data.
+func customCoercionEnvironment() *Environment {
+	env := repEnvironment()
+	env.SetCoercion("_pathstar_", func(_ *Parser, constEligible bool, expression Expression) (stillConstEligible bool, e Expression, err error) {
+		if _, ok := expression.(Selector); !ok {
+			return false, nil, errors.New("_pathstar_ requires a selector path")
+		}
+		return false, &Star{expression}, nil
+	})
+	return env
+}
+
+func TestRuleSetCustomCoercion(t *testing.T) {
+	assert := require.New(t)
+
+	env := customCoercionEnvironment()
+	var rules []Expression
+	for _, exp := range []string{
+		`COERCE .name _rep_[2] == "joeyjoey"`,
+		`COERCE .name _pathstar_ + .age`,
+		`.name STARTSWITH "jo"`,
+	} {
+		ex, err := ParseWith(env, []byte(exp))
+		assert.NoError(err)
+		rules = append(rules, ex)
+	}
+
+	rs := NewRuleSet(rules...)
+	results := rs.Calculate([]byte(`{"name":"joey","age":"!"}`))
+	assert.Equal([]RuleResult{{Value: true}, {Value: "****!"}, {Value: true}}, results)
+}
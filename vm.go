@@ -0,0 +1,432 @@
+package ksql
+
+import (
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+var _ Expression = (*Compiled)(nil)
+
+// Compiled is an expression compiled into a flat sequence of instructions, evaluated using a stack of typed
+// values so that numbers, booleans and strings are not boxed into an `any` between operations. It calculates
+// the same results and errors as the expression it was compiled from, which remains the reference
+// implementation, see Compile.
+//
+// A Compiled expression is safe for concurrent use.
+type Compiled struct {
+	// source is the expression compiled.
+	source Expression
+
+	instructions []instruction
+	consts       []value
+	paths        []string
+
+	// fallbacks are the sub-expressions without instructions of their own, which are calculated by the
+	// expression itself eg. function calls and COERCE.
+	fallbacks []Expression
+
+	maxStack int
+	stacks   sync.Pool
+}
+
+// Compile compiles the expression into instructions for faster evaluation. Operations on numbers, strings and
+// booleans along with `&&`, `||`, IF and CASE are compiled, while any other sub-expression is calculated by
+// the expression itself when reached.
+func Compile(e Expression) *Compiled {
+	c := &Compiled{source: e}
+	var depth int
+	c.compile(e, &depth)
+	c.stacks.New = func() any {
+		stack := make([]value, 0, c.maxStack)
+		return &stack
+	}
+	return c
+}
+
+type opcode uint8
+
+const (
+	// opConst pushes the constant at the index.
+	opConst opcode = iota
+	// opPath pushes the value of the selector path at the index.
+	opPath
+	// opEval pushes the result of calculating the fallback expression at the index.
+	opEval
+	opAdd
+	opSub
+	opMultiply
+	opDivide
+	opEquals
+	opGt
+	opGte
+	opLt
+	opLte
+	opNot
+	opAnd
+	opOr
+	// opJumpUnlessTrue short circuits `&&`, replacing the left value with false and jumping when it isn't true.
+	opJumpUnlessTrue
+	// opJumpIfTrue short circuits `||`, jumping when the left value is true.
+	opJumpIfTrue
+	// opPopJumpUnlessTrue pops the condition of an IF or CASE, jumping to the next condition unless true.
+	opPopJumpUnlessTrue
+	// opJump jumps unconditionally.
+	opJump
+)
+
+type instruction struct {
+	op  opcode
+	arg int32
+}
+
+type valueKind uint8
+
+const (
+	kindNull valueKind = iota
+	kindBool
+	kindNumber
+	kindString
+	// kindOther holds any other value eg. arrays, DateTimes and exact numbers.
+	kindOther
+)
+
+// value is a typed value on the stack.
+type value struct {
+	kind  valueKind
+	b     bool
+	n     float64
+	s     string
+	other any
+}
+
+func valueOf(v any) value {
+	switch t := v.(type) {
+	case nil:
+		return value{}
+	case bool:
+		return value{kind: kindBool, b: t}
+	case float64:
+		return value{kind: kindNumber, n: t}
+	case string:
+		return value{kind: kindString, s: t}
+	default:
+		return value{kind: kindOther, other: v}
+	}
+}
+
+func (v value) any() any {
+	switch v.kind {
+	case kindBool:
+		return v.b
+	case kindNumber:
+		return v.n
+	case kindString:
+		return v.s
+	case kindOther:
+		return v.other
+	default:
+		return nil
+	}
+}
+
+// isScalar returns if the value is NULL, a bool, float64 number or string.
+func (v value) isScalar() bool {
+	return v.kind != kindOther
+}
+
+// compile appends the instructions calculating the expression, tracking the depth of the stack.
+func (c *Compiled) compile(e Expression, depth *int) {
+	switch n := e.(type) {
+	case selectorPath:
+		if !n.exact {
+			c.emitPush(opPath, len(c.paths), depth)
+			c.paths = append(c.paths, n.s)
+			return
+		}
+	case Literal:
+		c.emitPush(opConst, len(c.consts), depth)
+		c.consts = append(c.consts, valueOf(n.Value()))
+		return
+	case add:
+		c.compileBinary(opAdd, n.left, n.right, depth)
+		return
+	case sub:
+		c.compileBinary(opSub, n.left, n.right, depth)
+		return
+	case multi:
+		c.compileBinary(opMultiply, n.left, n.right, depth)
+		return
+	case div:
+		c.compileBinary(opDivide, n.left, n.right, depth)
+		return
+	case eq:
+		c.compileBinary(opEquals, n.left, n.right, depth)
+		return
+	case gt:
+		c.compileBinary(opGt, n.left, n.right, depth)
+		return
+	case gte:
+		c.compileBinary(opGte, n.left, n.right, depth)
+		return
+	case lt:
+		c.compileBinary(opLt, n.left, n.right, depth)
+		return
+	case lte:
+		c.compileBinary(opLte, n.left, n.right, depth)
+		return
+	case not:
+		c.compile(n.value, depth)
+		c.emit(opNot, 0)
+		return
+	case and:
+		c.compile(n.left, depth)
+		jump := c.emit(opJumpUnlessTrue, 0)
+		c.compileBinaryRight(opAnd, n.right, depth)
+		c.patch(jump)
+		return
+	case or:
+		c.compile(n.left, depth)
+		jump := c.emit(opJumpIfTrue, 0)
+		c.compileBinaryRight(opOr, n.right, depth)
+		c.patch(jump)
+		return
+	case conditional:
+		var ends []int
+		for i := 0; i < len(n.whens); i += 2 {
+			c.compile(n.whens[i], depth)
+			*depth--
+			next := c.emit(opPopJumpUnlessTrue, 0)
+			c.compile(n.whens[i+1], depth)
+			*depth--
+			ends = append(ends, c.emit(opJump, 0))
+			c.patch(next)
+		}
+		if n.otherwise == nil {
+			c.compile(null{}, depth)
+		} else {
+			c.compile(n.otherwise, depth)
+		}
+		for _, end := range ends {
+			c.patch(end)
+		}
+		return
+	}
+	c.emitPush(opEval, len(c.fallbacks), depth)
+	c.fallbacks = append(c.fallbacks, e)
+}
+
+func (c *Compiled) compileBinary(op opcode, left, right Expression, depth *int) {
+	c.compile(left, depth)
+	c.compileBinaryRight(op, right, depth)
+}
+
+// compileBinaryRight compiles the right operand of a binary operation whose left operand is on the stack.
+func (c *Compiled) compileBinaryRight(op opcode, right Expression, depth *int) {
+	c.compile(right, depth)
+	c.emit(op, 0)
+	*depth--
+}
+
+func (c *Compiled) emit(op opcode, arg int) int {
+	c.instructions = append(c.instructions, instruction{op: op, arg: int32(arg)})
+	return len(c.instructions) - 1
+}
+
+func (c *Compiled) emitPush(op opcode, arg int, depth *int) {
+	c.emit(op, arg)
+	*depth++
+	if *depth > c.maxStack {
+		c.maxStack = *depth
+	}
+}
+
+// patch sets the target of the jump instruction to the next instruction.
+func (c *Compiled) patch(jump int) {
+	c.instructions[jump].arg = int32(len(c.instructions))
+}
+
+// Calculate executes the instructions against the supplied data.
+func (c *Compiled) Calculate(src []byte) (any, error) {
+	sp := c.stacks.Get().(*[]value)
+	result, err := c.run(src, (*sp)[:0])
+	stack := (*sp)[:c.maxStack]
+	for i := range stack {
+		stack[i] = value{} // release any values referenced before pooling
+	}
+	c.stacks.Put(sp)
+	if err != nil {
+		return nil, err
+	}
+	return result.any(), nil
+}
+
+func (c *Compiled) run(src []byte, stack []value) (value, error) {
+	for pc := 0; pc < len(c.instructions); pc++ {
+		in := c.instructions[pc]
+		switch in.op {
+		case opConst:
+			stack = append(stack, c.consts[in.arg])
+
+		case opPath:
+			stack = append(stack, resultValue(gjson.GetBytes(src, c.paths[in.arg])))
+
+		case opEval:
+			result, err := c.fallbacks[in.arg].Calculate(src)
+			if err != nil {
+				return value{}, err
+			}
+			stack = append(stack, valueOf(result))
+
+		case opNot:
+			top := &stack[len(stack)-1]
+			if top.kind == kindBool {
+				top.b = !top.b
+				continue
+			}
+			result, err := notValue(top.any())
+			if err != nil {
+				return value{}, err
+			}
+			*top = valueOf(result)
+
+		case opJumpUnlessTrue:
+			if top := &stack[len(stack)-1]; top.kind != kindBool || !top.b {
+				*top = value{kind: kindBool, b: false}
+				pc = int(in.arg) - 1
+			}
+
+		case opJumpIfTrue:
+			if top := stack[len(stack)-1]; top.kind == kindBool && top.b {
+				pc = int(in.arg) - 1
+			}
+
+		case opPopJumpUnlessTrue:
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if top.kind != kindBool || !top.b {
+				pc = int(in.arg) - 1
+			}
+
+		case opJump:
+			pc = int(in.arg) - 1
+
+		default:
+			left, right := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			result, err := binary(in.op, left, right)
+			if err != nil {
+				return value{}, err
+			}
+			stack[len(stack)-1] = result
+		}
+	}
+	return stack[0], nil
+}
+
+// resultValue returns the value of a gjson result, the same as `Result.Value`.
+func resultValue(r gjson.Result) value {
+	switch r.Type {
+	case gjson.Null:
+		return value{}
+	case gjson.False:
+		return value{kind: kindBool, b: false}
+	case gjson.True:
+		return value{kind: kindBool, b: true}
+	case gjson.Number:
+		return value{kind: kindNumber, n: r.Num}
+	case gjson.String:
+		return value{kind: kindString, s: r.Str}
+	default:
+		return valueOf(r.Value())
+	}
+}
+
+// binary applies the binary operation to the values, using the same functions as the expressions they were
+// compiled from when not both numbers, strings or booleans.
+func binary(op opcode, left, right value) (value, error) {
+	if left.kind == right.kind {
+		switch left.kind {
+		case kindNumber:
+			switch op {
+			case opAdd:
+				return value{kind: kindNumber, n: left.n + right.n}, nil
+			case opSub:
+				return value{kind: kindNumber, n: left.n - right.n}, nil
+			case opMultiply:
+				return value{kind: kindNumber, n: left.n * right.n}, nil
+			case opDivide:
+				return value{kind: kindNumber, n: left.n / right.n}, nil
+			case opEquals:
+				return value{kind: kindBool, b: left.n == right.n}, nil
+			case opGt:
+				return value{kind: kindBool, b: left.n > right.n}, nil
+			case opGte:
+				return value{kind: kindBool, b: left.n >= right.n}, nil
+			case opLt:
+				return value{kind: kindBool, b: left.n < right.n}, nil
+			case opLte:
+				return value{kind: kindBool, b: left.n <= right.n}, nil
+			}
+		case kindString:
+			switch op {
+			case opAdd:
+				return value{kind: kindString, s: left.s + right.s}, nil
+			case opEquals:
+				return value{kind: kindBool, b: left.s == right.s}, nil
+			case opGt:
+				return value{kind: kindBool, b: left.s > right.s}, nil
+			case opGte:
+				return value{kind: kindBool, b: left.s >= right.s}, nil
+			case opLt:
+				return value{kind: kindBool, b: left.s < right.s}, nil
+			case opLte:
+				return value{kind: kindBool, b: left.s <= right.s}, nil
+			}
+		case kindBool:
+			switch op {
+			case opEquals:
+				return value{kind: kindBool, b: left.b == right.b}, nil
+			case opAnd:
+				return value{kind: kindBool, b: left.b && right.b}, nil
+			case opOr:
+				return value{kind: kindBool, b: left.b || right.b}, nil
+			}
+		}
+	}
+	if op == opEquals && left.isScalar() && right.isScalar() {
+		// scalars of different kinds are never equal, NULL only equals NULL.
+		return value{kind: kindBool, b: left.kind == right.kind}, nil
+	}
+
+	var fn func(left, right any) (any, error)
+	switch op {
+	case opAdd:
+		fn = addValues
+	case opSub:
+		fn = subValues
+	case opMultiply:
+		fn = multiplyValues
+	case opDivide:
+		fn = divideValues
+	case opEquals:
+		return value{kind: kindBool, b: valuesEqual(left.any(), right.any())}, nil
+	case opGt:
+		fn = gtValues
+	case opGte:
+		fn = gteValues
+	case opLt:
+		fn = ltValues
+	case opLte:
+		fn = lteValues
+	case opAnd:
+		fn = andValues
+	default:
+		fn = orValues
+	}
+	result, err := fn(left.any(), right.any())
+	if err != nil {
+		return value{}, err
+	}
+	return valueOf(result), nil
+}
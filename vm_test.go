@@ -0,0 +1,138 @@
+package ksql
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompiledMatchesTree(t *testing.T) {
+	assert := require.New(t)
+
+	docs := []string{
+		`{"a":1,"b":2.5,"s":"joey","t":"bloggs","yes":true,"no":false,"nil":null,"arr":[1,2,3],"obj":{"k":"v"},"dt":"2022-01-02T03:04:05Z","d":"1h"}`,
+		`{"a":0,"b":-1,"s":"","t":"z","yes":false,"no":true,"arr":[],"obj":{},"dt":"not a date"}`,
+		`{"a":"1","b":null,"s":5,"yes":"true","no":null,"arr":"x","obj":[]}`,
+		`{}`,
+		``,
+	}
+
+	expressions := []string{
+		`1 + 1 + 1 + 1 + 1`,
+		`.a + .b`,
+		`.a - .b * 2 / .a`,
+		`(.a + .b) / .a`,
+		`.s + " " + .t`,
+		`.a + .nil`,
+		`.nil + .s`,
+		`.a + .s`,
+		`.a / 0`,
+		`.a == 1`,
+		`.a != .b`,
+		`.s == "joey"`,
+		`.nil == NULL`,
+		`.missing == NULL`,
+		`.a == "1"`,
+		`.yes == true`,
+		`.arr == [1, 2, 3]`,
+		`.obj == {"k": "v"}`,
+		`.a > .b`,
+		`.a >= 1`,
+		`.b < 3`,
+		`.b <= .a`,
+		`.s > .t`,
+		`.s >= "a"`,
+		`.t < "c"`,
+		`.t <= .s`,
+		`.yes > .no`,
+		`.a > .s`,
+		`.nil > 1`,
+		`!.yes`,
+		`!(.a != .b)`,
+		`!.s`,
+		`.yes && .no`,
+		`.yes && .a`,
+		`.s && .yes`,
+		`.no && .s`,
+		`.yes || .no`,
+		`.no || .yes`,
+		`.no || .a`,
+		`.s || .yes`,
+		`.yes || .s`,
+		`.nil || .nil`,
+		`.yes && .a > 0 || .no && .b < 0`,
+		`.a > 0 && (.s == "joey" || .t == "z")`,
+		`IF .yes THEN .a ELSE .b`,
+		`IF .s THEN .a ELSE .b`,
+		`IF .yes THEN .a ELSE NULL`,
+		`(IF .no THEN .a ELSE .b) + 1`,
+		`CASE WHEN .a > 1 THEN "big" WHEN .a == 1 THEN "one" ELSE "small" END`,
+		`CASE WHEN .a > 1 THEN "big" WHEN .a == 1 THEN .s + .t END`,
+		`IF (IF .yes THEN .no ELSE .yes) THEN 1 + (IF .no THEN 2 ELSE 3) ELSE 4`,
+		`len(.s) + .a`,
+		`len(.arr) > 2 && .arr CONTAINS 2`,
+		`.s IN ["joey", "bloggs"]`,
+		`.s STARTSWITH "jo" || .s ENDSWITH "ey"`,
+		`EXISTS .nil && !EXISTS .missing`,
+		`ANY .arr (.@this > 2)`,
+		`COERCE .dt _datetime_ + COERCE .d _duration_ > COERCE "2022-01-01" _datetime_`,
+		`COERCE .dt _datetime_ - COERCE "2022-01-01" _datetime_`,
+		`COERCE .a _string_ + .s`,
+		`{"sum": .a + .b, "ok": .yes && .a > 0}`,
+		`[.a, .b, .a + .b]`,
+		`sum(.arr) / count(.arr)`,
+		`.arr.# * 2`,
+		`.obj`,
+		`.arr`,
+	}
+
+	for _, exactNumbers := range []bool{false, true} {
+		for _, exp := range expressions {
+			ex, err := ParseWithOptions([]byte(exp), ParseOptions{ExactNumbers: exactNumbers})
+			assert.NoError(err, exp)
+			compiled := Compile(ex)
+
+			for _, doc := range docs {
+				expected, expectedErr := ex.Calculate([]byte(doc))
+				result, err := compiled.Calculate([]byte(doc))
+				assert.Equal(expectedErr, err, "exp: %s doc: %s exact: %t", exp, doc, exactNumbers)
+				if f, ok := expected.(float64); ok && math.IsNaN(f) {
+					assert.True(math.IsNaN(result.(float64)))
+					continue
+				}
+				assert.Equal(expected, result, "exp: %s doc: %s exact: %t", exp, doc, exactNumbers)
+			}
+		}
+	}
+}
+
+func TestCompiledConcurrent(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`IF .a > 1 THEN .s + "!" ELSE .s`))
+	assert.NoError(err)
+	compiled := Compile(ex)
+
+	tests := []struct {
+		src      string
+		expected any
+	}{
+		{src: `{"a":2,"s":"big"}`, expected: "big!"},
+		{src: `{"a":1,"s":"small"}`, expected: "small"},
+		{src: `{"a":3,"s":""}`, expected: "!"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.src, func(t *testing.T) {
+			t.Parallel()
+
+			for i := 0; i < 100; i++ {
+				result, err := compiled.Calculate([]byte(tc.src))
+				assert.NoError(err)
+				assert.Equal(tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package ksql
+
+import (
+	"errors"
+	"unicode"
+	"unicode/utf8"
+)
+
+// wildcardKind is the kind of a single element of a LIKE or GLOB pattern.
+type wildcardKind uint8
+
+const (
+	// wildcardRune matches the rune exactly.
+	wildcardRune wildcardKind = iota
+
+	// wildcardOne matches any single rune, `_` for LIKE and `?` for GLOB.
+	wildcardOne
+
+	// wildcardMany matches any sequence of runes including none, `%` for LIKE and `*` for GLOB.
+	wildcardMany
+
+	// wildcardClass matches any rune within, or not within if negated, the ranges eg. `[a-z]` for GLOB.
+	wildcardClass
+)
+
+type wildcardElem struct {
+	kind    wildcardKind
+	r       rune
+	negated bool
+	ranges  []rune // pairs of inclusive lower and upper bounds
+}
+
+// wildcardPattern is a LIKE, ILIKE or GLOB pattern translated into the elements matched one rune at a time,
+// allowing matching without allocating.
+type wildcardPattern struct {
+	elems []wildcardElem
+	fold  bool
+}
+
+// parseLike translates a LIKE pattern where `%` matches any sequence of characters, `_` any single character
+// and the escape character, `\` unless another is supplied using ESCAPE, escapes the character following it.
+// When fold is true the pattern matches case insensitively.
+func parseLike(pattern string, fold bool, escape rune) (*wildcardPattern, error) {
+	p := &wildcardPattern{elems: make([]wildcardElem, 0, len(pattern)), fold: fold}
+	for i := 0; i < len(pattern); {
+		r, size := utf8.DecodeRuneInString(pattern[i:])
+		i += size
+		if r == escape {
+			if i == len(pattern) {
+				return nil, errors.New("pattern must not end with the escape character")
+			}
+			r, size = utf8.DecodeRuneInString(pattern[i:])
+			i += size
+			p.elems = append(p.elems, wildcardElem{r: r})
+			continue
+		}
+		switch r {
+		case '%':
+			p.appendMany()
+		case '_':
+			p.elems = append(p.elems, wildcardElem{kind: wildcardOne})
+		default:
+			p.elems = append(p.elems, wildcardElem{r: r})
+		}
+	}
+	return p, nil
+}
+
+// parseGlob translates a GLOB pattern where `*` matches any sequence of characters, `?` any single character
+// and `[...]` any single character within the class, which may contain ranges eg. `[a-z]` and be negated
+// using a leading `^`. A `]` immediately after the opening `[` or `^` is part of the class.
+func parseGlob(pattern string) (*wildcardPattern, error) {
+	p := &wildcardPattern{elems: make([]wildcardElem, 0, len(pattern))}
+	for i := 0; i < len(pattern); {
+		r, size := utf8.DecodeRuneInString(pattern[i:])
+		i += size
+		switch r {
+		case '*':
+			p.appendMany()
+		case '?':
+			p.elems = append(p.elems, wildcardElem{kind: wildcardOne})
+		case '[':
+			elem := wildcardElem{kind: wildcardClass}
+			if i < len(pattern) && pattern[i] == '^' {
+				elem.negated = true
+				i++
+			}
+			closed := false
+			for first := true; i < len(pattern); first = false {
+				lo, size := utf8.DecodeRuneInString(pattern[i:])
+				i += size
+				if lo == ']' && !first {
+					closed = true
+					break
+				}
+				hi := lo
+				if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+					hi, size = utf8.DecodeRuneInString(pattern[i+1:])
+					i += 1 + size
+				}
+				elem.ranges = append(elem.ranges, lo, hi)
+			}
+			if !closed {
+				return nil, errors.New("unterminated character class")
+			}
+			p.elems = append(p.elems, elem)
+		default:
+			p.elems = append(p.elems, wildcardElem{r: r})
+		}
+	}
+	return p, nil
+}
+
+// appendMany appends a wildcardMany element, consecutive ones being equivalent to one.
+func (p *wildcardPattern) appendMany() {
+	if n := len(p.elems); n > 0 && p.elems[n-1].kind == wildcardMany {
+		return
+	}
+	p.elems = append(p.elems, wildcardElem{kind: wildcardMany})
+}
+
+// match returns if the entire string matches the pattern.
+func (p *wildcardPattern) match(s string) bool {
+	var pi, si int
+	// the most recent wildcardMany and the position in s it is currently assumed to match up to, which is
+	// advanced one rune at a time when the elements after it fail to match.
+	starP, starS := -1, 0
+
+	for si < len(s) {
+		if pi < len(p.elems) {
+			elem := &p.elems[pi]
+			if elem.kind == wildcardMany {
+				starP, starS = pi, si
+				pi++
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(s[si:])
+			if p.matchRune(elem, r) {
+				pi++
+				si += size
+				continue
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(s[starS:])
+		starS += size
+		pi, si = starP+1, starS
+	}
+	for pi < len(p.elems) && p.elems[pi].kind == wildcardMany {
+		pi++
+	}
+	return pi == len(p.elems)
+}
+
+func (p *wildcardPattern) matchRune(elem *wildcardElem, r rune) bool {
+	switch elem.kind {
+	case wildcardOne:
+		return true
+	case wildcardClass:
+		for i := 0; i < len(elem.ranges); i += 2 {
+			if r >= elem.ranges[i] && r <= elem.ranges[i+1] {
+				return !elem.negated
+			}
+		}
+		return elem.negated
+	default:
+		if elem.r == r {
+			return true
+		}
+		if p.fold {
+			for f := unicode.SimpleFold(elem.r); f != elem.r; f = unicode.SimpleFold(f) {
+				if f == r {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,291 @@
+package ksql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLike(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name     string
+		exp      string
+		src      string
+		expected any
+		err      bool
+	}{
+		{
+			name:     "suffix",
+			exp:      `.email LIKE "%@example.com"`,
+			src:      `{"email":"joey@example.com"}`,
+			expected: true,
+		},
+		{
+			name:     "suffix no match",
+			exp:      `.email LIKE "%@example.com"`,
+			src:      `{"email":"joey@example.com.au"}`,
+			expected: false,
+		},
+		{
+			name:     "single character",
+			exp:      `.code LIKE "A_C"`,
+			src:      `{"code":"AéC"}`,
+			expected: true,
+		},
+		{
+			name:     "single character requires one",
+			exp:      `.code LIKE "A_C"`,
+			src:      `{"code":"AC"}`,
+			expected: false,
+		},
+		{
+			name:     "case sensitive",
+			exp:      `.name LIKE "jo%"`,
+			src:      `{"name":"Joey"}`,
+			expected: false,
+		},
+		{
+			name:     "case insensitive",
+			exp:      `.name ILIKE "jo%Y"`,
+			src:      `{"name":"JOEY"}`,
+			expected: true,
+		},
+		{
+			name:     "case insensitive unicode",
+			exp:      `.name ILIKE "straße"`,
+			src:      `{"name":"STRAßE"}`,
+			expected: true,
+		},
+		{
+			name:     "escaped wildcards",
+			exp:      `.s LIKE "100\%\_%"`,
+			src:      `{"s":"100%_off"}`,
+			expected: true,
+		},
+		{
+			name:     "escaped wildcard is literal",
+			exp:      `.s LIKE "100\%"`,
+			src:      `{"s":"1000"}`,
+			expected: false,
+		},
+		{
+			name:     "escaped backslash",
+			exp:      `.s LIKE "a\\%"`,
+			src:      `{"s":"a\\b"}`,
+			expected: true,
+		},
+		{
+			name:     "custom escape",
+			exp:      `.s LIKE "100!%!_%" ESCAPE "!"`,
+			src:      `{"s":"100%_off"}`,
+			expected: true,
+		},
+		{
+			name:     "custom escape makes backslash literal",
+			exp:      `.s ILIKE "C:\%" ESCAPE "!"`,
+			src:      `{"s":"c:\\temp"}`,
+			expected: true,
+		},
+		{
+			name:     "custom escape dynamic pattern",
+			exp:      `.s LIKE .prefix + "#%" ESCAPE "#"`,
+			src:      `{"s":"jo%","prefix":"jo"}`,
+			expected: true,
+		},
+		{
+			name:     "custom escaped wildcard is literal",
+			exp:      `.s LIKE "100!%" ESCAPE "!" && .t == 1`,
+			src:      `{"s":"1000","t":1}`,
+			expected: false,
+		},
+		{
+			name:     "backtracking",
+			exp:      `.s LIKE "%a%b%c"`,
+			src:      `{"s":"xaxbxbxcxc"}`,
+			expected: true,
+		},
+		{
+			name:     "empty",
+			exp:      `.s LIKE "%"`,
+			src:      `{"s":""}`,
+			expected: true,
+		},
+		{
+			name:     "negated",
+			exp:      `.email !LIKE "%@example.com"`,
+			src:      `{"email":"joey@acme.com"}`,
+			expected: true,
+		},
+		{
+			name:     "dynamic pattern",
+			exp:      `.name LIKE .prefix + "%"`,
+			src:      `{"name":"joey","prefix":"jo"}`,
+			expected: true,
+		},
+		{
+			name:     "glob",
+			exp:      `.path GLOB "/api/*/users"`,
+			src:      `{"path":"/api/v1/users"}`,
+			expected: true,
+		},
+		{
+			name:     "glob crosses separators",
+			exp:      `.path GLOB "/api/*/users"`,
+			src:      `{"path":"/api/v1/admin/users"}`,
+			expected: true,
+		},
+		{
+			name:     "glob single character",
+			exp:      `.path GLOB "/v?/*"`,
+			src:      `{"path":"/v2/users"}`,
+			expected: true,
+		},
+		{
+			name:     "glob class",
+			exp:      `.code GLOB "[A-C][0-9]*"`,
+			src:      `{"code":"B7x"}`,
+			expected: true,
+		},
+		{
+			name:     "glob negated class",
+			exp:      `.code GLOB "[^A-C]*"`,
+			src:      `{"code":"B7x"}`,
+			expected: false,
+		},
+		{
+			name:     "glob literal wildcard in class",
+			exp:      `.s GLOB "a[*]"`,
+			src:      `{"s":"a*"}`,
+			expected: true,
+		},
+		{
+			name:     "glob leading bracket in class",
+			exp:      `.s GLOB "[]a]"`,
+			src:      `{"s":"]"}`,
+			expected: true,
+		},
+		{
+			name:     "glob case sensitive",
+			exp:      `.s GLOB "A*"`,
+			src:      `{"s":"abc"}`,
+			expected: false,
+		},
+		{
+			name: "invalid dynamic pattern",
+			exp:  `.s GLOB .pattern`,
+			src:  `{"s":"a","pattern":"[a"}`,
+			err:  true,
+		},
+		{
+			name: "non string value",
+			exp:  `.n LIKE "1%"`,
+			src:  `{"n":1}`,
+			err:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ex, err := Parse([]byte(tc.exp))
+			assert.NoError(err)
+
+			result, err := ex.Calculate([]byte(tc.src))
+			if tc.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expected, result)
+		})
+	}
+}
+
+func TestLikeParseErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name   string
+		exp    string
+		offset int
+		err    string
+	}{
+		{
+			name:   "trailing escape",
+			exp:    `.s LIKE $pattern`,
+			offset: 8,
+			err:    "1:9: invalid pattern `a\\`: pattern must not end with the escape character",
+		},
+		{
+			name:   "escape of more than one character",
+			exp:    `.s LIKE "a%" ESCAPE "!!"`,
+			offset: 20,
+			err:    "1:21: ESCAPE must be a single character, found `!!`",
+		},
+		{
+			name:   "empty escape",
+			exp:    `.s ILIKE "a%" ESCAPE ''`,
+			offset: 21,
+			err:    "1:22: ESCAPE must be a single character, found ``",
+		},
+		{
+			name:   "escape not a string",
+			exp:    `.s LIKE "a%" ESCAPE .e`,
+			offset: 20,
+		},
+		{
+			name:   "glob escape",
+			exp:    `.s GLOB "a*" ESCAPE "!"`,
+			offset: 13,
+		},
+		{
+			name:   "unterminated class",
+			exp:    `.s GLOB "[a-"`,
+			offset: 8,
+			err:    "1:9: invalid pattern `[a-`: unterminated character class",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseWithParams([]byte(tc.exp), map[string]any{"pattern": "a\\"})
+			assert.Error(err)
+
+			var syntaxErr ErrSyntax
+			assert.ErrorAs(err, &syntaxErr)
+			assert.Equal(tc.offset, syntaxErr.Offset)
+			if tc.err != "" {
+				assert.Equal(tc.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestLikeTranslatedOnce(t *testing.T) {
+	assert := require.New(t)
+
+	ex, err := Parse([]byte(`.s ILIKE "%joey%"`))
+	assert.NoError(err)
+	l := ex.(like)
+	assert.NotNil(l.pattern)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = l.pattern.match("Hello JOEY Bloggs")
+	})
+	assert.Equal(0.0, allocs)
+
+	ex, err = Parse([]byte(`.s LIKE $pattern`))
+	assert.NoError(err)
+	assert.Nil(ex.(like).pattern)
+
+	bound, err := Bind(ex, map[string]any{"pattern": "a%"})
+	assert.NoError(err)
+	assert.NotNil(bound.(like).pattern)
+}